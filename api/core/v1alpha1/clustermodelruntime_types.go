@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Valid",type="string",JSONPath=".status.conditions[?(@.type=='Valid')].status"
+//+kubebuilder:printcolumn:name="Steps",type="integer",JSONPath=".status.stepCount"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterModelRuntime is the Schema for the clustermodelruntimes API. Cluster model runtimes are
+// provided by the platform and serve steps in every namespace that doesn't have a ModelRuntime
+// supporting their model.
+type ClusterModelRuntime struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ModelRuntimeSpec   `json:"spec,omitempty"`
+	Status ModelRuntimeStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterModelRuntimeList contains a list of ClusterModelRuntime
+type ClusterModelRuntimeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterModelRuntime `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterModelRuntime{}, &ClusterModelRuntimeList{})
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func (rt *ClusterModelRuntime) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(rt).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-core-kai-io-v1alpha1-clustermodelruntime,mutating=false,failurePolicy=fail,sideEffects=None,groups=core.kai.io,resources=clustermodelruntimes,verbs=create;update,versions=v1alpha1,name=vclustermodelruntime.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ClusterModelRuntime{}
+
+// ValidateCreate implements webhook.Validator
+func (rt *ClusterModelRuntime) ValidateCreate() (admission.Warnings, error) {
+	return nil, rt.validate()
+}
+
+// ValidateUpdate implements webhook.Validator
+func (rt *ClusterModelRuntime) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	return nil, rt.validate()
+}
+
+// ValidateDelete implements webhook.Validator
+func (rt *ClusterModelRuntime) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (rt *ClusterModelRuntime) validate() error {
+	errs := rt.Spec.validate(field.NewPath("spec"))
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(rt.GroupVersionKind().GroupKind(), rt.Name, errs)
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// v1alpha1 is the storage version and the version used by the controllers, other versions are
+// converted to and from it.
+
+// Hub marks this type as a conversion hub.
+func (*Step) Hub() {}
+
+// Hub marks this type as a conversion hub.
+func (*ModelRuntime) Hub() {}
+
+// Hub marks this type as a conversion hub.
+func (*Pipeline) Hub() {}
+
+// Hub marks this type as a conversion hub.
+func (*PipelineRun) Hub() {}
+
+// Hub marks this type as a conversion hub.
+func (*ScheduledPipelineRun) Hub() {}
+
+// Hub marks this type as a conversion hub.
+func (*ClusterModelRuntime) Hub() {}
@@ -22,9 +22,39 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// InferenceContainerName is the name of the container of a ModelRuntime serving the model. The
+// model is downloaded into a volume mounted into this container.
+const InferenceContainerName = "kai-container"
+
+// Placeholders resolved per step in the command, args and env values of the containers of a
+// model runtime, so a single runtime serves models with different layouts. Other $(VAR)
+// references are left to Kubernetes, which expands them from the env of the container.
+const (
+	// ModelURIPlaceholder is replaced by the URI of the model.
+	ModelURIPlaceholder = "$(model.uri)"
+	// ModelNamePlaceholder is replaced by the name the model is served under, the name of the step.
+	ModelNamePlaceholder = "$(model.name)"
+	// ModelMountPathPlaceholder is replaced by the path the model is downloaded to.
+	ModelMountPathPlaceholder = "$(model.mountPath)"
+	// StepNamePlaceholder is replaced by the name of the step.
+	StepNamePlaceholder = "$(step.name)"
+	// StepNamespacePlaceholder is replaced by the namespace of the step.
+	StepNamespacePlaceholder = "$(step.namespace)"
+	// PortPlaceholder is replaced by the first port exposed by the kai-container.
+	PortPlaceholder = "$(runtime.port)"
+)
+
 // ModelRuntimeSpec defines the desired state of ModelRuntime
 type ModelRuntimeSpec struct {
-	SupportedModelFormats []ModelFormat `json:"supportedModelFormats"`
+	// SupportedModelFormats lists the names of the model formats served by the runtime. They are
+	// selected automatically with the default priority.
+	// Deprecated: use ModelFormats, v1beta1 only has the structured formats.
+	// +optional
+	SupportedModelFormats []ModelFormat `json:"supportedModelFormats,omitempty"`
+
+	// ModelFormats lists the model formats served by the runtime.
+	// +optional
+	ModelFormats []SupportedModelFormat `json:"modelFormats,omitempty"`
 
 	Containers []corev1.Container `json:"containers"`
 
@@ -41,14 +71,73 @@ type ModelRuntimeSpec struct {
 	Behavior *autoscaling.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
 }
 
+// SupportedModelFormat is a model format served by a runtime.
+type SupportedModelFormat struct {
+	// Name of the model format e.g.; pytorch, onnx
+	Name ModelFormat `json:"name"`
+
+	// Version of the model format. A step requesting a version is only served by runtimes
+	// supporting the same version, or its major version e.g.; "2" supports "2.1". Runtimes
+	// without a version serve every version.
+	// +optional
+	Version *string `json:"version,omitempty"`
+
+	// AutoSelect allows the runtime to be selected for steps which don't name a model runtime.
+	// Defaults to true.
+	// +optional
+	AutoSelect *bool `json:"autoSelect,omitempty"`
+
+	// Priority of the runtime among the runtimes automatically selected for the format, the
+	// highest priority wins and runtimes of equal priority are ordered by name. Defaults to 0.
+	// +optional
+	Priority *int32 `json:"priority,omitempty"`
+}
+
+// GetModelFormats returns the model formats served by the runtime, including the deprecated
+// SupportedModelFormats.
+func (s *ModelRuntimeSpec) GetModelFormats() []SupportedModelFormat {
+	formats := make([]SupportedModelFormat, 0, len(s.SupportedModelFormats)+len(s.ModelFormats))
+	for _, name := range s.SupportedModelFormats {
+		formats = append(formats, SupportedModelFormat{Name: name})
+	}
+	return append(formats, s.ModelFormats...)
+}
+
 // ModelRuntimeStatus defines the observed state of ModelRuntime
 type ModelRuntimeStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+
+	// ObservedGeneration is the most recent generation of the runtime reconciled by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// StepCount is the number of steps served by the runtime.
+	// +optional
+	StepCount int32 `json:"stepCount,omitempty"`
+
+	// Steps lists the namespaced names of the steps served by the runtime, it is truncated to
+	// the first 100 steps in alphabetical order.
+	// +optional
+	Steps []string `json:"steps,omitempty"`
 }
 
+// ModelRuntime condition types
+const (
+	// ModelRuntimeConditionValid indicates whether the runtime is able to serve models. It is
+	// false when the runtime lacks a kai-container exposing a port or doesn't list any model
+	// formats.
+	ModelRuntimeConditionValid = "Valid"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Valid",type="string",JSONPath=".status.conditions[?(@.type=='Valid')].status"
+//+kubebuilder:printcolumn:name="Steps",type="integer",JSONPath=".status.stepCount"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+//+kubebuilder:storageversion
 
-// ModelRuntime is the Schema for the modelruntimes API
+// ModelRuntime is the Schema for the modelruntimes API. Model runtimes only serve steps in their
+// own namespace and take precedence over cluster model runtimes.
 type ModelRuntime struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
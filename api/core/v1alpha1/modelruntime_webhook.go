@@ -0,0 +1,154 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func (rt *ModelRuntime) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(rt).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-core-kai-io-v1alpha1-modelruntime,mutating=false,failurePolicy=fail,sideEffects=None,groups=core.kai.io,resources=modelruntimes,verbs=create;update,versions=v1alpha1,name=vmodelruntime.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ModelRuntime{}
+
+// ValidateCreate implements webhook.Validator
+func (rt *ModelRuntime) ValidateCreate() (admission.Warnings, error) {
+	return nil, rt.validate()
+}
+
+// ValidateUpdate implements webhook.Validator
+func (rt *ModelRuntime) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	return nil, rt.validate()
+}
+
+// ValidateDelete implements webhook.Validator
+func (rt *ModelRuntime) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (rt *ModelRuntime) validate() error {
+	errs := rt.Spec.validate(field.NewPath("spec"))
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(rt.GroupVersionKind().GroupKind(), rt.Name, errs)
+}
+
+func (s *ModelRuntimeSpec) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	found := false
+	for _, c := range s.Containers {
+		if c.Name == InferenceContainerName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		errs = append(errs, field.Required(path.Child("containers"),
+			fmt.Sprintf("a container named %q serving the model must be set, the model is mounted into it", InferenceContainerName)))
+	}
+
+	errs = append(errs, validateModelFormats(path.Child("modelFormats"), s.ModelFormats)...)
+	errs = append(errs, validatePlaceholders(path.Child("containers"), s.Containers)...)
+	errs = append(errs, validateReplicas(path, s.MinReplicas, s.MaxReplicas)...)
+
+	return errs
+}
+
+func validateModelFormats(path *field.Path, formats []SupportedModelFormat) field.ErrorList {
+	var errs field.ErrorList
+
+	seen := map[string]bool{}
+	for i, f := range formats {
+		if f.Name == "" {
+			errs = append(errs, field.Required(path.Index(i).Child("name"), "the name of the model format must be set"))
+			continue
+		}
+		key := string(f.Name)
+		if f.Version != nil {
+			key += "@" + *f.Version
+		}
+		if seen[key] {
+			errs = append(errs, field.Duplicate(path.Index(i), f))
+		}
+		seen[key] = true
+	}
+
+	return errs
+}
+
+// placeholder matches the references to the placeholders kai resolves per step.
+var placeholder = regexp.MustCompile(`\$\((?:model|step|runtime)\.[^)]*\)`)
+
+var placeholders = map[string]bool{
+	ModelURIPlaceholder:       true,
+	ModelNamePlaceholder:      true,
+	ModelMountPathPlaceholder: true,
+	StepNamePlaceholder:       true,
+	StepNamespacePlaceholder:  true,
+	PortPlaceholder:           true,
+}
+
+// UnknownPlaceholders returns the references to placeholders kai doesn't resolve in a command,
+// argument or env value of a runtime container.
+func UnknownPlaceholders(value string) []string {
+	var out []string
+	for _, ref := range placeholder.FindAllString(value, -1) {
+		if !placeholders[ref] {
+			out = append(out, ref)
+		}
+	}
+	return out
+}
+
+func validatePlaceholders(path *field.Path, containers []corev1.Container) field.ErrorList {
+	var errs field.ErrorList
+
+	check := func(path *field.Path, value string) {
+		for _, ref := range UnknownPlaceholders(value) {
+			errs = append(errs, field.Invalid(path, value, fmt.Sprintf("unknown placeholder %s", ref)))
+		}
+	}
+	for i, c := range containers {
+		for j, v := range c.Command {
+			check(path.Index(i).Child("command").Index(j), v)
+		}
+		for j, v := range c.Args {
+			check(path.Index(i).Child("args").Index(j), v)
+		}
+		for j, e := range c.Env {
+			check(path.Index(i).Child("env").Index(j).Child("value"), e.Value)
+		}
+	}
+
+	return errs
+}
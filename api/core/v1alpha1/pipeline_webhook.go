@@ -0,0 +1,139 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	"github.com/dreamstax/kai/internal/pipeline/dag"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func (p *Pipeline) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(p).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-core-kai-io-v1alpha1-pipeline,mutating=false,failurePolicy=fail,sideEffects=None,groups=core.kai.io,resources=pipelines,verbs=create;update,versions=v1alpha1,name=vpipeline.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Pipeline{}
+
+// ValidateCreate implements webhook.Validator
+func (p *Pipeline) ValidateCreate() (admission.Warnings, error) {
+	return nil, p.validate()
+}
+
+// ValidateUpdate implements webhook.Validator
+func (p *Pipeline) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	return nil, p.validate()
+}
+
+// ValidateDelete implements webhook.Validator
+func (p *Pipeline) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (p *Pipeline) validate() error {
+	errs := p.Spec.validate(field.NewPath("spec"))
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(p.GroupVersionKind().GroupKind(), p.Name, errs)
+}
+
+func (p *PipelineSpec) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	// steps are keyed by their name, falling back to their index, the same way the
+	// controller names the resulting Step resources
+	keys := make(map[string]int, len(p.Steps))
+	for i, s := range p.Steps {
+		if s == nil {
+			continue
+		}
+		key := s.Name
+		if key == "" {
+			key = fmt.Sprintf("step-%d", i)
+		}
+		if j, ok := keys[key]; ok {
+			errs = append(errs, field.Duplicate(path.Child("steps").Index(i).Child("metadata", "name"),
+				fmt.Sprintf("%s (already used by step %d, unnamed steps are named step-<index>)", key, j)))
+			continue
+		}
+		keys[key] = i
+	}
+
+	for i, s := range p.Steps {
+		if s == nil {
+			continue
+		}
+		errs = append(errs, s.validate(path.Child("steps").Index(i), keys)...)
+	}
+
+	// cycles are only meaningful once the steps and their dependencies are known to be valid
+	if len(errs) == 0 {
+		nodes := make([]dag.Node, 0, len(p.Steps))
+		for i, s := range p.Steps {
+			if s == nil {
+				continue
+			}
+			key := s.Name
+			if key == "" {
+				key = fmt.Sprintf("step-%d", i)
+			}
+			nodes = append(nodes, dag.Node{Name: key, DependsOn: s.DependsOn})
+		}
+		if _, err := dag.Resolve(nodes); err != nil {
+			errs = append(errs, field.Invalid(path.Child("steps"), len(p.Steps), err.Error()))
+		}
+	}
+
+	return errs
+}
+
+func (s *StepTemplateSpec) validate(path *field.Path, keys map[string]int) field.ErrorList {
+	var errs field.ErrorList
+
+	for j, dep := range s.DependsOn {
+		if _, ok := keys[dep]; !ok {
+			errs = append(errs, field.NotFound(path.Child("dependsOn").Index(j), dep))
+		}
+	}
+
+	switch {
+	case s.StepRef != nil && s.Endpoint != nil:
+		errs = append(errs, field.Forbidden(path.Child("endpoint"), "stepRef and endpoint are mutually exclusive"))
+	case s.StepRef != nil:
+		if s.StepRef.Name == "" {
+			errs = append(errs, field.Required(path.Child("stepRef", "name"), "the name of the referenced step must be set"))
+		}
+	case s.Endpoint != nil:
+		if (s.Endpoint.URL == "") == (s.Endpoint.Service == nil) {
+			errs = append(errs, field.Invalid(path.Child("endpoint"), s.Endpoint.URL, "exactly one of url and service must be set"))
+		}
+	default:
+		errs = append(errs, s.Spec.validate(path.Child("spec"))...)
+	}
+
+	return errs
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PipelineRunSpec defines the desired state of PipelineRun
+type PipelineRunSpec struct {
+	// PipelineRef references the pipeline to run within the same namespace.
+	// +required
+	PipelineRef corev1.LocalObjectReference `json:"pipelineRef"`
+
+	// Inputs are passed to the entrypoint steps of the pipeline.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Inputs *runtime.RawExtension `json:"inputs,omitempty"`
+
+	// Cancelled stops the run if it has not yet completed.
+	// +optional
+	Cancelled bool `json:"cancelled,omitempty"`
+}
+
+// PipelineRunPhase is a simple summary of where a run is in its lifecycle.
+// +kubebuilder:validation:Enum=Pending;Running;Succeeded;Failed;Cancelled
+type PipelineRunPhase string
+
+const (
+	// PipelineRunPending means the run is waiting for the pipeline to be ready.
+	PipelineRunPending PipelineRunPhase = "Pending"
+
+	// PipelineRunRunning means the run was submitted and at least one step has not completed.
+	PipelineRunRunning PipelineRunPhase = "Running"
+
+	// PipelineRunSucceeded means all steps of the run completed successfully.
+	PipelineRunSucceeded PipelineRunPhase = "Succeeded"
+
+	// PipelineRunFailed means the run completed and at least one step failed.
+	PipelineRunFailed PipelineRunPhase = "Failed"
+
+	// PipelineRunCancelled means the run was stopped before completing.
+	PipelineRunCancelled PipelineRunPhase = "Cancelled"
+)
+
+// IsFinished returns true for phases the run cannot leave.
+func (p PipelineRunPhase) IsFinished() bool {
+	return p == PipelineRunSucceeded || p == PipelineRunFailed || p == PipelineRunCancelled
+}
+
+// PipelineRunStatus defines the observed state of PipelineRun
+type PipelineRunStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+
+	// Phase summarizes the lifecycle of the run.
+	// +optional
+	Phase PipelineRunPhase `json:"phase,omitempty"`
+
+	// JobID is the ID of the job executing the run within kai-piper.
+	// +optional
+	JobID string `json:"jobID,omitempty"`
+
+	// StartTime is when the job of the run was started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the run finished.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Steps reports the execution of each step of the run.
+	// +optional
+	Steps []PipelineRunStepStatus `json:"steps,omitempty"`
+}
+
+// PipelineRunStepStatus reports the execution of a single step of a run.
+type PipelineRunStepStatus struct {
+	// Name of the step within the pipeline.
+	Name string `json:"name"`
+
+	// Phase of the step.
+	// +optional
+	Phase PipelineRunPhase `json:"phase,omitempty"`
+
+	// StartTime is when the step started executing.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the step finished executing.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Output returned by the step.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Output *runtime.RawExtension `json:"output,omitempty"`
+
+	// Message describes why the step failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// PipelineRun condition types
+const (
+	// PipelineRunConditionSucceeded is unknown while the run is executing and reports whether
+	// the run succeeded once it finishes.
+	PipelineRunConditionSucceeded = "Succeeded"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Pipeline",type="string",JSONPath=".spec.pipelineRef.name"
+//+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+//+kubebuilder:printcolumn:name="Start",type="date",JSONPath=".status.startTime"
+//+kubebuilder:printcolumn:name="Completion",type="date",JSONPath=".status.completionTime"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// PipelineRun is the Schema for the pipelineruns API
+type PipelineRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PipelineRunSpec   `json:"spec,omitempty"`
+	Status PipelineRunStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PipelineRunList contains a list of PipelineRun
+type PipelineRunList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PipelineRun `json:"items"`
+}
+
+func (r *PipelineRun) GetGroupVersionKind() schema.GroupVersionKind {
+	return r.GroupVersionKind()
+}
+
+func (r *PipelineRun) NamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: r.Namespace,
+		Name:      r.Name,
+	}
+}
+
+func init() {
+	SchemeBuilder.Register(&PipelineRun{}, &PipelineRunList{})
+}
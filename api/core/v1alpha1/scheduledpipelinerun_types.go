@@ -0,0 +1,161 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ScheduledPipelineRunSpec defines the desired state of ScheduledPipelineRun
+type ScheduledPipelineRunSpec struct {
+	// Schedule in Cron format, see https://en.wikipedia.org/wiki/Cron.
+	// +kubebuilder:validation:MinLength=1
+	// +required
+	Schedule string `json:"schedule"`
+
+	// TimeZone is the name of the time zone the schedule is evaluated in, e.g. "Europe/Berlin".
+	// Defaults to the time zone of the controller.
+	// +optional
+	TimeZone *string `json:"timeZone,omitempty"`
+
+	// StartingDeadlineSeconds is the deadline in seconds for starting a run if it misses its
+	// scheduled time for any reason. Missed runs are counted as failed.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+
+	// ConcurrencyPolicy specifies how to treat concurrent runs. Defaults to Allow.
+	// +kubebuilder:default=Allow
+	// +optional
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+
+	// Suspend tells the controller to suspend subsequent runs, it does not apply to runs
+	// already started. Defaults to false.
+	// +optional
+	Suspend *bool `json:"suspend,omitempty"`
+
+	// RunTemplate is the template of the runs created on schedule.
+	// +required
+	RunTemplate PipelineRunTemplateSpec `json:"runTemplate"`
+
+	// SuccessfulRunsHistoryLimit is the number of successful finished runs to retain. Defaults to 3.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=3
+	// +optional
+	SuccessfulRunsHistoryLimit *int32 `json:"successfulRunsHistoryLimit,omitempty"`
+
+	// FailedRunsHistoryLimit is the number of failed or cancelled runs to retain. Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=1
+	// +optional
+	FailedRunsHistoryLimit *int32 `json:"failedRunsHistoryLimit,omitempty"`
+}
+
+// PipelineRunTemplateSpec describes the run created from a template.
+type PipelineRunTemplateSpec struct {
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +required
+	Spec PipelineRunSpec `json:"spec"`
+}
+
+// ConcurrencyPolicy describes how runs of a ScheduledPipelineRun are handled when they overlap.
+// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+type ConcurrencyPolicy string
+
+const (
+	// AllowConcurrent allows runs to run concurrently.
+	AllowConcurrent ConcurrencyPolicy = "Allow"
+
+	// ForbidConcurrent skips the next run if the previous one hasn't finished yet.
+	ForbidConcurrent ConcurrencyPolicy = "Forbid"
+
+	// ReplaceConcurrent cancels the currently active runs and starts a new one.
+	ReplaceConcurrent ConcurrencyPolicy = "Replace"
+)
+
+// ScheduledPipelineRunStatus defines the observed state of ScheduledPipelineRun
+type ScheduledPipelineRunStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+
+	// Active holds references to the runs which have not yet finished.
+	// +listType=atomic
+	// +optional
+	Active []corev1.ObjectReference `json:"active,omitempty"`
+
+	// LastScheduleTime is the last time a run was successfully scheduled.
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastSuccessfulTime is the last time a run completed successfully.
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+}
+
+// ScheduledPipelineRun condition types
+const (
+	// ScheduledPipelineRunConditionScheduled reports whether runs are being created on schedule.
+	// It turns false when the schedule is invalid or scheduled runs were skipped.
+	ScheduledPipelineRunConditionScheduled = "Scheduled"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Schedule",type="string",JSONPath=".spec.schedule"
+//+kubebuilder:printcolumn:name="Pipeline",type="string",JSONPath=".spec.runTemplate.spec.pipelineRef.name"
+//+kubebuilder:printcolumn:name="Suspend",type="boolean",JSONPath=".spec.suspend"
+//+kubebuilder:printcolumn:name="Last Schedule",type="date",JSONPath=".status.lastScheduleTime"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ScheduledPipelineRun is the Schema for the scheduledpipelineruns API
+type ScheduledPipelineRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ScheduledPipelineRunSpec   `json:"spec,omitempty"`
+	Status ScheduledPipelineRunStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ScheduledPipelineRunList contains a list of ScheduledPipelineRun
+type ScheduledPipelineRunList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ScheduledPipelineRun `json:"items"`
+}
+
+func (r *ScheduledPipelineRun) GetGroupVersionKind() schema.GroupVersionKind {
+	return r.GroupVersionKind()
+}
+
+func (r *ScheduledPipelineRun) NamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: r.Namespace,
+		Name:      r.Name,
+	}
+}
+
+func init() {
+	SchemeBuilder.Register(&ScheduledPipelineRun{}, &ScheduledPipelineRunList{})
+}
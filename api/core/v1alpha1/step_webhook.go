@@ -0,0 +1,142 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupWebhookWithManager registers the webhooks of steps. Defaulting binds steps serving a model
+// to the model runtime resolved for them and inherits its replicas and metrics, so the defaulter
+// is provided by the controller, which shares it with the reconcilers.
+func (s *Step) SetupWebhookWithManager(mgr ctrl.Manager, defaulter admission.CustomDefaulter) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(s).
+		WithDefaulter(defaulter).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-core-kai-io-v1alpha1-step,mutating=true,failurePolicy=fail,sideEffects=None,groups=core.kai.io,resources=steps,verbs=create;update,versions=v1alpha1,name=mstep.kb.io,admissionReviewVersions=v1
+
+//+kubebuilder:webhook:path=/validate-core-kai-io-v1alpha1-step,mutating=false,failurePolicy=fail,sideEffects=None,groups=core.kai.io,resources=steps,verbs=create;update,versions=v1alpha1,name=vstep.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Step{}
+
+// ValidateCreate implements webhook.Validator
+func (s *Step) ValidateCreate() (admission.Warnings, error) {
+	return nil, s.validate()
+}
+
+// ValidateUpdate implements webhook.Validator
+func (s *Step) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	return nil, s.validate()
+}
+
+// ValidateDelete implements webhook.Validator
+func (s *Step) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (s *Step) validate() error {
+	errs := s.Spec.validate(field.NewPath("spec"))
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(s.GroupVersionKind().GroupKind(), s.Name, errs)
+}
+
+// validate checks the spec of a step, it is shared with the steps embedded in pipelines.
+func (s *StepSpec) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(s.Containers) == 0 && s.Model == nil {
+		errs = append(errs, field.Required(path, "either containers or model must be set to run the step"))
+	}
+
+	if s.Model != nil {
+		if s.Model.URI == "" {
+			errs = append(errs, field.Required(path.Child("model", "uri"), "the location of the model to serve must be set"))
+		}
+		if s.Model.ModelFormat == "" && s.Model.ModelRuntime == "" {
+			errs = append(errs, field.Required(path.Child("model"), "either modelFormat or modelRuntime must be set to select a model runtime"))
+		}
+		if s.Model.ModelFormatVersion != "" && s.Model.ModelFormat == "" {
+			errs = append(errs, field.Required(path.Child("model", "modelFormat"), "the model format of the version must be set"))
+		}
+	}
+
+	errs = append(errs, validateReplicas(path, s.MinReplicas, s.MaxReplicas)...)
+	errs = append(errs, validateTraffic(path.Child("traffic"), s.Traffic)...)
+
+	return errs
+}
+
+// validateReplicas checks the replica bounds shared by steps and model runtimes. A maxReplicas
+// of 0 is left to be filled in from the model runtime.
+func validateReplicas(path *field.Path, min *int32, max int32) field.ErrorList {
+	var errs field.ErrorList
+
+	if min != nil && *min < 0 {
+		errs = append(errs, field.Invalid(path.Child("minReplicas"), *min, "must not be negative"))
+	}
+	if max < 0 {
+		errs = append(errs, field.Invalid(path.Child("maxReplicas"), max, "must not be negative"))
+	}
+
+	lower := int32(1)
+	if min != nil {
+		lower = *min
+	}
+	if max != 0 && max < lower {
+		errs = append(errs, field.Invalid(path.Child("maxReplicas"), max,
+			fmt.Sprintf("must be greater than or equal to minReplicas (%d)", lower)))
+	}
+
+	return errs
+}
+
+func validateTraffic(path *field.Path, traffic []TrafficTarget) field.ErrorList {
+	if len(traffic) == 0 {
+		return nil
+	}
+
+	var errs field.ErrorList
+	var total int64
+	for i, t := range traffic {
+		latest := t.LatestRevision != nil && *t.LatestRevision
+		switch {
+		case latest && t.RevisionName != "":
+			errs = append(errs, field.Invalid(path.Index(i), t.RevisionName, "revisionName and latestRevision are mutually exclusive"))
+		case !latest && t.RevisionName == "":
+			errs = append(errs, field.Required(path.Index(i), "either revisionName or latestRevision must be set"))
+		}
+		total += t.Percent
+	}
+
+	if total != 100 {
+		errs = append(errs, field.Invalid(path, total, "traffic percentages must add up to 100"))
+	}
+
+	return errs
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func containers() PodSpec {
+	return PodSpec{Containers: []corev1.Container{{Name: "echo", Image: "echo"}}}
+}
+
+func TestValidateStepSpec(t *testing.T) {
+	one, three := int32(1), int32(3)
+	latest := true
+
+	tests := []struct {
+		name string
+		spec StepSpec
+		want []string
+	}{
+		{
+			name: "containers",
+			spec: StepSpec{PodSpec: containers()},
+		},
+		{
+			name: "model",
+			spec: StepSpec{Model: &ModelSpec{ModelFormat: PytorchModelFormat, URI: "gs://models/resnet"}},
+		},
+		{
+			name: "neither containers nor model",
+			spec: StepSpec{},
+			want: []string{"spec"},
+		},
+		{
+			name: "model format version without format",
+			spec: StepSpec{Model: &ModelSpec{URI: "gs://models/resnet", ModelRuntime: "torchserve", ModelFormatVersion: "2"}},
+			want: []string{"spec.model.modelFormat"},
+		},
+		{
+			name: "model without uri or runtime",
+			spec: StepSpec{Model: &ModelSpec{}},
+			want: []string{"spec.model.uri", "spec.model"},
+		},
+		{
+			name: "maxReplicas below minReplicas",
+			spec: StepSpec{PodSpec: containers(), MinReplicas: &three, MaxReplicas: 2},
+			want: []string{"spec.maxReplicas"},
+		},
+		{
+			name: "negative maxReplicas",
+			spec: StepSpec{PodSpec: containers(), MaxReplicas: -1},
+			want: []string{"spec.maxReplicas", "spec.maxReplicas"},
+		},
+		{
+			name: "maxReplicas left to the runtime",
+			spec: StepSpec{PodSpec: containers(), MinReplicas: &three},
+		},
+		{
+			name: "traffic",
+			spec: StepSpec{PodSpec: containers(), MinReplicas: &one, Traffic: []TrafficTarget{
+				{RevisionName: "step-abc", Percent: 10},
+				{LatestRevision: &latest, Percent: 90},
+			}},
+		},
+		{
+			name: "traffic not adding up",
+			spec: StepSpec{PodSpec: containers(), Traffic: []TrafficTarget{
+				{RevisionName: "step-abc", LatestRevision: &latest, Percent: 10},
+				{Percent: 80},
+			}},
+			want: []string{"spec.traffic[0]", "spec.traffic[1]", "spec.traffic"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := tt.spec.validate(field.NewPath("spec"))
+			assertFields(t, errs, tt.want)
+		})
+	}
+}
+
+func TestValidateModelRuntimeSpec(t *testing.T) {
+	three := int32(3)
+	v2 := "2"
+
+	tests := []struct {
+		name string
+		spec ModelRuntimeSpec
+		want []string
+	}{
+		{
+			name: "kai-container",
+			spec: ModelRuntimeSpec{Containers: []corev1.Container{{Name: "sidecar"}, {Name: InferenceContainerName}}},
+		},
+		{
+			name: "no kai-container",
+			spec: ModelRuntimeSpec{Containers: []corev1.Container{{Name: "server"}}},
+			want: []string{"spec.containers"},
+		},
+		{
+			name: "maxReplicas below minReplicas",
+			spec: ModelRuntimeSpec{Containers: []corev1.Container{{Name: InferenceContainerName}}, MinReplicas: &three, MaxReplicas: 2},
+			want: []string{"spec.maxReplicas"},
+		},
+		{
+			name: "model formats",
+			spec: ModelRuntimeSpec{Containers: []corev1.Container{{Name: InferenceContainerName}}, ModelFormats: []SupportedModelFormat{
+				{Name: PytorchModelFormat},
+				{Name: PytorchModelFormat, Version: &v2},
+			}},
+		},
+		{
+			name: "duplicate and unnamed model formats",
+			spec: ModelRuntimeSpec{Containers: []corev1.Container{{Name: InferenceContainerName}}, ModelFormats: []SupportedModelFormat{
+				{Name: PytorchModelFormat, Version: &v2},
+				{Name: PytorchModelFormat, Version: &v2},
+				{Version: &v2},
+			}},
+			want: []string{"spec.modelFormats[1]", "spec.modelFormats[2].name"},
+		},
+		{
+			name: "placeholders",
+			spec: ModelRuntimeSpec{Containers: []corev1.Container{{
+				Name:    InferenceContainerName,
+				Command: []string{"/bin/server"},
+				Args:    []string{"--model=" + ModelMountPathPlaceholder + "/" + ModelNamePlaceholder, "--port=$(runtime.port)", "--workers=$(WORKERS)"},
+				Env:     []corev1.EnvVar{{Name: "MODEL_URI", Value: ModelURIPlaceholder}},
+			}}},
+		},
+		{
+			name: "unknown placeholders",
+			spec: ModelRuntimeSpec{Containers: []corev1.Container{{
+				Name:    InferenceContainerName,
+				Command: []string{"$(step.image)"},
+				Args:    []string{"--model=$(model.path)/$(model.version)"},
+				Env:     []corev1.EnvVar{{Name: "PORT", Value: "$(runtime.ports)"}},
+			}}},
+			want: []string{"spec.containers[0].command[0]", "spec.containers[0].args[0]", "spec.containers[0].args[0]", "spec.containers[0].env[0].value"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := tt.spec.validate(field.NewPath("spec"))
+			assertFields(t, errs, tt.want)
+		})
+	}
+}
+
+func TestValidatePipelineSpec(t *testing.T) {
+	step := func(name string, deps ...string) *StepTemplateSpec {
+		return &StepTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       StepSpec{PodSpec: containers()},
+			DependsOn:  deps,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		steps []*StepTemplateSpec
+		want  []string
+	}{
+		{
+			name:  "dag",
+			steps: []*StepTemplateSpec{step("a"), step("b", "a"), step("", "a", "b")},
+		},
+		{
+			name:  "duplicate names",
+			steps: []*StepTemplateSpec{step("a"), step("b"), step("a")},
+			want:  []string{"spec.steps[2].metadata.name"},
+		},
+		{
+			name:  "name clashing with an unnamed step",
+			steps: []*StepTemplateSpec{step(""), step("step-0")},
+			want:  []string{"spec.steps[1].metadata.name"},
+		},
+		{
+			name:  "unknown dependency",
+			steps: []*StepTemplateSpec{step("a", "b")},
+			want:  []string{"spec.steps[0].dependsOn[0]"},
+		},
+		{
+			name:  "cycle",
+			steps: []*StepTemplateSpec{step("a", "c"), step("b", "a"), step("c", "b")},
+			want:  []string{"spec.steps"},
+		},
+		{
+			name:  "self dependency",
+			steps: []*StepTemplateSpec{step("a", "a")},
+			want:  []string{"spec.steps"},
+		},
+		{
+			name:  "invalid step spec",
+			steps: []*StepTemplateSpec{{ObjectMeta: metav1.ObjectMeta{Name: "a"}}},
+			want:  []string{"spec.steps[0].spec"},
+		},
+		{
+			name: "external steps",
+			steps: []*StepTemplateSpec{
+				{ObjectMeta: metav1.ObjectMeta{Name: "a"}, StepRef: &StepReference{Name: "shared"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "b"}, Endpoint: &EndpointReference{URL: "http://model.example.com"}},
+			},
+		},
+		{
+			name: "invalid external steps",
+			steps: []*StepTemplateSpec{
+				{ObjectMeta: metav1.ObjectMeta{Name: "a"}, StepRef: &StepReference{Name: "shared"}, Endpoint: &EndpointReference{URL: "http://model.example.com"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "b"}, Endpoint: &EndpointReference{}},
+			},
+			want: []string{"spec.steps[0].endpoint", "spec.steps[1].endpoint"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := PipelineSpec{Steps: tt.steps}
+			errs := spec.validate(field.NewPath("spec"))
+			assertFields(t, errs, tt.want)
+		})
+	}
+}
+
+func assertFields(t *testing.T, errs field.ErrorList, want []string) {
+	t.Helper()
+
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %v", len(want), errs)
+	}
+	for i, err := range errs {
+		if err.Field != want[i] {
+			t.Errorf("expected error %d on %s, got %v", i, want[i], err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/dreamstax/kai/api/core/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Step webhook", func() {
+	It("admits a step running containers", func() {
+		s := &Step{
+			ObjectMeta: metav1.ObjectMeta{Name: "containers", Namespace: "default"},
+			Spec:       StepSpec{PodSpec: PodSpec{Containers: []corev1.Container{{Name: "echo", Image: "echo"}}}},
+		}
+		Expect(k8sClient.Create(ctx, s)).To(Succeed())
+	})
+
+	It("rejects a step with neither containers nor model", func() {
+		s := &Step{ObjectMeta: metav1.ObjectMeta{Name: "empty", Namespace: "default"}}
+		err := k8sClient.Create(ctx, s)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("either containers or model must be set"))
+	})
+
+	It("rejects maxReplicas below minReplicas", func() {
+		min := int32(3)
+		s := &Step{
+			ObjectMeta: metav1.ObjectMeta{Name: "replicas", Namespace: "default"},
+			Spec: StepSpec{
+				PodSpec:     PodSpec{Containers: []corev1.Container{{Name: "echo", Image: "echo"}}},
+				MinReplicas: &min,
+				MaxReplicas: 2,
+			},
+		}
+		err := k8sClient.Create(ctx, s)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.maxReplicas"))
+	})
+
+	It("binds a step serving a model to its runtime", func() {
+		min := int32(2)
+		rt := &ModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "sklearn-server", Namespace: "default"},
+			Spec: ModelRuntimeSpec{
+				SupportedModelFormats: []ModelFormat{SklearnModelFormat},
+				Containers:            []corev1.Container{{Name: InferenceContainerName, Image: "sklearn-server"}},
+				MinReplicas:           &min,
+				MaxReplicas:           4,
+			},
+		}
+		Expect(k8sClient.Create(ctx, rt)).To(Succeed())
+
+		s := &Step{
+			ObjectMeta: metav1.ObjectMeta{Name: "model", Namespace: "default"},
+			Spec: StepSpec{
+				Model: &ModelSpec{ModelFormat: SklearnModelFormat, URI: "gs://models/iris"},
+			},
+		}
+		Expect(k8sClient.Create(ctx, s)).To(Succeed())
+
+		Expect(s.Spec.Model.ModelRuntime).To(Equal(rt.Name))
+		Expect(*s.Spec.MinReplicas).To(Equal(min))
+		Expect(s.Spec.MaxReplicas).To(Equal(int32(4)))
+		Expect(s.Spec.Metrics).NotTo(BeEmpty())
+		Expect(s.Spec.Rollout).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("ModelRuntime webhook", func() {
+	It("admits a runtime with a kai-container", func() {
+		rt := &ModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "torchserve", Namespace: "default"},
+			Spec: ModelRuntimeSpec{
+				SupportedModelFormats: []ModelFormat{PytorchModelFormat},
+				Containers:            []corev1.Container{{Name: InferenceContainerName, Image: "torchserve"}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, rt)).To(Succeed())
+	})
+
+	It("rejects a runtime without a kai-container", func() {
+		rt := &ModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "unnamed", Namespace: "default"},
+			Spec: ModelRuntimeSpec{
+				SupportedModelFormats: []ModelFormat{PytorchModelFormat},
+				Containers:            []corev1.Container{{Name: "server", Image: "torchserve"}},
+			},
+		}
+		err := k8sClient.Create(ctx, rt)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(`a container named "kai-container"`))
+	})
+})
+
+var _ = Describe("Pipeline webhook", func() {
+	step := func(name string) *StepTemplateSpec {
+		return &StepTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       StepSpec{PodSpec: PodSpec{Containers: []corev1.Container{{Name: "echo", Image: "echo"}}}},
+		}
+	}
+
+	It("admits a pipeline of uniquely named steps", func() {
+		p := &Pipeline{
+			ObjectMeta: metav1.ObjectMeta{Name: "unique", Namespace: "default"},
+			Spec:       PipelineSpec{Steps: []*StepTemplateSpec{step("a"), step("b")}},
+		}
+		Expect(k8sClient.Create(ctx, p)).To(Succeed())
+	})
+
+	It("rejects duplicate step names", func() {
+		p := &Pipeline{
+			ObjectMeta: metav1.ObjectMeta{Name: "duplicate", Namespace: "default"},
+			Spec:       PipelineSpec{Steps: []*StepTemplateSpec{step("a"), step("a")}},
+		}
+		err := k8sClient.Create(ctx, p)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.steps[1].metadata.name"))
+	})
+
+	It("rejects updates making a step invalid", func() {
+		p := &Pipeline{
+			ObjectMeta: metav1.ObjectMeta{Name: "update", Namespace: "default"},
+			Spec:       PipelineSpec{Steps: []*StepTemplateSpec{step("a")}},
+		}
+		Expect(k8sClient.Create(ctx, p)).To(Succeed())
+
+		p.Spec.Steps[0].Spec.Containers = nil
+		err := k8sClient.Update(ctx, p)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.steps[0].spec"))
+	})
+})
@@ -0,0 +1,210 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dreamstax/kai/api/core/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// v1beta1 shares the wire format of v1alpha1 except for the fields renamed to fix the mistakes
+// of v1alpha1. Objects are converted through their JSON representation and the renamed fields
+// are copied over explicitly. The supportedModelFormats of model runtimes are structured in
+// v1beta1, they map to the modelFormats of v1alpha1.
+
+var (
+	_ conversion.Convertible = &Step{}
+	_ conversion.Convertible = &ModelRuntime{}
+	_ conversion.Convertible = &ClusterModelRuntime{}
+	_ conversion.Convertible = &Pipeline{}
+	_ conversion.Convertible = &PipelineRun{}
+	_ conversion.Convertible = &ScheduledPipelineRun{}
+)
+
+// ConvertTo converts this Step to the Hub version (v1alpha1).
+func (s *Step) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.Step)
+	if err := convert(s, dst); err != nil {
+		return err
+	}
+	if s.Spec.Model != nil {
+		dst.Spec.Model.ServiceAccountRef = s.Spec.Model.ServiceAccountRef
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (s *Step) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.Step)
+	if err := convert(src, s); err != nil {
+		return err
+	}
+	if src.Spec.Model != nil {
+		s.Spec.Model.ServiceAccountRef = src.Spec.Model.ServiceAccountRef
+	}
+	return nil
+}
+
+// ConvertTo converts this ModelRuntime to the Hub version (v1alpha1).
+func (rt *ModelRuntime) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.ModelRuntime)
+	src := rt.DeepCopy()
+	src.Spec.SupportedModelFormats = nil
+	if err := convert(src, dst); err != nil {
+		return err
+	}
+	dst.Spec.ModelFormats = hubModelFormats(rt.Spec.SupportedModelFormats)
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (rt *ModelRuntime) ConvertFrom(hub conversion.Hub) error {
+	hubRuntime := hub.(*v1alpha1.ModelRuntime)
+	src := hubRuntime.DeepCopy()
+	src.Spec.SupportedModelFormats, src.Spec.ModelFormats = nil, nil
+	if err := convert(src, rt); err != nil {
+		return err
+	}
+	rt.Spec.SupportedModelFormats = modelFormats(hubRuntime.Spec.GetModelFormats())
+	return nil
+}
+
+// ConvertTo converts this ClusterModelRuntime to the Hub version (v1alpha1).
+func (rt *ClusterModelRuntime) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.ClusterModelRuntime)
+	src := rt.DeepCopy()
+	src.Spec.SupportedModelFormats = nil
+	if err := convert(src, dst); err != nil {
+		return err
+	}
+	dst.Spec.ModelFormats = hubModelFormats(rt.Spec.SupportedModelFormats)
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (rt *ClusterModelRuntime) ConvertFrom(hub conversion.Hub) error {
+	hubRuntime := hub.(*v1alpha1.ClusterModelRuntime)
+	src := hubRuntime.DeepCopy()
+	src.Spec.SupportedModelFormats, src.Spec.ModelFormats = nil, nil
+	if err := convert(src, rt); err != nil {
+		return err
+	}
+	rt.Spec.SupportedModelFormats = modelFormats(hubRuntime.Spec.GetModelFormats())
+	return nil
+}
+
+// ConvertTo converts this Pipeline to the Hub version (v1alpha1).
+func (p *Pipeline) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.Pipeline)
+	if err := convert(p, dst); err != nil {
+		return err
+	}
+	for i, s := range p.Spec.Steps {
+		if s != nil && s.Spec.Model != nil {
+			dst.Spec.Steps[i].Spec.Model.ServiceAccountRef = s.Spec.Model.ServiceAccountRef
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (p *Pipeline) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.Pipeline)
+	if err := convert(src, p); err != nil {
+		return err
+	}
+	for i, s := range src.Spec.Steps {
+		if s != nil && s.Spec.Model != nil {
+			p.Spec.Steps[i].Spec.Model.ServiceAccountRef = s.Spec.Model.ServiceAccountRef
+		}
+	}
+	return nil
+}
+
+// ConvertTo converts this PipelineRun to the Hub version (v1alpha1).
+func (r *PipelineRun) ConvertTo(hub conversion.Hub) error {
+	return convert(r, hub.(*v1alpha1.PipelineRun))
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (r *PipelineRun) ConvertFrom(hub conversion.Hub) error {
+	return convert(hub.(*v1alpha1.PipelineRun), r)
+}
+
+// ConvertTo converts this ScheduledPipelineRun to the Hub version (v1alpha1).
+func (r *ScheduledPipelineRun) ConvertTo(hub conversion.Hub) error {
+	return convert(r, hub.(*v1alpha1.ScheduledPipelineRun))
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (r *ScheduledPipelineRun) ConvertFrom(hub conversion.Hub) error {
+	return convert(hub.(*v1alpha1.ScheduledPipelineRun), r)
+}
+
+// hubModelFormats converts the structured formats of a runtime to the v1alpha1 modelFormats, the
+// deprecated v1alpha1 supportedModelFormats are converted to structured formats in v1beta1.
+func hubModelFormats(formats []SupportedModelFormat) []v1alpha1.SupportedModelFormat {
+	if formats == nil {
+		return nil
+	}
+	out := make([]v1alpha1.SupportedModelFormat, len(formats))
+	for i, f := range formats {
+		out[i] = v1alpha1.SupportedModelFormat{
+			Name:       v1alpha1.ModelFormat(f.Name),
+			Version:    f.Version,
+			AutoSelect: f.AutoSelect,
+			Priority:   f.Priority,
+		}
+	}
+	return out
+}
+
+func modelFormats(formats []v1alpha1.SupportedModelFormat) []SupportedModelFormat {
+	if len(formats) == 0 {
+		return nil
+	}
+	out := make([]SupportedModelFormat, len(formats))
+	for i, f := range formats {
+		out[i] = SupportedModelFormat{
+			Name:       ModelFormat(f.Name),
+			Version:    f.Version,
+			AutoSelect: f.AutoSelect,
+			Priority:   f.Priority,
+		}
+	}
+	return out
+}
+
+// convert copies src into dst through JSON, keeping the apiVersion and kind of dst.
+func convert(src, dst runtime.Object) error {
+	gvk := dst.GetObjectKind().GroupVersionKind()
+
+	data, err := json.Marshal(src)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %T: %w", src, err)
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("failed to unmarshal %T: %w", dst, err)
+	}
+
+	dst.GetObjectKind().SetGroupVersionKind(gvk)
+	return nil
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dreamstax/kai/api/core/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStepConversion(t *testing.T) {
+	s := &Step{
+		TypeMeta:   metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "Step"},
+		ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "default", Labels: map[string]string{"team": "vision"}},
+		Spec: StepSpec{
+			Model: &ModelSpec{
+				ModelFormat:       PytorchModelFormat,
+				URI:               "gs://models/resnet",
+				ServiceAccountRef: "model-reader",
+			},
+		},
+		Status: StepStatus{URL: "http://classifier.default.svc.cluster.local"},
+	}
+
+	hub := &v1alpha1.Step{TypeMeta: metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "Step"}}
+	if err := s.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if hub.APIVersion != v1alpha1.GroupVersion.String() {
+		t.Errorf("expected apiVersion %s, got %s", v1alpha1.GroupVersion, hub.APIVersion)
+	}
+	if hub.Spec.Model.ServiceAccountRef != "model-reader" {
+		t.Errorf("expected service account ref to be converted, got %q", hub.Spec.Model.ServiceAccountRef)
+	}
+	if hub.Status.URL != s.Status.URL || hub.Labels["team"] != "vision" {
+		t.Errorf("expected metadata and status to be converted, got %v", hub)
+	}
+
+	out := &Step{TypeMeta: metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "Step"}}
+	if err := out.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if !equality.Semantic.DeepEqual(s, out) {
+		t.Errorf("expected step to survive a round trip, got %v", out)
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"serviceAccountRef":"model-reader"`) {
+		t.Errorf("expected serviceAccountRef in %s", data)
+	}
+}
+
+func TestPipelineConversion(t *testing.T) {
+	hub := &v1alpha1.Pipeline{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "Pipeline"},
+		ObjectMeta: metav1.ObjectMeta{Name: "image-classifier", Namespace: "default"},
+		Spec: v1alpha1.PipelineSpec{
+			Steps: []*v1alpha1.StepTemplateSpec{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "classifier"},
+					Spec: v1alpha1.StepSpec{
+						Model: &v1alpha1.ModelSpec{
+							ModelFormat:       v1alpha1.PytorchModelFormat,
+							URI:               "gs://models/resnet",
+							ServiceAccountRef: "model-reader",
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "postprocess"},
+					Spec: v1alpha1.StepSpec{
+						PodSpec: v1alpha1.PodSpec{Containers: []corev1.Container{{Name: "server", Image: "postprocess"}}},
+					},
+					DependsOn: []string{"classifier"},
+				},
+			},
+		},
+	}
+
+	p := &Pipeline{TypeMeta: metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "Pipeline"}}
+	if err := p.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if p.APIVersion != GroupVersion.String() {
+		t.Errorf("expected apiVersion %s, got %s", GroupVersion, p.APIVersion)
+	}
+	if len(p.Spec.Steps) != 2 || p.Spec.Steps[0].Spec.Model.ServiceAccountRef != "model-reader" {
+		t.Fatalf("expected steps to be converted, got %v", p.Spec.Steps)
+	}
+	if p.Spec.Steps[1].DependsOn[0] != "classifier" {
+		t.Errorf("expected dependencies to be converted, got %v", p.Spec.Steps[1])
+	}
+
+	out := &v1alpha1.Pipeline{TypeMeta: metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "Pipeline"}}
+	if err := p.ConvertTo(out); err != nil {
+		t.Fatal(err)
+	}
+	if !equality.Semantic.DeepEqual(hub, out) {
+		t.Errorf("expected pipeline to survive a round trip, got %v", out)
+	}
+}
+
+func TestPipelineRunConversion(t *testing.T) {
+	r := &PipelineRun{
+		TypeMeta:   metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "PipelineRun"},
+		ObjectMeta: metav1.ObjectMeta{Name: "image-classifier-run", Namespace: "default"},
+		Spec: PipelineRunSpec{
+			PipelineRef: corev1.LocalObjectReference{Name: "image-classifier"},
+		},
+	}
+
+	hub := &v1alpha1.PipelineRun{TypeMeta: metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "PipelineRun"}}
+	if err := r.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &PipelineRun{TypeMeta: metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "PipelineRun"}}
+	if err := out.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if !equality.Semantic.DeepEqual(r, out) {
+		t.Errorf("expected pipeline run to survive a round trip, got %v", out)
+	}
+}
+
+func TestModelRuntimeConversion(t *testing.T) {
+	version, priority := "2", int32(10)
+	hub := &v1alpha1.ModelRuntime{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "ModelRuntime"},
+		ObjectMeta: metav1.ObjectMeta{Name: "torchserve", Namespace: "default"},
+		Spec: v1alpha1.ModelRuntimeSpec{
+			SupportedModelFormats: []v1alpha1.ModelFormat{"onnx"},
+			ModelFormats: []v1alpha1.SupportedModelFormat{
+				{Name: v1alpha1.PytorchModelFormat, Version: &version, Priority: &priority},
+			},
+			Containers: []corev1.Container{{Name: v1alpha1.InferenceContainerName, Image: "pytorch/torchserve"}},
+		},
+	}
+
+	rt := &ModelRuntime{TypeMeta: metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "ModelRuntime"}}
+	if err := rt.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	want := []SupportedModelFormat{
+		{Name: "onnx"},
+		{Name: PytorchModelFormat, Version: &version, Priority: &priority},
+	}
+	if !equality.Semantic.DeepEqual(rt.Spec.SupportedModelFormats, want) {
+		t.Errorf("expected formats %v, got %v", want, rt.Spec.SupportedModelFormats)
+	}
+	if rt.Spec.Containers[0].Image != "pytorch/torchserve" {
+		t.Errorf("expected containers to be converted, got %v", rt.Spec.Containers)
+	}
+
+	// the deprecated formats of v1alpha1 come back as structured formats
+	out := &v1alpha1.ModelRuntime{TypeMeta: metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "ModelRuntime"}}
+	if err := rt.ConvertTo(out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Spec.SupportedModelFormats) != 0 {
+		t.Errorf("expected no deprecated formats, got %v", out.Spec.SupportedModelFormats)
+	}
+	if !equality.Semantic.DeepEqual(out.Spec.GetModelFormats(), hub.Spec.GetModelFormats()) {
+		t.Errorf("expected formats %v, got %v", hub.Spec.GetModelFormats(), out.Spec.GetModelFormats())
+	}
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type PipelineSpec struct {
+	// Steps represent the list of individual units of work to be run as part of a pipeline definition
+	// +required
+	Steps []*StepTemplateSpec `json:"steps"`
+
+	// StepRetentionPolicy determines what happens to steps removed from the pipeline.
+	// Delete removes the step and all of its resources, Retain keeps the step running until
+	// the pipeline itself is deleted. Defaults to Delete.
+	// +kubebuilder:default=Delete
+	// +optional
+	StepRetentionPolicy StepRetentionPolicy `json:"stepRetentionPolicy,omitempty"`
+
+	// Parameters declared by the pipeline. Steps reference parameters as $(params.<name>) in
+	// any string field of their spec, stepRef or endpoint.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Parameters []PipelineParameter `json:"parameters,omitempty"`
+
+	// Defaults are shared by all steps created by the pipeline. Values set on a step take
+	// precedence over the defaults.
+	// +optional
+	Defaults *StepDefaults `json:"defaults,omitempty"`
+
+	// RevisionHistoryLimit is the number of previous revisions of the pipeline kept for rollback.
+	// Defaults to 10.
+	// +kubebuilder:default=10
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// RollbackTo restores the steps of a previous revision of the pipeline. The controller
+	// replaces the spec with the one recorded by the revision and clears the field.
+	// +optional
+	RollbackTo *PipelineRollback `json:"rollbackTo,omitempty"`
+}
+
+// PipelineRollback identifies the revision a pipeline is rolled back to.
+type PipelineRollback struct {
+	// Revision is the number of the revision to restore, as recorded in the status of the
+	// pipeline. When 0 the pipeline is rolled back to the previous revision.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Revision int64 `json:"revision,omitempty"`
+}
+
+// PipelineParameter is a value substituted into the steps of a pipeline.
+type PipelineParameter struct {
+	// Name of the parameter, referenced from steps as $(params.<name>).
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z_][a-zA-Z0-9_-]*$`
+	// +required
+	Name string `json:"name"`
+
+	// Type of the parameter, values are validated against it. Defaults to string.
+	// +kubebuilder:default=string
+	// +optional
+	Type ParameterType `json:"type,omitempty"`
+
+	// Description of the parameter.
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// Default is used when no value is given. Parameters without a default require a value.
+	// +optional
+	Default *string `json:"default,omitempty"`
+
+	// Value of the parameter.
+	// +optional
+	Value *string `json:"value,omitempty"`
+}
+
+// ParameterType describes the values a parameter accepts.
+// +kubebuilder:validation:Enum=string;integer;boolean
+type ParameterType string
+
+const (
+	ParameterTypeString  ParameterType = "string"
+	ParameterTypeInteger ParameterType = "integer"
+	ParameterTypeBoolean ParameterType = "boolean"
+)
+
+// StepDefaults are pod settings shared by the steps of a pipeline.
+type StepDefaults struct {
+	// Env is added to each container of a step unless the container sets a variable of the same name.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// NodeSelector is merged into the node selector of each step, keys set by the step win.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations are added to the tolerations of each step.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// ImagePullSecrets are added to each step unless the step references a secret of the same name.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// Volumes are added to each step unless the step declares a volume of the same name.
+	// +optional
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+
+	// ServiceAccountName is used by steps which don't set a service account.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+}
+
+// StepRetentionPolicy describes how steps removed from a pipeline are handled.
+// +kubebuilder:validation:Enum=Delete;Retain
+type StepRetentionPolicy string
+
+const (
+	// StepRetentionPolicyDelete deletes steps as soon as they are removed from the pipeline.
+	StepRetentionPolicyDelete StepRetentionPolicy = "Delete"
+
+	// StepRetentionPolicyRetain keeps removed steps until the pipeline is deleted.
+	StepRetentionPolicyRetain StepRetentionPolicy = "Retain"
+)
+
+// PipelineStatus defines the observed state of Pipeline
+type PipelineStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+
+	// ObservedGeneration is the most recent generation of the pipeline reconciled by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Topology is the resolved graph of the pipeline's steps in topological order.
+	// +optional
+	Topology []StepTopology `json:"topology,omitempty"`
+
+	// Steps summarizes the observed state of each step in the pipeline.
+	// +optional
+	Steps []PipelineStepStatus `json:"steps,omitempty"`
+
+	// Piper reports the registration of the pipeline with kai-piper.
+	// +optional
+	Piper *PiperStatus `json:"piper,omitempty"`
+
+	// CurrentRevision is the revision matching the current spec of the pipeline.
+	// +optional
+	CurrentRevision *PipelineRevisionStatus `json:"currentRevision,omitempty"`
+
+	// PreviousRevision is the revision the pipeline ran before the current one, the target of
+	// a rollback when no revision is given.
+	// +optional
+	PreviousRevision *PipelineRevisionStatus `json:"previousRevision,omitempty"`
+}
+
+// PipelineRevisionStatus identifies an immutable snapshot of the spec of a pipeline.
+type PipelineRevisionStatus struct {
+	// Name of the ControllerRevision storing the spec.
+	Name string `json:"name"`
+
+	// Revision is the sequence number of the revision, increasing with each change to the spec.
+	Revision int64 `json:"revision"`
+}
+
+// PiperStatus describes the pipeline definition registered with kai-piper.
+type PiperStatus struct {
+	// PipelineID is the ID of the pipeline within kai-piper, used to run the pipeline.
+	// +optional
+	PipelineID string `json:"pipelineID,omitempty"`
+
+	// DefinitionHash is the hash of the definition last registered with kai-piper.
+	// +optional
+	DefinitionHash string `json:"definitionHash,omitempty"`
+}
+
+// PipelineStepStatus summarizes the observed state of a single step within the pipeline.
+type PipelineStepStatus struct {
+	// Name of the step within the pipeline.
+	Name string `json:"name"`
+
+	// StepName is the name of the Step resource backing the step, unset for endpoints.
+	// +optional
+	StepName string `json:"stepName,omitempty"`
+
+	// StepNamespace is the namespace of the Step resource backing the step when it is
+	// referenced from another namespace than the pipeline's.
+	// +optional
+	StepNamespace string `json:"stepNamespace,omitempty"`
+
+	// Ready indicates whether the step is able to serve requests.
+	Ready bool `json:"ready"`
+
+	// Replicas is the number of ready pods serving the step.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// URL is the in-cluster address of the step.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// LastError is the reason the step is not ready, if known.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// StepTopology describes the position of a single step within the pipeline graph.
+type StepTopology struct {
+	// Name of the step within the pipeline.
+	Name string `json:"name"`
+
+	// DependsOn lists the steps that must run before this step.
+	// +optional
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// Level is the depth of the step within the graph. Entrypoint steps are at level 0 and
+	// steps sharing a level have no dependencies on one another.
+	Level int32 `json:"level"`
+}
+
+// Pipeline condition types
+const (
+	// PipelineConditionReady indicates whether all steps of the pipeline are ready.
+	PipelineConditionReady = "Ready"
+
+	// PipelineConditionTopologyResolved indicates whether the step graph of the pipeline is valid.
+	PipelineConditionTopologyResolved = "TopologyResolved"
+
+	// PipelineConditionParametersResolved indicates whether all parameters referenced by the steps
+	// of the pipeline have valid values.
+	PipelineConditionParametersResolved = "ParametersResolved"
+
+	// PipelineConditionRegistered indicates whether the pipeline definition is registered with kai-piper.
+	PipelineConditionRegistered = "Registered"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+//+kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].reason"
+//+kubebuilder:printcolumn:name="Revision",type="integer",JSONPath=".status.currentRevision.revision"
+//+kubebuilder:printcolumn:name="Piper ID",type="string",JSONPath=".status.piper.pipelineID",priority=1
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Pipeline is the Schema for the pipelines API
+type Pipeline struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PipelineSpec   `json:"spec,omitempty"`
+	Status PipelineStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PipelineList contains a list of Pipeline
+type PipelineList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Pipeline `json:"items"`
+}
+
+func (p *Pipeline) GetGroupVersionKind() schema.GroupVersionKind {
+	return p.GroupVersionKind()
+}
+
+func (p *Pipeline) NamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: p.Namespace,
+		Name:      p.Name,
+	}
+}
+
+func init() {
+	SchemeBuilder.Register(&Pipeline{}, &PipelineList{})
+}
@@ -0,0 +1,417 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	autoscaling "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// StepTemplateSpec is a wrapper for resources embedding a StepSpec. This strategy is borrowed
+// from k8s core (PodTemplate) and other popular projects like knative
+type StepTemplateSpec struct {
+	// Name within the metadata identifies the step within a pipeline and is used to name the
+	// resulting Step. When unset the index of the step within the pipeline is used instead.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +optional
+	Spec StepSpec `json:"spec,omitempty"`
+
+	// DependsOn lists the names of other steps within the same pipeline whose output this step
+	// consumes. Together these references form a directed acyclic graph of the pipeline.
+	// Steps without dependencies are entrypoints to the pipeline.
+	// +listType=set
+	// +optional
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// StepRef references an existing Step to use instead of creating one from Spec. The
+	// referenced step is not managed by the pipeline. Mutually exclusive with Endpoint.
+	// +optional
+	StepRef *StepReference `json:"stepRef,omitempty"`
+
+	// Endpoint references a model server running outside of kai to use instead of creating a
+	// step from Spec. Mutually exclusive with StepRef.
+	// +optional
+	Endpoint *EndpointReference `json:"endpoint,omitempty"`
+
+	// ParamRefs sets fields of the spec of the step to the value of a parameter of the pipeline,
+	// keyed by the path of the field within the spec such as minReplicas or
+	// rollout.progressDeadlineSeconds. Unlike $(params.<name>) references within strings,
+	// integer and boolean parameters keep their type so they can set numeric and boolean fields.
+	// +optional
+	ParamRefs map[string]string `json:"paramRefs,omitempty"`
+}
+
+// StepReference identifies an existing Step.
+type StepReference struct {
+	// Name of the step.
+	// +required
+	Name string `json:"name"`
+
+	// Namespace of the step, defaults to the namespace of the pipeline.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// EndpointReference identifies a model server by its URL or by the Service in front of it.
+// Exactly one of URL and Service must be set.
+type EndpointReference struct {
+	// URL of the model server.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Service in front of the model server.
+	// +optional
+	Service *ServiceReference `json:"service,omitempty"`
+}
+
+// ServiceReference identifies a port of a Service.
+type ServiceReference struct {
+	// Name of the service.
+	// +required
+	Name string `json:"name"`
+
+	// Namespace of the service, defaults to the namespace of the pipeline.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Port of the service to send requests to, defaults to the first port of the service.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+}
+
+// StepSpec defines the desired state of Step
+type StepSpec struct {
+	// PodSpec can be used to define a standalone Pod for use within a step. Additionally
+	// When Model is also provided it serves as means to override values set within the modelRuntime.
+	PodSpec `json:",inline"`
+
+	// +optional
+	Model *ModelSpec `json:"model,omitempty"`
+
+	// Env is added to each container of the step unless the container sets a variable of the
+	// same name, including the containers of the model runtime of the step.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// minReplicas is the lower limit for the number of replicas to which the autoscaler
+	// can scale down.  It defaults to 1 pod.  minReplicas is allowed to be 0 if the
+	// alpha feature gate HPAScaleToZero is enabled and at least one Object or External
+	// metric is configured.  Scaling is active as long as at least one metric value is
+	// available.
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// maxReplicas is the upper limit for the number of replicas to which the autoscaler can scale up.
+	// It cannot be less that minReplicas.
+	// +optional
+	MaxReplicas int32 `json:"maxReplicas"`
+	// metrics contains the specifications for which to use to calculate the
+	// desired replica count (the maximum replica count across all metrics will
+	// be used).  The desired replica count is calculated multiplying the
+	// ratio between the target value and the current value by the current
+	// number of pods.  Ergo, metrics used must decrease as the pod count is
+	// increased, and vice-versa.  See the individual metric source types for
+	// more information about how each type of metric must respond.
+	// If not set, the default metric will be set to 80% average CPU utilization.
+	// +listType=atomic
+	// +optional
+	Metrics []autoscaling.MetricSpec `json:"metrics,omitempty"`
+
+	// behavior configures the scaling behavior of the target
+	// in both Up and Down directions (scaleUp and scaleDown fields respectively).
+	// If not set, the default HPAScalingRules for scale up and scale down are used.
+	// +optional
+	Behavior *autoscaling.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+
+	// Rollout configures how pods of the step are replaced when the step changes.
+	// +optional
+	Rollout *StepRollout `json:"rollout,omitempty"`
+
+	// Traffic splits requests to the step between its revisions. Each change to the pods of
+	// the step creates a new revision, pinning traffic to an earlier revision keeps it running
+	// alongside the latest one. Requests are balanced across the pods of the revisions, so the
+	// percentages are approximated by scaling the pinned revisions relative to the latest one.
+	// Every revision receiving traffic runs at least one pod, with few replicas small shares
+	// receive more than requested. The effective split is reported in the status of the step.
+	// When empty all traffic is sent to the latest revision.
+	// +listType=atomic
+	// +optional
+	Traffic []TrafficTarget `json:"traffic,omitempty"`
+
+	// RevisionHistoryLimit is the number of previous revisions of the step kept for pinning
+	// traffic to, besides the latest revision and those receiving traffic. Defaults to 10.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// Adopt takes over an existing Deployment and/or Service in the namespace of the step
+	// instead of creating new ones. Adopted resources are owned and managed by the step from
+	// then on and are deleted with it. Pods of an adopted deployment keep running until the
+	// spec of the step changes them.
+	// +optional
+	Adopt *StepAdoption `json:"adopt,omitempty"`
+}
+
+// StepRollout configures the rolling update of the pods of a step.
+type StepRollout struct {
+	// ProgressDeadlineSeconds is the number of seconds a rollout may take to make progress
+	// before the step reports it as failed. Defaults to 60.
+	// +optional
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
+
+	// MaxUnavailable is the number or percentage of pods that can be unavailable during a
+	// rollout. Defaults to 0 so a step keeps serving at full capacity while it rolls out.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// MaxSurge is the number or percentage of pods that can be created above the desired
+	// number of pods during a rollout. Defaults to 25%.
+	// +optional
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+}
+
+// StepAdoption names the existing resources adopted by a step.
+type StepAdoption struct {
+	// Deployment is the name of the deployment to adopt.
+	// +optional
+	Deployment string `json:"deployment,omitempty"`
+
+	// Service is the name of the service to adopt.
+	// +optional
+	Service string `json:"service,omitempty"`
+}
+
+// TrafficTarget routes a percentage of the requests to a step to one of its revisions.
+type TrafficTarget struct {
+	// RevisionName is the name of the revision receiving the traffic, as reported in the
+	// status of the step. Mutually exclusive with LatestRevision.
+	// +optional
+	RevisionName string `json:"revisionName,omitempty"`
+
+	// LatestRevision sends the traffic to the latest revision of the step, following it as
+	// the step changes. Mutually exclusive with RevisionName.
+	// +optional
+	LatestRevision *bool `json:"latestRevision,omitempty"`
+
+	// Percent of requests sent to the revision. The percentages of all targets must add up to 100.
+	// The split is approximated by the replicas of the revisions, see Traffic.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Percent int64 `json:"percent"`
+}
+
+type ModelSpec struct {
+	// ModelFormat specifies the type of of the model e.g.; pytorch, onnx
+	// +required
+	ModelFormat ModelFormat `json:"modelFormat,omitempty"`
+
+	// ModelFormatVersion is the version of the model format, runtimes which don't support it
+	// are not selected for the step.
+	// +optional
+	ModelFormatVersion string `json:"modelFormatVersion,omitempty"`
+
+	// +required
+	URI string `json:"uri,omitempty"`
+
+	// optionally set a modelRuntime - if modelRuntime is specified the inferenceContainer
+	// specified within it will be used regardless of modelFormat see ModelRuntime for more info.
+	// The name refers to a ModelRuntime in the namespace of the step, or else to a ClusterModelRuntime.
+	// +optional
+	ModelRuntime string `json:"modelRuntime,omitempty"`
+
+	// ArgsPolicy controls how the args of a step container are combined with the args of the
+	// runtime container of the same name. Other fields of the step container are merged onto
+	// the runtime container, env by name and resources by resource name.
+	// +kubebuilder:validation:Enum=Append;Replace
+	// +optional
+	ArgsPolicy ArgsPolicy `json:"argsPolicy,omitempty"`
+
+	// ServiceAccountRef names the service account whose credentials are used to download the model.
+	// +optional
+	ServiceAccountRef string `json:"serviceAccountRef,omitempty"`
+}
+
+// ArgsPolicy controls how the args of step containers are combined with runtime containers.
+type ArgsPolicy string
+
+const (
+	// ArgsPolicyAppend appends the args of the step container to the args of the runtime
+	// container. This is the default.
+	ArgsPolicyAppend ArgsPolicy = "Append"
+	// ArgsPolicyReplace replaces the args of the runtime container when the step container
+	// sets args.
+	ArgsPolicyReplace ArgsPolicy = "Replace"
+)
+
+type ModelFormat string
+
+// supported model formats
+const (
+	PytorchModelFormat     ModelFormat = "pytorch"
+	OnnxModelFormat        ModelFormat = "onnx"
+	TensorflowModelFormat  ModelFormat = "tensorflow"
+	SklearnModelFormat     ModelFormat = "sklearn"
+	XGBoostModelFormat     ModelFormat = "xgboost"
+	LightGBMModelFormat    ModelFormat = "lightgbm"
+	TritonModelFormat      ModelFormat = "triton"
+	HuggingFaceModelFormat ModelFormat = "huggingface"
+)
+
+// StepStatus defines the observed state of Step
+type StepStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+
+	// ObservedGeneration is the most recent generation of the step reconciled by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Replicas is the number of ready pods serving the step.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// DesiredReplicas is the number of pods the step is currently scaled to.
+	// +optional
+	DesiredReplicas int32 `json:"desiredReplicas,omitempty"`
+
+	// URL is the in-cluster address of the step's service.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// LatestRevision is the name of the revision matching the current spec of the step.
+	// +optional
+	LatestRevision string `json:"latestRevision,omitempty"`
+
+	// Traffic reports how requests to the step are split between its revisions.
+	// +optional
+	Traffic []TrafficTargetStatus `json:"traffic,omitempty"`
+
+	// ModelRuntime reports the model runtime serving the model of the step.
+	// +optional
+	ModelRuntime *ModelRuntimeSelection `json:"modelRuntime,omitempty"`
+}
+
+// reasons a model runtime was selected for a step
+const (
+	// ModelRuntimeReasonRequested is reported when the step names the model runtime.
+	ModelRuntimeReasonRequested = "Requested"
+	// ModelRuntimeReasonAutoSelected is reported when the runtime was selected for the model format.
+	ModelRuntimeReasonAutoSelected = "AutoSelected"
+)
+
+// ModelRuntimeSelection reports the model runtime selected for a step and why it was selected.
+type ModelRuntimeSelection struct {
+	// Kind is either ModelRuntime or ClusterModelRuntime.
+	Kind string `json:"kind"`
+
+	// Name of the model runtime.
+	Name string `json:"name"`
+
+	// Reason is a CamelCase reason the runtime was selected.
+	Reason string `json:"reason"`
+
+	// Message is a human readable explanation of the selection.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// TrafficTargetStatus reports the share of traffic sent to a revision of the step.
+type TrafficTargetStatus struct {
+	// RevisionName is the name of the revision receiving the traffic.
+	RevisionName string `json:"revisionName"`
+
+	// LatestRevision indicates whether the target follows the latest revision.
+	// +optional
+	LatestRevision bool `json:"latestRevision,omitempty"`
+
+	// Percent of requests sent to the revision.
+	Percent int64 `json:"percent"`
+
+	// EffectivePercent is the share of requests the revision receives given its ready pods,
+	// which approximates Percent more closely as the step scales.
+	// +optional
+	EffectivePercent int64 `json:"effectivePercent,omitempty"`
+
+	// Replicas is the number of ready pods of the revision.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+}
+
+// Step condition types
+const (
+	// StepConditionReady indicates whether the step is able to serve requests. It is true
+	// when both the deployment and service of the step are ready.
+	StepConditionReady = "Ready"
+
+	// StepConditionDeploymentReady indicates whether the step's deployment has rolled out
+	// and its pods are available.
+	StepConditionDeploymentReady = "DeploymentReady"
+
+	// StepConditionServiceReady indicates whether the step's service is able to route traffic.
+	StepConditionServiceReady = "ServiceReady"
+
+	// StepConditionScalingActive indicates whether the step's autoscaler is able to scale
+	// the step. This condition does not affect the readiness of the step.
+	StepConditionScalingActive = "ScalingActive"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+//+kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].reason"
+//+kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas"
+//+kubebuilder:printcolumn:name="URL",type="string",JSONPath=".status.url"
+//+kubebuilder:printcolumn:name="Latest Revision",type="string",JSONPath=".status.latestRevision",priority=1
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Step is the Schema for the steps API
+type Step struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   StepSpec   `json:"spec,omitempty"`
+	Status StepStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// StepList contains a list of Step
+type StepList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Step `json:"items"`
+}
+
+func (s *Step) GetGroupVersionKind() schema.GroupVersionKind {
+	return s.GroupVersionKind()
+}
+
+func (s *Step) NamespacedName() types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: s.Namespace,
+		Name:      s.Name,
+	}
+}
+
+func init() {
+	SchemeBuilder.Register(&Step{}, &StepList{})
+}
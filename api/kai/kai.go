@@ -14,4 +14,37 @@ const (
 
 	// PipelineUIDLabelKey is the label key attached to k8s resources to indicate which pipeline triggerd their creation
 	PipelineUIDLabelKey = GroupName + "/pipelineUID"
+
+	// PipelineStepLabelKey is the label key attached to steps to indicate their name within the pipeline that created them.
+	PipelineStepLabelKey = GroupName + "/pipelineStep"
+
+	// StepRevisionLabelKey is the label key attached to the pods of a step to indicate the revision of the step they run.
+	StepRevisionLabelKey = GroupName + "/stepRevision"
+
+	// PinnedRevisionLabelKey is the label key attached to the pods of a step to indicate whether they run a revision pinned by the traffic of the step rather than the latest revision.
+	PinnedRevisionLabelKey = GroupName + "/pinnedRevision"
+
+	// RevisionHashLabelKey is the label key attached to pipeline and step revisions to record the hash of the spec they snapshot.
+	RevisionHashLabelKey = GroupName + "/revisionHash"
+
+	// ScheduledPipelineRunLabelKey is the label key attached to pipeline runs to indicate which scheduled run created them.
+	ScheduledPipelineRunLabelKey = GroupName + "/scheduledPipelineRun"
+
+	// ScheduledPipelineRunUIDLabelKey is the label key attached to pipeline runs to indicate which scheduled run created them.
+	ScheduledPipelineRunUIDLabelKey = GroupName + "/scheduledPipelineRunUID"
+
+	// ScheduledTimeAnnotationKey is the annotation attached to pipeline runs created on a schedule recording the time they were scheduled for.
+	ScheduledTimeAnnotationKey = GroupName + "/scheduledTime"
+
+	// SharedNamespacesAnnotationKey is the annotation attached to steps and services to allow pipelines in other namespaces to reference them, its value is a comma separated list of namespaces or "*" for all namespaces.
+	SharedNamespacesAnnotationKey = GroupName + "/sharedNamespaces"
+
+	// PiperFinalizer is the finalizer attached to pipelines registered with kai-piper so they can be deregistered on delete.
+	PiperFinalizer = GroupName + "/piper"
+
+	// ModelRuntimeFinalizer is the finalizer attached to model runtimes so they aren't deleted while they serve steps.
+	ModelRuntimeFinalizer = GroupName + "/modelruntime-protection"
+
+	// CatalogHashAnnotationKey is the annotation attached to the cluster model runtimes installed from the built-in catalog to record the hash of the spec they were installed with.
+	CatalogHashAnnotationKey = GroupName + "/catalogHash"
 )
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 
@@ -24,16 +25,28 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	corev1beta1 "github.com/dreamstax/kai/api/core/v1beta1"
+	"github.com/dreamstax/kai/api/kai"
 	corecontroller "github.com/dreamstax/kai/internal/controller/core"
+	"github.com/dreamstax/kai/internal/modelruntime/catalog"
+	"github.com/dreamstax/kai/internal/piper"
+	stepdefaults "github.com/dreamstax/kai/internal/step/defaults"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -46,6 +59,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(corev1alpha1.AddToScheme(scheme))
+	utilruntime.Must(corev1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -53,11 +67,19 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var piperAddr string
+	var installModelRuntimes bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&piperAddr, "piper-address", "",
+		"The address of the kai-piper server pipelines are registered with. "+
+			"Leave empty to disable the integration with kai-piper.")
+	flag.BoolVar(&installModelRuntimes, "install-model-runtimes", false,
+		"Install the built-in cluster model runtimes on startup and keep them up to date. "+
+			"Runtimes modified by users are left alone.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -66,8 +88,29 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	// steps watch pods to report failures and clean up the replica sets of replaced deployments,
+	// only cache the pods and replica sets created for steps
+	stepPods, err := labels.NewRequirement(kai.StepUIDLabelKey, selection.Exists, nil)
+	if err != nil {
+		setupLog.Error(err, "unable to create pod selector")
+		os.Exit(1)
+	}
+	// pipelines and steps snapshot their spec into controller revisions, ignore those of other workloads
+	kaiRevisions, err := labels.NewRequirement(kai.RevisionHashLabelKey, selection.Exists, nil)
+	if err != nil {
+		setupLog.Error(err, "unable to create revision selector")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
+		Scheme: scheme,
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.Pod{}:                {Label: labels.NewSelector().Add(*stepPods)},
+				&appsv1.ReplicaSet{}:         {Label: labels.NewSelector().Add(*stepPods)},
+				&appsv1.ControllerRevision{}: {Label: labels.NewSelector().Add(*kaiRevisions)},
+			},
+		},
 		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
@@ -96,15 +139,91 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "Step")
 		os.Exit(1)
 	}
+	if err = (&corecontroller.ModelRuntimeReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ModelRuntime")
+		os.Exit(1)
+	}
+	if err = (&corecontroller.ClusterModelRuntimeReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterModelRuntime")
+		os.Exit(1)
+	}
+	var piperc *piper.Client
+	if piperAddr != "" {
+		piperc, err = piper.New(piperAddr)
+		if err != nil {
+			setupLog.Error(err, "unable to create piper client")
+			os.Exit(1)
+		}
+	}
 	if err = (&corecontroller.PipelineReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
+		Piper:  piperc,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Pipeline")
 		os.Exit(1)
 	}
+	if err = (&corecontroller.PipelineRunReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Piper:  piperc,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PipelineRun")
+		os.Exit(1)
+	}
+	if err = (&corecontroller.ScheduledPipelineRunReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ScheduledPipelineRun")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&corev1alpha1.Step{}).SetupWebhookWithManager(mgr, stepdefaults.New(mgr.GetClient())); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Step")
+			os.Exit(1)
+		}
+		if err = (&corev1alpha1.ModelRuntime{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ModelRuntime")
+			os.Exit(1)
+		}
+		if err = (&corev1alpha1.ClusterModelRuntime{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterModelRuntime")
+			os.Exit(1)
+		}
+		if err = (&corev1alpha1.Pipeline{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Pipeline")
+			os.Exit(1)
+		}
+		if err = (&corev1alpha1.PipelineRun{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PipelineRun")
+			os.Exit(1)
+		}
+		if err = (&corev1alpha1.ScheduledPipelineRun{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ScheduledPipelineRun")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
+	if installModelRuntimes {
+		// installed once elected, after the caches are started. The webhooks may not be reachable
+		// yet on the first deploy so installing is retried until it succeeds.
+		err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			return catalog.InstallWithRetry(ctx, mgr.GetClient())
+		}))
+		if err != nil {
+			setupLog.Error(err, "unable to add model runtime catalog")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -0,0 +1,62 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/modelruntime"
+	stepruntime "github.com/dreamstax/kai/internal/step/modelruntime"
+)
+
+// ClusterModelRuntimeReconciler reconciles a ClusterModelRuntime object
+type ClusterModelRuntimeReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	rtc    *modelruntime.Client
+}
+
+// create is needed by the manager to install the catalog of cluster model runtimes
+//+kubebuilder:rbac:groups=core.kai.io,resources=clustermodelruntimes,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=core.kai.io,resources=clustermodelruntimes/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=core.kai.io,resources=clustermodelruntimes/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core.kai.io,resources=steps,verbs=get;list;watch
+
+func (r *ClusterModelRuntimeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.rtc.ReconcileClusterModelRuntime(ctx, req)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterModelRuntimeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.rtc = modelruntime.New(r.Client)
+
+	if err := indexStepsByModelRuntime(mgr); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1alpha1.ClusterModelRuntime{}).
+		// count the steps bound to the runtime, which also releases it for deletion
+		Watches(&corev1alpha1.Step{}, handler.EnqueueRequestsFromMapFunc(stepToModelRuntime(stepruntime.KindClusterModelRuntime))).
+		Complete(r)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/modelruntime"
+	stepruntime "github.com/dreamstax/kai/internal/step/modelruntime"
+)
+
+// ModelRuntimeReconciler reconciles a ModelRuntime object
+type ModelRuntimeReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	rtc    *modelruntime.Client
+}
+
+//+kubebuilder:rbac:groups=core.kai.io,resources=modelruntimes,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=core.kai.io,resources=modelruntimes/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=core.kai.io,resources=modelruntimes/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core.kai.io,resources=steps,verbs=get;list;watch
+
+func (r *ModelRuntimeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.rtc.ReconcileModelRuntime(ctx, req)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ModelRuntimeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.rtc = modelruntime.New(r.Client)
+
+	if err := indexStepsByModelRuntime(mgr); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1alpha1.ModelRuntime{}).
+		// count the steps bound to the runtime, which also releases it for deletion
+		Watches(&corev1alpha1.Step{}, handler.EnqueueRequestsFromMapFunc(stepToModelRuntime(stepruntime.KindModelRuntime))).
+		Complete(r)
+}
+
+// stepToModelRuntime maps a step to the runtime of the given kind it is bound to.
+func stepToModelRuntime(kind string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		rt := obj.(*corev1alpha1.Step).Status.ModelRuntime
+		if rt == nil || rt.Kind != kind {
+			return nil
+		}
+		name := types.NamespacedName{Name: rt.Name}
+		if kind == stepruntime.KindModelRuntime {
+			name.Namespace = obj.GetNamespace()
+		}
+		return []reconcile.Request{{NamespacedName: name}}
+	}
+}
@@ -19,19 +19,28 @@ package core
 import (
 	"context"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
 	"github.com/dreamstax/kai/internal/pipeline"
+	"github.com/dreamstax/kai/internal/piper"
 )
 
 // PipelineReconciler reconciles a Pipeline object
 type PipelineReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
-	pipec  *pipeline.Client
+	// Piper is the client used to register pipelines with kai-piper, registration is disabled when nil
+	Piper *piper.Client
+	pipec *pipeline.Client
 }
 
 //+kubebuilder:rbac:groups=core.kai.io,resources=steps,verbs=get;list;watch;create;update;patch;delete
@@ -41,6 +50,8 @@ type PipelineReconciler struct {
 //+kubebuilder:rbac:groups=core.kai.io,resources=pipelines,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core.kai.io,resources=pipelines/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=core.kai.io,resources=pipelines/finalizers,verbs=update
+//+kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core.kai.io,resources=modelruntimes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core.kai.io,resources=modelruntimes/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=core.kai.io,resources=modelruntimes/finalizers,verbs=update
@@ -51,8 +62,80 @@ func (r *PipelineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PipelineReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	r.pipec = pipeline.New(r.Client)
+	r.pipec = pipeline.New(r.Client, r.Piper)
+
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1alpha1.Pipeline{}, stepRefIndex, indexStepRefs)
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &corev1alpha1.Pipeline{}, serviceRefIndex, indexServiceRefs)
+	if err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1alpha1.Pipeline{}).
+		Owns(&corev1alpha1.Step{}).
+		Owns(&appsv1.ControllerRevision{}).
+		// steps referenced by pipelines aren't owned by them, find the pipelines through the index
+		Watches(&corev1alpha1.Step{}, handler.EnqueueRequestsFromMapFunc(r.refToPipelines(stepRefIndex))).
+		// as are services referenced as endpoints
+		Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(r.refToPipelines(serviceRefIndex))).
 		Complete(r)
 }
+
+// stepRefIndex indexes pipelines by the namespaced names of the steps they reference.
+const stepRefIndex = ".spec.steps.stepRef"
+
+func indexStepRefs(obj client.Object) []string {
+	p := obj.(*corev1alpha1.Pipeline)
+	var out []string
+	for _, s := range p.Spec.Steps {
+		if s.StepRef == nil {
+			continue
+		}
+		name := types.NamespacedName{Namespace: s.StepRef.Namespace, Name: s.StepRef.Name}
+		if name.Namespace == "" {
+			name.Namespace = p.Namespace
+		}
+		out = append(out, name.String())
+	}
+	return out
+}
+
+// serviceRefIndex indexes pipelines by the namespaced names of the services they reference as endpoints.
+const serviceRefIndex = ".spec.steps.endpoint.service"
+
+func indexServiceRefs(obj client.Object) []string {
+	p := obj.(*corev1alpha1.Pipeline)
+	var out []string
+	for _, s := range p.Spec.Steps {
+		if s.Endpoint == nil || s.Endpoint.Service == nil {
+			continue
+		}
+		name := types.NamespacedName{Namespace: s.Endpoint.Service.Namespace, Name: s.Endpoint.Service.Name}
+		if name.Namespace == "" {
+			name.Namespace = p.Namespace
+		}
+		out = append(out, name.String())
+	}
+	return out
+}
+
+// refToPipelines returns a map func enqueueing the pipelines referencing an object through the given index.
+func (r *PipelineReconciler) refToPipelines(index string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		pipelines := &corev1alpha1.PipelineList{}
+		err := r.List(ctx, pipelines, client.MatchingFields{index: client.ObjectKeyFromObject(obj).String()})
+		if err != nil {
+			log.FromContext(ctx).Error(err, "failed to list pipelines referencing object", "index", index, "object", client.ObjectKeyFromObject(obj))
+			return nil
+		}
+
+		out := make([]reconcile.Request, 0, len(pipelines.Items))
+		for _, p := range pipelines.Items {
+			out = append(out, reconcile.Request{NamespacedName: p.NamespacedName()})
+		}
+		return out
+	}
+}
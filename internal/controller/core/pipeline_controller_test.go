@@ -0,0 +1,120 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+)
+
+func TestRefToPipelines(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline := func(namespace, name string, steps ...*corev1alpha1.StepTemplateSpec) *corev1alpha1.Pipeline {
+		return &corev1alpha1.Pipeline{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1alpha1.PipelineSpec{Steps: steps},
+		}
+	}
+	stepRef := func(namespace, name string) *corev1alpha1.StepTemplateSpec {
+		return &corev1alpha1.StepTemplateSpec{StepRef: &corev1alpha1.StepReference{Name: name, Namespace: namespace}}
+	}
+	serviceRef := func(namespace, name string) *corev1alpha1.StepTemplateSpec {
+		return &corev1alpha1.StepTemplateSpec{Endpoint: &corev1alpha1.EndpointReference{
+			Service: &corev1alpha1.ServiceReference{Name: name, Namespace: namespace},
+		}}
+	}
+
+	kc := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithIndex(&corev1alpha1.Pipeline{}, stepRefIndex, indexStepRefs).
+		WithIndex(&corev1alpha1.Pipeline{}, serviceRefIndex, indexServiceRefs).
+		WithObjects(
+			pipeline("team-a", "local", stepRef("", "features"), serviceRef("", "torchserve")),
+			pipeline("team-a", "remote", stepRef("shared", "features"), serviceRef("models", "torchserve")),
+			pipeline("team-b", "local", stepRef("", "features")),
+		).
+		Build()
+	r := &PipelineReconciler{Client: kc}
+
+	tests := []struct {
+		name  string
+		index string
+		obj   client.Object
+		want  []string
+	}{
+		{
+			name:  "step in the same namespace",
+			index: stepRefIndex,
+			obj:   &corev1alpha1.Step{ObjectMeta: metav1.ObjectMeta{Name: "features", Namespace: "team-a"}},
+			want:  []string{"team-a/local"},
+		},
+		{
+			name:  "step in another namespace",
+			index: stepRefIndex,
+			obj:   &corev1alpha1.Step{ObjectMeta: metav1.ObjectMeta{Name: "features", Namespace: "shared"}},
+			want:  []string{"team-a/remote"},
+		},
+		{
+			name:  "service in the same namespace",
+			index: serviceRefIndex,
+			obj:   &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "torchserve", Namespace: "team-a"}},
+			want:  []string{"team-a/local"},
+		},
+		{
+			name:  "service in another namespace",
+			index: serviceRefIndex,
+			obj:   &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "torchserve", Namespace: "models"}},
+			want:  []string{"team-a/remote"},
+		},
+		{
+			name:  "unreferenced service",
+			index: serviceRefIndex,
+			obj:   &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "torchserve", Namespace: "team-b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, req := range r.refToPipelines(tt.index)(context.Background(), tt.obj) {
+				got = append(got, req.String())
+			}
+			sort.Strings(got)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
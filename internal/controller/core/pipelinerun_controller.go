@@ -0,0 +1,55 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/pipelinerun"
+	"github.com/dreamstax/kai/internal/piper"
+)
+
+// PipelineRunReconciler reconciles a PipelineRun object
+type PipelineRunReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Piper is the client used to submit runs to kai-piper, runs stay pending when nil
+	Piper *piper.Client
+	runc  *pipelinerun.Client
+}
+
+//+kubebuilder:rbac:groups=core.kai.io,resources=pipelineruns,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core.kai.io,resources=pipelineruns/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=core.kai.io,resources=pipelineruns/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core.kai.io,resources=pipelines,verbs=get;list;watch
+
+func (r *PipelineRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.runc.Reconcile(ctx, req)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PipelineRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.runc = pipelinerun.New(r.Client, r.Piper)
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1alpha1.PipelineRun{}).
+		Complete(r)
+}
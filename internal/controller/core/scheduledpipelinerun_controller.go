@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/scheduledrun"
+)
+
+// ScheduledPipelineRunReconciler reconciles a ScheduledPipelineRun object
+type ScheduledPipelineRunReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	runc   *scheduledrun.Client
+}
+
+//+kubebuilder:rbac:groups=core.kai.io,resources=scheduledpipelineruns,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core.kai.io,resources=scheduledpipelineruns/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=core.kai.io,resources=scheduledpipelineruns/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core.kai.io,resources=pipelineruns,verbs=get;list;watch;create;update;patch;delete
+
+func (r *ScheduledPipelineRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.runc.Reconcile(ctx, req)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ScheduledPipelineRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.runc = scheduledrun.New(r.Client)
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1alpha1.ScheduledPipelineRun{}).
+		Owns(&corev1alpha1.PipelineRun{}).
+		Complete(r)
+}
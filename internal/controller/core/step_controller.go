@@ -18,13 +18,25 @@ package core
 
 import (
 	"context"
+	"sync"
 
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
 	"github.com/dreamstax/kai/internal/step"
+	"github.com/dreamstax/kai/internal/step/modelruntime"
 )
 
 // StepReconciler reconciles a Step object
@@ -39,9 +51,13 @@ type StepReconciler struct {
 //+kubebuilder:rbac:groups=core.kai.io,resources=steps/finalizers,verbs=update
 //+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch;delete
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch
 //+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core.kai.io,resources=modelruntimes,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core.kai.io,resources=clustermodelruntimes,verbs=get;list;watch
 
 func (r *StepReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	return r.stepc.Reconcile(ctx, req)
@@ -49,8 +65,81 @@ func (r *StepReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *StepReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	r.stepc = step.New(r.Client)
+	r.stepc = step.New(r.Client, mgr.GetAPIReader())
+
+	if err := indexStepsByModelRuntime(mgr); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1alpha1.Step{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.Service{}).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		// pods are owned by replicasets so map them back to their step by label
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(podToStep)).
+		// steps copy the containers of their model runtime, roll them when the runtime changes
+		Watches(&corev1alpha1.ModelRuntime{}, handler.EnqueueRequestsFromMapFunc(r.modelRuntimeToSteps),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&corev1alpha1.ClusterModelRuntime{}, handler.EnqueueRequestsFromMapFunc(r.modelRuntimeToSteps),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Complete(r)
 }
+
+// modelRuntimeToSteps maps a ModelRuntime to the steps of its namespace bound to it, unbound or
+// bound to a ClusterModelRuntime it may take precedence over, and a ClusterModelRuntime to the
+// steps bound to it or unbound in all namespaces.
+func (r *StepReconciler) modelRuntimeToSteps(ctx context.Context, obj client.Object) []reconcile.Request {
+	kind := modelruntime.KindModelRuntime
+	keys := []string{modelruntime.IndexKey(kind, obj.GetName()), modelruntime.Unbound, modelruntime.ClusterBound}
+	if _, ok := obj.(*corev1alpha1.ClusterModelRuntime); ok {
+		kind = modelruntime.KindClusterModelRuntime
+		keys = []string{modelruntime.IndexKey(kind, obj.GetName()), modelruntime.Unbound}
+	}
+
+	var out []reconcile.Request
+	for _, key := range keys {
+		steps := &corev1alpha1.StepList{}
+		err := r.List(ctx, steps, client.InNamespace(obj.GetNamespace()), client.MatchingFields{modelruntime.StepIndex: key})
+		if err != nil {
+			log.FromContext(ctx).Error(err, "failed to list steps of model runtime", "kind", kind, "modelRuntime", client.ObjectKeyFromObject(obj))
+			return nil
+		}
+		for _, s := range steps.Items {
+			out = append(out, reconcile.Request{NamespacedName: s.NamespacedName()})
+		}
+	}
+	return out
+}
+
+// stepIndexes tracks the managers the step index is registered with. The index is shared by the
+// step and model runtime controllers but can only be registered once with each manager.
+var stepIndexes = struct {
+	sync.Mutex
+	managers map[ctrl.Manager]bool
+}{managers: map[ctrl.Manager]bool{}}
+
+func indexStepsByModelRuntime(mgr ctrl.Manager) error {
+	stepIndexes.Lock()
+	defer stepIndexes.Unlock()
+
+	if stepIndexes.managers[mgr] {
+		return nil
+	}
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1alpha1.Step{}, modelruntime.StepIndex, modelruntime.IndexStep)
+	if err != nil {
+		return err
+	}
+	stepIndexes.managers[mgr] = true
+	return nil
+}
+
+func podToStep(ctx context.Context, obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()[kai.StepLabelKey]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}},
+	}
+}
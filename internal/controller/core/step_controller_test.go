@@ -0,0 +1,144 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/step/modelruntime"
+)
+
+func TestModelRuntimeToSteps(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	step := func(namespace, name string, rt *corev1alpha1.ModelRuntimeSelection) *corev1alpha1.Step {
+		return &corev1alpha1.Step{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1alpha1.StepSpec{Model: &corev1alpha1.ModelSpec{ModelFormat: corev1alpha1.PytorchModelFormat}},
+			Status:     corev1alpha1.StepStatus{ModelRuntime: rt},
+		}
+	}
+	bound := func(kind, name string) *corev1alpha1.ModelRuntimeSelection {
+		return &corev1alpha1.ModelRuntimeSelection{Kind: kind, Name: name}
+	}
+
+	kc := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithIndex(&corev1alpha1.Step{}, modelruntime.StepIndex, modelruntime.IndexStep).
+		WithObjects(
+			step("team-a", "classifier", bound(modelruntime.KindModelRuntime, "torchserve")),
+			step("team-a", "detector", bound(modelruntime.KindClusterModelRuntime, "torchserve")),
+			step("team-a", "pending", nil),
+			step("team-b", "classifier", bound(modelruntime.KindModelRuntime, "torchserve")),
+			step("team-b", "detector", bound(modelruntime.KindClusterModelRuntime, "torchserve")),
+			step("team-b", "segmenter", bound(modelruntime.KindClusterModelRuntime, "triton")),
+		).
+		Build()
+	r := &StepReconciler{Client: kc}
+
+	tests := []struct {
+		name string
+		obj  client.Object
+		want []string
+	}{
+		{
+			name: "model runtime",
+			obj:  &corev1alpha1.ModelRuntime{ObjectMeta: metav1.ObjectMeta{Name: "torchserve", Namespace: "team-a"}},
+			// the runtime takes precedence over the cluster model runtimes of its namespace
+			want: []string{"team-a/classifier", "team-a/detector", "team-a/pending"},
+		},
+		{
+			name: "model runtime without unbound steps",
+			obj:  &corev1alpha1.ModelRuntime{ObjectMeta: metav1.ObjectMeta{Name: "triton", Namespace: "team-b"}},
+			want: []string{"team-b/detector", "team-b/segmenter"},
+		},
+		{
+			name: "cluster model runtime",
+			obj:  &corev1alpha1.ClusterModelRuntime{ObjectMeta: metav1.ObjectMeta{Name: "torchserve"}},
+			want: []string{"team-a/detector", "team-a/pending", "team-b/detector"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, req := range r.modelRuntimeToSteps(context.Background(), tt.obj) {
+				got = append(got, req.String())
+			}
+			sort.Strings(got)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexStepsByModelRuntime(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	// the managers never reach the api server, map steps without discovery
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1alpha1.GroupVersion.WithKind("Step"), meta.RESTScopeNamespace)
+
+	// each manager gets its own index, registering it again with a manager is a no-op
+	for i := 0; i < 2; i++ {
+		mgr, err := ctrl.NewManager(&rest.Config{Host: "http://localhost"}, ctrl.Options{
+			Scheme:  scheme,
+			Metrics: metricsserver.Options{BindAddress: "0"},
+			MapperProvider: func(*rest.Config, *http.Client) (meta.RESTMapper, error) {
+				return mapper, nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 2; j++ {
+			if err := indexStepsByModelRuntime(mgr); err != nil {
+				t.Fatalf("manager %d: unexpected error: %v", i, err)
+			}
+		}
+		// the index is registered with the manager, so registering it directly conflicts
+		err = mgr.GetFieldIndexer().IndexField(context.Background(), &corev1alpha1.Step{}, modelruntime.StepIndex, modelruntime.IndexStep)
+		if err == nil {
+			t.Errorf("manager %d: expected the step index to be registered", i)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package catalog installs the built-in cluster model runtimes, so models of the common formats
+// are served without writing a runtime first.
+package catalog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	corev1 "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// the catalog runtimes have a negative priority so runtimes provided by the cluster admins win
+// with the default priority
+const (
+	priorityDefault  = int32(-10)
+	priorityFallback = int32(-20)
+)
+
+// the port serving the HTTP API of the catalog runtimes
+const httpPort = 8080
+
+// the delay between attempts to install the catalog doubles up to maxRetryDelay, the webhooks
+// validating the runtimes may not be reachable yet when the controller starts
+var (
+	retryDelay    = time.Second
+	maxRetryDelay = time.Minute
+)
+
+// Runtimes returns the cluster model runtimes of the catalog.
+func Runtimes() []*corev1alpha1.ClusterModelRuntime {
+	return []*corev1alpha1.ClusterModelRuntime{
+		torchserve(),
+		triton(),
+		mlserver(),
+		tfserving(),
+	}
+}
+
+func torchserve() *corev1alpha1.ClusterModelRuntime {
+	return makeRuntime("kai-torchserve",
+		[]corev1alpha1.SupportedModelFormat{
+			format(corev1alpha1.PytorchModelFormat, "", priorityDefault),
+		},
+		corev1.Container{
+			Name:  corev1alpha1.InferenceContainerName,
+			Image: "pytorch/torchserve-kfs:0.8.2",
+			Args: []string{
+				"torchserve",
+				"--start",
+				"--model-store=" + corev1alpha1.ModelMountPathPlaceholder + "/model-store",
+				"--ts-config=" + corev1alpha1.ModelMountPathPlaceholder + "/config/config.properties",
+			},
+			Ports: []corev1.ContainerPort{{ContainerPort: 8085, Protocol: corev1.ProtocolTCP}},
+		})
+}
+
+func triton() *corev1alpha1.ClusterModelRuntime {
+	// pytorch models need to be exported for triton, only serve them when requested by name
+	pytorch := format(corev1alpha1.PytorchModelFormat, "", priorityDefault)
+	autoSelect := false
+	pytorch.AutoSelect = &autoSelect
+
+	return makeRuntime("kai-triton",
+		[]corev1alpha1.SupportedModelFormat{
+			format(corev1alpha1.TritonModelFormat, "", priorityDefault),
+			format(corev1alpha1.OnnxModelFormat, "", priorityDefault),
+			format(corev1alpha1.TensorflowModelFormat, "", priorityFallback),
+			pytorch,
+		},
+		corev1.Container{
+			Name:  corev1alpha1.InferenceContainerName,
+			Image: "nvcr.io/nvidia/tritonserver:23.05-py3",
+			Args: []string{
+				"tritonserver",
+				"--model-store=" + corev1alpha1.ModelMountPathPlaceholder,
+				"--http-port=" + corev1alpha1.PortPlaceholder,
+				"--allow-grpc=false",
+			},
+			Ports: []corev1.ContainerPort{{ContainerPort: httpPort, Protocol: corev1.ProtocolTCP}},
+		})
+}
+
+func mlserver() *corev1alpha1.ClusterModelRuntime {
+	return makeRuntime("kai-mlserver",
+		[]corev1alpha1.SupportedModelFormat{
+			format(corev1alpha1.SklearnModelFormat, "1", priorityDefault),
+			format(corev1alpha1.XGBoostModelFormat, "1", priorityDefault),
+			format(corev1alpha1.LightGBMModelFormat, "3", priorityDefault),
+		},
+		corev1.Container{
+			Name:  corev1alpha1.InferenceContainerName,
+			Image: "docker.io/seldonio/mlserver:1.3.5",
+			Args:  []string{"mlserver", "start", corev1alpha1.ModelMountPathPlaceholder},
+			Env: []corev1.EnvVar{
+				{Name: "MLSERVER_HTTP_PORT", Value: corev1alpha1.PortPlaceholder},
+				{Name: "MLSERVER_GRPC_PORT", Value: "9000"},
+			},
+			Ports: []corev1.ContainerPort{{ContainerPort: httpPort, Protocol: corev1.ProtocolTCP}},
+		})
+}
+
+func tfserving() *corev1alpha1.ClusterModelRuntime {
+	return makeRuntime("kai-tfserving",
+		[]corev1alpha1.SupportedModelFormat{
+			format(corev1alpha1.TensorflowModelFormat, "", priorityDefault),
+		},
+		corev1.Container{
+			Name:    corev1alpha1.InferenceContainerName,
+			Image:   "tensorflow/serving:2.6.2",
+			Command: []string{"/usr/bin/tensorflow_model_server"},
+			Args: []string{
+				"--port=9000",
+				"--rest_api_port=" + corev1alpha1.PortPlaceholder,
+				"--model_name=" + corev1alpha1.ModelNamePlaceholder,
+				"--model_base_path=" + corev1alpha1.ModelMountPathPlaceholder,
+			},
+			Ports: []corev1.ContainerPort{{ContainerPort: httpPort, Protocol: corev1.ProtocolTCP}},
+		})
+}
+
+func makeRuntime(name string, formats []corev1alpha1.SupportedModelFormat, container corev1.Container) *corev1alpha1.ClusterModelRuntime {
+	return &corev1alpha1.ClusterModelRuntime{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"app.kubernetes.io/part-of":    "kai",
+				"app.kubernetes.io/managed-by": "kai",
+			},
+		},
+		Spec: corev1alpha1.ModelRuntimeSpec{
+			ModelFormats: formats,
+			Containers:   []corev1.Container{container},
+		},
+	}
+}
+
+func format(name corev1alpha1.ModelFormat, version string, priority int32) corev1alpha1.SupportedModelFormat {
+	f := corev1alpha1.SupportedModelFormat{Name: name, Priority: &priority}
+	if version != "" {
+		f.Version = &version
+	}
+	return f
+}
+
+// Install creates the runtimes of the catalog and updates those installed by an older version of
+// the catalog. Runtimes which weren't installed from the catalog or were modified since are left
+// alone.
+func Install(ctx context.Context, client kclient.Client) error {
+	for _, rt := range Runtimes() {
+		if err := install(ctx, client, rt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InstallWithRetry installs the catalog, retrying with backoff until it succeeds. It returns the
+// last error once the context is done.
+func InstallWithRetry(ctx context.Context, client kclient.Client) error {
+	delay := retryDelay
+	for {
+		err := Install(ctx, client)
+		if err == nil {
+			return nil
+		}
+		log.FromContext(ctx).Error(err, "failed to install model runtime catalog, retrying", "delay", delay)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to install model runtime catalog: %w", err)
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+func install(ctx context.Context, client kclient.Client, want *corev1alpha1.ClusterModelRuntime) error {
+	logger := log.FromContext(ctx).WithValues("clusterModelRuntime", want.Name)
+
+	hash, err := hashSpec(&want.Spec)
+	if err != nil {
+		return err
+	}
+	metav1.SetMetaDataAnnotation(&want.ObjectMeta, kai.CatalogHashAnnotationKey, hash)
+
+	got := &corev1alpha1.ClusterModelRuntime{}
+	err = client.Get(ctx, types.NamespacedName{Name: want.Name}, got)
+	if apierr.IsNotFound(err) {
+		if err := client.Create(ctx, want); err != nil {
+			return fmt.Errorf("failed to create clustermodelruntime %q: %w", want.Name, err)
+		}
+		logger.Info("installed model runtime from the catalog")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get clustermodelruntime %q: %w", want.Name, err)
+	}
+
+	installed, ok := got.Annotations[kai.CatalogHashAnnotationKey]
+	if !ok {
+		logger.Info("leaving model runtime which wasn't installed from the catalog")
+		return nil
+	}
+	current, err := hashSpec(&got.Spec)
+	if err != nil {
+		return err
+	}
+	if current != installed {
+		logger.Info("leaving model runtime modified since it was installed from the catalog")
+		return nil
+	}
+	if installed == hash {
+		return nil
+	}
+
+	got.Spec = want.Spec
+	metav1.SetMetaDataAnnotation(&got.ObjectMeta, kai.CatalogHashAnnotationKey, hash)
+	if err := client.Update(ctx, got); err != nil {
+		return fmt.Errorf("failed to update clustermodelruntime %q: %w", want.Name, err)
+	}
+	logger.Info("updated model runtime from the catalog")
+	return nil
+}
+
+func hashSpec(spec *corev1alpha1.ModelRuntimeSpec) (string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal model runtime spec: %w", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	"github.com/dreamstax/kai/internal/modelruntime"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestRuntimesAreValid(t *testing.T) {
+	for _, rt := range Runtimes() {
+		if problems := modelruntime.Validate(&rt.Spec); len(problems) > 0 {
+			t.Errorf("expected %s to be valid, got %v", rt.Name, problems)
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	// installed by an older catalog
+	outdated := torchserve()
+	outdated.Spec.Containers[0].Image = "pytorch/torchserve-kfs:0.7.0"
+	hash, err := hashSpec(&outdated.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metav1.SetMetaDataAnnotation(&outdated.ObjectMeta, kai.CatalogHashAnnotationKey, hash)
+
+	// installed from the catalog and then modified
+	modified := triton()
+	hash, err = hashSpec(&modified.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metav1.SetMetaDataAnnotation(&modified.ObjectMeta, kai.CatalogHashAnnotationKey, hash)
+	modified.Spec.Containers[0].Image = "registry.example.com/tritonserver:patched"
+
+	// created by the cluster admins
+	custom := mlserver()
+	custom.Spec.Containers[0].Image = "registry.example.com/mlserver:custom"
+
+	kc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(outdated, modified, custom).Build()
+	if err := Install(ctx, kc); err != nil {
+		t.Fatal(err)
+	}
+
+	images := map[string]string{
+		"kai-torchserve": torchserve().Spec.Containers[0].Image,
+		"kai-triton":     "registry.example.com/tritonserver:patched",
+		"kai-mlserver":   "registry.example.com/mlserver:custom",
+		"kai-tfserving":  tfserving().Spec.Containers[0].Image,
+	}
+	for name, image := range images {
+		rt := &corev1alpha1.ClusterModelRuntime{}
+		if err := kc.Get(ctx, types.NamespacedName{Name: name}, rt); err != nil {
+			t.Fatalf("expected %s to be installed, got %v", name, err)
+		}
+		if got := rt.Spec.Containers[0].Image; got != image {
+			t.Errorf("expected %s to run %s, got %s", name, image, got)
+		}
+	}
+
+	// installing again leaves the runtimes as they are
+	before := &corev1alpha1.ClusterModelRuntimeList{}
+	if err := kc.List(ctx, before); err != nil {
+		t.Fatal(err)
+	}
+	if err := Install(ctx, kc); err != nil {
+		t.Fatal(err)
+	}
+	for _, rt := range before.Items {
+		got := &corev1alpha1.ClusterModelRuntime{}
+		if err := kc.Get(ctx, kclient.ObjectKeyFromObject(&rt), got); err != nil {
+			t.Fatal(err)
+		}
+		if got.ResourceVersion != rt.ResourceVersion {
+			t.Errorf("expected %s to be left unchanged", rt.Name)
+		}
+	}
+}
+
+func TestInstallWithRetry(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(delay, max time.Duration) {
+		retryDelay, maxRetryDelay = delay, max
+	}(retryDelay, maxRetryDelay)
+	retryDelay, maxRetryDelay = time.Millisecond, 2*time.Millisecond
+
+	// the webhook rejects the first attempts as it isn't reachable yet
+	failures := 3
+	unreachable := errors.New("failed calling webhook: connection refused")
+	kc := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(ctx context.Context, client kclient.WithWatch, obj kclient.Object, opts ...kclient.CreateOption) error {
+			if failures > 0 {
+				failures--
+				return unreachable
+			}
+			return client.Create(ctx, obj, opts...)
+		},
+	}).Build()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := InstallWithRetry(ctx, kc); err != nil {
+		t.Fatal(err)
+	}
+	installed := &corev1alpha1.ClusterModelRuntimeList{}
+	if err := kc.List(ctx, installed); err != nil {
+		t.Fatal(err)
+	}
+	if len(installed.Items) != len(Runtimes()) {
+		t.Errorf("expected %d runtimes to be installed, got %d", len(Runtimes()), len(installed.Items))
+	}
+
+	// the error is returned once the context is done
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	kc = fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(context.Context, kclient.WithWatch, kclient.Object, ...kclient.CreateOption) error {
+			return unreachable
+		},
+	}).Build()
+	if err := InstallWithRetry(canceled, kc); !errors.Is(err, unreachable) {
+		t.Errorf("expected %v, got %v", unreachable, err)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package modelruntime reconciles ModelRuntimes and ClusterModelRuntimes, reporting whether they
+// are able to serve models and which steps they serve.
+package modelruntime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	stepruntime "github.com/dreamstax/kai/internal/step/modelruntime"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reasons surfaced on the Valid condition
+const (
+	reasonValid   = "Valid"
+	reasonInvalid = "Invalid"
+)
+
+// the number of steps listed in the status of a runtime, cluster runtimes may serve many steps
+const maxStepNames = 100
+
+type Client struct {
+	kclient kclient.Client
+}
+
+// New returns a client reconciling model runtimes. It lists steps through the
+// stepruntime.StepIndex, which must be registered with the cache of the client.
+func New(client kclient.Client) *Client {
+	return &Client{
+		kclient: client,
+	}
+}
+
+// ReconcileModelRuntime reconciles the ModelRuntime of the request.
+func (c *Client) ReconcileModelRuntime(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	rt := &corev1alpha1.ModelRuntime{}
+	err := c.kclient.Get(ctx, req.NamespacedName, rt)
+	if err != nil {
+		if apierr.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("failed to retrieve latest modelruntime %s: %w", req.NamespacedName, err)
+	}
+	return ctrl.Result{}, c.reconcile(ctx, rt, stepruntime.KindModelRuntime, &rt.Spec, &rt.Status)
+}
+
+// ReconcileClusterModelRuntime reconciles the ClusterModelRuntime of the request.
+func (c *Client) ReconcileClusterModelRuntime(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	rt := &corev1alpha1.ClusterModelRuntime{}
+	err := c.kclient.Get(ctx, req.NamespacedName, rt)
+	if err != nil {
+		if apierr.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("failed to retrieve latest clustermodelruntime %s: %w", req.Name, err)
+	}
+	return ctrl.Result{}, c.reconcile(ctx, rt, stepruntime.KindClusterModelRuntime, &rt.Spec, &rt.Status)
+}
+
+// reconcile records the validity and the steps of a runtime in its status. The runtime is
+// protected from deletion by a finalizer while it serves steps.
+func (c *Client) reconcile(ctx context.Context, obj kclient.Object, kind string, spec *corev1alpha1.ModelRuntimeSpec, status *corev1alpha1.ModelRuntimeStatus) error {
+	original := status.DeepCopy()
+
+	steps, err := c.listSteps(ctx, obj, kind)
+	if err != nil {
+		return err
+	}
+	status.StepCount = int32(len(steps))
+	status.Steps = steps
+	if len(steps) > maxStepNames {
+		status.Steps = steps[:maxStepNames]
+	}
+	setValidCondition(obj.GetGeneration(), spec, status)
+
+	if obj.GetDeletionTimestamp() != nil {
+		if len(steps) > 0 {
+			log.FromContext(ctx).Info("deletion of model runtime blocked by the steps it serves", "kind", kind, "steps", status.Steps)
+		} else if controllerutil.ContainsFinalizer(obj, kai.ModelRuntimeFinalizer) {
+			controllerutil.RemoveFinalizer(obj, kai.ModelRuntimeFinalizer)
+			if err := c.kclient.Update(ctx, obj); err != nil {
+				return fmt.Errorf("failed to remove finalizer from %s %q: %w", strings.ToLower(kind), obj.GetName(), err)
+			}
+			// the runtime is gone once released, there is no status left to update
+			return nil
+		}
+	} else if !controllerutil.ContainsFinalizer(obj, kai.ModelRuntimeFinalizer) {
+		// updating the runtime replaces it with the stored object, keep the status recorded above
+		observed := status.DeepCopy()
+		controllerutil.AddFinalizer(obj, kai.ModelRuntimeFinalizer)
+		if err := c.kclient.Update(ctx, obj); err != nil {
+			return fmt.Errorf("failed to add finalizer to %s %q: %w", strings.ToLower(kind), obj.GetName(), err)
+		}
+		*status = *observed
+	}
+
+	status.ObservedGeneration = obj.GetGeneration()
+	if !equality.Semantic.DeepEqual(original, status) {
+		if err := c.kclient.Status().Update(ctx, obj); err != nil {
+			return fmt.Errorf("failed to update status of %s %q: %w", strings.ToLower(kind), obj.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+// listSteps returns the sorted namespaced names of the steps bound to the runtime.
+func (c *Client) listSteps(ctx context.Context, obj kclient.Object, kind string) ([]string, error) {
+	steps := &corev1alpha1.StepList{}
+	err := c.kclient.List(ctx, steps,
+		kclient.InNamespace(obj.GetNamespace()),
+		kclient.MatchingFields{stepruntime.StepIndex: stepruntime.IndexKey(kind, obj.GetName())})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list steps of %s %q: %w", strings.ToLower(kind), obj.GetName(), err)
+	}
+
+	names := make([]string, 0, len(steps.Items))
+	for _, s := range steps.Items {
+		names = append(names, s.NamespacedName().String())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func setValidCondition(generation int64, spec *corev1alpha1.ModelRuntimeSpec, status *corev1alpha1.ModelRuntimeStatus) {
+	cond := metav1.Condition{
+		Type:               corev1alpha1.ModelRuntimeConditionValid,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             reasonValid,
+		Message:            "runtime is able to serve models",
+	}
+
+	if problems := Validate(spec); len(problems) > 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reasonInvalid
+		cond.Message = strings.Join(problems, "; ")
+	}
+
+	meta.SetStatusCondition(&status.Conditions, cond)
+}
+
+// Validate returns the problems preventing a runtime from serving models. Unlike the admission
+// webhook it also checks runtimes created while the webhooks were disabled.
+func Validate(spec *corev1alpha1.ModelRuntimeSpec) []string {
+	var problems []string
+
+	var server *corev1.Container
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == corev1alpha1.InferenceContainerName {
+			server = &spec.Containers[i]
+			break
+		}
+	}
+	switch {
+	case server == nil:
+		problems = append(problems, fmt.Sprintf("no container named %q serves the model", corev1alpha1.InferenceContainerName))
+	case len(server.Ports) == 0:
+		problems = append(problems, fmt.Sprintf("container %q exposes no port", corev1alpha1.InferenceContainerName))
+	}
+
+	if len(spec.GetModelFormats()) == 0 {
+		problems = append(problems, "no model formats are supported")
+	}
+
+	for _, c := range spec.Containers {
+		values := append(append([]string{}, c.Command...), c.Args...)
+		for _, e := range c.Env {
+			values = append(values, e.Value)
+		}
+		for _, v := range values {
+			for _, ref := range corev1alpha1.UnknownPlaceholders(v) {
+				problems = append(problems, fmt.Sprintf("container %q references unknown placeholder %s", c.Name, ref))
+			}
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modelruntime
+
+import (
+	"context"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	stepruntime "github.com/dreamstax/kai/internal/step/modelruntime"
+	corev1 "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newClient(t *testing.T, objs ...kclient.Object) kclient.Client {
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithStatusSubresource(&corev1alpha1.ModelRuntime{}, &corev1alpha1.ClusterModelRuntime{}).
+		WithIndex(&corev1alpha1.Step{}, stepruntime.StepIndex, stepruntime.IndexStep).
+		Build()
+}
+
+func boundStep(namespace, name, kind, runtime string) *corev1alpha1.Step {
+	return &corev1alpha1.Step{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       corev1alpha1.StepSpec{Model: &corev1alpha1.ModelSpec{ModelFormat: corev1alpha1.PytorchModelFormat}},
+		Status: corev1alpha1.StepStatus{
+			ModelRuntime: &corev1alpha1.ModelRuntimeSelection{Kind: kind, Name: runtime},
+		},
+	}
+}
+
+func torchserve() corev1alpha1.ModelRuntimeSpec {
+	return corev1alpha1.ModelRuntimeSpec{
+		ModelFormats: []corev1alpha1.SupportedModelFormat{{Name: corev1alpha1.PytorchModelFormat}},
+		Containers: []corev1.Container{{
+			Name:  corev1alpha1.InferenceContainerName,
+			Image: "pytorch/torchserve-kfs:0.7.0",
+			Ports: []corev1.ContainerPort{{ContainerPort: 8085}},
+		}},
+	}
+}
+
+func TestReconcileRecordsSteps(t *testing.T) {
+	ctx := context.Background()
+	rt := &corev1alpha1.ModelRuntime{
+		ObjectMeta: metav1.ObjectMeta{Name: "torchserve", Namespace: "default", Generation: 2},
+		Spec:       torchserve(),
+	}
+	kc := newClient(t, rt,
+		boundStep("default", "detector", stepruntime.KindModelRuntime, "torchserve"),
+		boundStep("default", "classifier", stepruntime.KindModelRuntime, "torchserve"),
+		boundStep("default", "segmenter", stepruntime.KindClusterModelRuntime, "torchserve"),
+		boundStep("other", "classifier", stepruntime.KindModelRuntime, "torchserve"),
+	)
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "torchserve"}}
+	if _, err := New(kc).ReconcileModelRuntime(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &corev1alpha1.ModelRuntime{}
+	if err := kc.Get(ctx, req.NamespacedName, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.StepCount != 2 || len(got.Status.Steps) != 2 ||
+		got.Status.Steps[0] != "default/classifier" || got.Status.Steps[1] != "default/detector" {
+		t.Errorf("expected the steps of the namespace bound to the runtime, got %d %v", got.Status.StepCount, got.Status.Steps)
+	}
+	if got.Status.ObservedGeneration != 2 {
+		t.Errorf("expected observed generation 2, got %d", got.Status.ObservedGeneration)
+	}
+	if !meta.IsStatusConditionTrue(got.Status.Conditions, corev1alpha1.ModelRuntimeConditionValid) {
+		t.Errorf("expected runtime to be valid, got %v", got.Status.Conditions)
+	}
+	if len(got.Finalizers) != 1 || got.Finalizers[0] != kai.ModelRuntimeFinalizer {
+		t.Errorf("expected finalizer %s, got %v", kai.ModelRuntimeFinalizer, got.Finalizers)
+	}
+}
+
+func TestReconcileReportsInvalidRuntime(t *testing.T) {
+	ctx := context.Background()
+	rt := &corev1alpha1.ClusterModelRuntime{
+		ObjectMeta: metav1.ObjectMeta{Name: "torchserve"},
+		Spec: corev1alpha1.ModelRuntimeSpec{
+			Containers: []corev1.Container{{
+				Name:  corev1alpha1.InferenceContainerName,
+				Image: "pytorch/torchserve-kfs:0.7.0",
+				Args:  []string{"--model-store=$(model.path)"},
+			}},
+		},
+	}
+	kc := newClient(t, rt)
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "torchserve"}}
+	if _, err := New(kc).ReconcileClusterModelRuntime(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &corev1alpha1.ClusterModelRuntime{}
+	if err := kc.Get(ctx, req.NamespacedName, got); err != nil {
+		t.Fatal(err)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, corev1alpha1.ModelRuntimeConditionValid)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != reasonInvalid {
+		t.Fatalf("expected runtime to be invalid, got %v", cond)
+	}
+	want := `container "kai-container" exposes no port; no model formats are supported; ` +
+		`container "kai-container" references unknown placeholder $(model.path)`
+	if cond.Message != want {
+		t.Errorf("expected message %q, got %q", want, cond.Message)
+	}
+}
+
+func TestReconcileProtectsRuntimeInUse(t *testing.T) {
+	ctx := context.Background()
+	now := metav1.Now()
+	rt := &corev1alpha1.ClusterModelRuntime{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "torchserve",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{kai.ModelRuntimeFinalizer},
+		},
+		Spec: torchserve(),
+	}
+	step := boundStep("team-a", "classifier", stepruntime.KindClusterModelRuntime, "torchserve")
+	kc := newClient(t, rt, step)
+	c := New(kc)
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "torchserve"}}
+	if _, err := c.ReconcileClusterModelRuntime(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	got := &corev1alpha1.ClusterModelRuntime{}
+	if err := kc.Get(ctx, req.NamespacedName, got); err != nil {
+		t.Fatalf("expected runtime serving steps to be kept, got %v", err)
+	}
+	if got.Status.StepCount != 1 {
+		t.Errorf("expected 1 step, got %d", got.Status.StepCount)
+	}
+
+	if err := kc.Delete(ctx, step); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReconcileClusterModelRuntime(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := kc.Get(ctx, req.NamespacedName, got); !apierr.IsNotFound(err) {
+		t.Errorf("expected runtime to be released once unused, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrDuplicateNode is returned when two nodes share the same name.
+	ErrDuplicateNode = errors.New("duplicate step")
+
+	// ErrUnknownDependency is returned when a node depends on a name not present in the graph.
+	ErrUnknownDependency = errors.New("unknown dependency")
+
+	// ErrCycle is returned when the dependencies between nodes do not form a DAG.
+	ErrCycle = errors.New("dependency cycle")
+)
+
+// Node is a single vertex of the graph along with the names of the vertices it depends on.
+type Node struct {
+	Name      string
+	DependsOn []string
+}
+
+// Vertex is a resolved node. Level is the length of the longest path from an entrypoint
+// node (one without dependencies) to this node.
+type Vertex struct {
+	Name      string
+	DependsOn []string
+	Level     int
+}
+
+// Resolve validates the graph described by nodes and returns its vertices in topological
+// order. Vertices are ordered by level and retain their declared order within a level so
+// the result is stable across calls.
+func Resolve(nodes []Node) ([]Vertex, error) {
+	index := make(map[string]int, len(nodes))
+	for i, n := range nodes {
+		if _, ok := index[n.Name]; ok {
+			return nil, fmt.Errorf("%w %q", ErrDuplicateNode, n.Name)
+		}
+		index[n.Name] = i
+	}
+
+	indegree := make([]int, len(nodes))
+	dependents := make([][]int, len(nodes))
+	for i, n := range nodes {
+		seen := map[string]bool{}
+		for _, dep := range n.DependsOn {
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+
+			j, ok := index[dep]
+			if !ok {
+				return nil, fmt.Errorf("%w: step %q depends on %q", ErrUnknownDependency, n.Name, dep)
+			}
+			if j == i {
+				return nil, fmt.Errorf("%w: step %q depends on itself", ErrCycle, n.Name)
+			}
+			indegree[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	levels := make([]int, len(nodes))
+	queue := []int{}
+	for i := range nodes {
+		if indegree[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+
+	visited := 0
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, j := range dependents[i] {
+			if levels[i]+1 > levels[j] {
+				levels[j] = levels[i] + 1
+			}
+			indegree[j]--
+			if indegree[j] == 0 {
+				queue = append(queue, j)
+			}
+		}
+	}
+
+	if visited != len(nodes) {
+		cyclic := []string{}
+		for i, n := range nodes {
+			if indegree[i] > 0 {
+				cyclic = append(cyclic, n.Name)
+			}
+		}
+		return nil, fmt.Errorf("%w involving steps %s", ErrCycle, strings.Join(cyclic, ", "))
+	}
+
+	maxLevel := 0
+	for _, l := range levels {
+		if l > maxLevel {
+			maxLevel = l
+		}
+	}
+
+	out := make([]Vertex, 0, len(nodes))
+	for l := 0; l <= maxLevel; l++ {
+		for i, n := range nodes {
+			if levels[i] != l {
+				continue
+			}
+			out = append(out, Vertex{
+				Name:      n.Name,
+				DependsOn: n.DependsOn,
+				Level:     l,
+			})
+		}
+	}
+
+	return out, nil
+}
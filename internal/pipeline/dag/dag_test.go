@@ -0,0 +1,120 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dag
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   []Node
+		want    []Vertex
+		wantErr error
+	}{
+		{
+			name: "empty",
+			want: []Vertex{},
+		},
+		{
+			name: "levels",
+			nodes: []Node{
+				{Name: "postprocess", DependsOn: []string{"classify", "detect"}},
+				{Name: "classify", DependsOn: []string{"preprocess"}},
+				{Name: "preprocess"},
+				{Name: "detect", DependsOn: []string{"preprocess", "classify"}},
+				{Name: "audit"},
+			},
+			want: []Vertex{
+				{Name: "preprocess", Level: 0},
+				{Name: "audit", Level: 0},
+				{Name: "classify", DependsOn: []string{"preprocess"}, Level: 1},
+				{Name: "detect", DependsOn: []string{"preprocess", "classify"}, Level: 2},
+				{Name: "postprocess", DependsOn: []string{"classify", "detect"}, Level: 3},
+			},
+		},
+		{
+			name: "repeated dependency",
+			nodes: []Node{
+				{Name: "a"},
+				{Name: "b", DependsOn: []string{"a", "a"}},
+			},
+			want: []Vertex{
+				{Name: "a", Level: 0},
+				{Name: "b", DependsOn: []string{"a", "a"}, Level: 1},
+			},
+		},
+		{
+			name:    "duplicate node",
+			nodes:   []Node{{Name: "a"}, {Name: "a"}},
+			wantErr: ErrDuplicateNode,
+		},
+		{
+			name:    "unknown dependency",
+			nodes:   []Node{{Name: "a", DependsOn: []string{"b"}}},
+			wantErr: ErrUnknownDependency,
+		},
+		{
+			name:    "self dependency",
+			nodes:   []Node{{Name: "a", DependsOn: []string{"a"}}},
+			wantErr: ErrCycle,
+		},
+		{
+			name: "cycle",
+			nodes: []Node{
+				{Name: "a"},
+				{Name: "b", DependsOn: []string{"a", "d"}},
+				{Name: "c", DependsOn: []string{"b"}},
+				{Name: "d", DependsOn: []string{"c"}},
+			},
+			wantErr: ErrCycle,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(tt.nodes)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestResolveCycleNamesSteps(t *testing.T) {
+	_, err := Resolve([]Node{
+		{Name: "a", DependsOn: []string{"b"}},
+		{Name: "b", DependsOn: []string{"a"}},
+		{Name: "c"},
+	})
+	want := `dependency cycle involving steps a, b`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package params
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+)
+
+var (
+	// ErrMissingValue is returned when a parameter has neither a value nor a default.
+	ErrMissingValue = errors.New("missing value")
+
+	// ErrInvalidValue is returned when the value of a parameter doesn't match its type.
+	ErrInvalidValue = errors.New("invalid value")
+
+	// ErrUnknownParameter is returned when a step references a parameter the pipeline doesn't declare.
+	ErrUnknownParameter = errors.New("unknown parameter")
+)
+
+// reference matches $(params.<name>) within a string.
+var reference = regexp.MustCompile(`\$\(params\.([a-zA-Z_][a-zA-Z0-9_-]*)\)`)
+
+// fields of a step template which are never substituted, they identify the step within the
+// pipeline or reference parameters themselves
+var identityFields = []string{"metadata", "dependsOn", "paramRefs"}
+
+// Resolve returns the value of each parameter, falling back to its default, parsed according to
+// the type of the parameter: a string, an int64 or a bool.
+func Resolve(params []corev1alpha1.PipelineParameter) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(params))
+	for _, p := range params {
+		var value string
+		switch {
+		case p.Value != nil:
+			value = *p.Value
+		case p.Default != nil:
+			value = *p.Default
+		default:
+			return nil, fmt.Errorf("%w for parameter %q", ErrMissingValue, p.Name)
+		}
+
+		parsed, err := parse(p.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w for parameter %q: %v", ErrInvalidValue, p.Name, err)
+		}
+		out[p.Name] = parsed
+	}
+	return out, nil
+}
+
+func parse(t corev1alpha1.ParameterType, value string) (interface{}, error) {
+	switch t {
+	case corev1alpha1.ParameterTypeInteger:
+		return strconv.ParseInt(value, 10, 64)
+	case corev1alpha1.ParameterTypeBoolean:
+		return strconv.ParseBool(value)
+	}
+	return value, nil
+}
+
+// Substitute returns a copy of the step template with the parameter references in its string
+// fields replaced by their values, and the fields of its spec listed in paramRefs set to the
+// value of their parameter. The name and dependencies of the step are left as is.
+func Substitute(tpl *corev1alpha1.StepTemplateSpec, values map[string]interface{}) (*corev1alpha1.StepTemplateSpec, error) {
+	data, err := json.Marshal(tpl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize step: %w", err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to deserialize step: %w", err)
+	}
+
+	for key, field := range fields {
+		if isIdentityField(key) {
+			continue
+		}
+		substituted, err := substitute(field, values)
+		if err != nil {
+			return nil, err
+		}
+		fields[key] = substituted
+	}
+
+	if len(tpl.ParamRefs) > 0 {
+		spec, _ := fields["spec"].(map[string]interface{})
+		if spec == nil {
+			spec = map[string]interface{}{}
+			fields["spec"] = spec
+		}
+		for path, name := range tpl.ParamRefs {
+			value, ok := values[name]
+			if !ok {
+				return nil, fmt.Errorf("%w %q", ErrUnknownParameter, name)
+			}
+			if err := setField(spec, path, value); err != nil {
+				return nil, fmt.Errorf("%w for field %q: %v", ErrInvalidValue, path, err)
+			}
+		}
+	}
+
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize step: %w", err)
+	}
+	out := &corev1alpha1.StepTemplateSpec{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// the template only holds known fields, unknown ones were set through paramRefs
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		if len(tpl.ParamRefs) > 0 {
+			return nil, fmt.Errorf("%w for paramRefs: %v", ErrInvalidValue, err)
+		}
+		return nil, fmt.Errorf("failed to deserialize step: %w", err)
+	}
+
+	return out, nil
+}
+
+// setField sets the field at the dotted path within the object to the value. Missing objects
+// along the path are created, elements of lists are addressed by their index.
+func setField(obj map[string]interface{}, path string, value interface{}) error {
+	keys := strings.Split(path, ".")
+	var current interface{} = obj
+	for i, key := range keys {
+		last := i == len(keys)-1
+		switch c := current.(type) {
+		case map[string]interface{}:
+			if last {
+				c[key] = value
+				return nil
+			}
+			if _, ok := c[key]; !ok {
+				c[key] = map[string]interface{}{}
+			}
+			current = c[key]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(c) {
+				return fmt.Errorf("no element %q in %q", key, strings.Join(keys[:i], "."))
+			}
+			if last {
+				c[index] = value
+				return nil
+			}
+			current = c[index]
+		default:
+			return fmt.Errorf("%q is not an object or a list", strings.Join(keys[:i], "."))
+		}
+	}
+	return nil
+}
+
+func substitute(field interface{}, values map[string]interface{}) (interface{}, error) {
+	switch f := field.(type) {
+	case string:
+		return substituteString(f, values)
+	case map[string]interface{}:
+		for k, v := range f {
+			substituted, err := substitute(v, values)
+			if err != nil {
+				return nil, err
+			}
+			f[k] = substituted
+		}
+		return f, nil
+	case []interface{}:
+		for i, v := range f {
+			substituted, err := substitute(v, values)
+			if err != nil {
+				return nil, err
+			}
+			f[i] = substituted
+		}
+		return f, nil
+	}
+	return field, nil
+}
+
+func substituteString(s string, values map[string]interface{}) (string, error) {
+	var err error
+	out := reference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := reference.FindStringSubmatch(ref)[1]
+		value, ok := values[name]
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("%w %q", ErrUnknownParameter, name)
+			}
+			return ref
+		}
+		return fmt.Sprint(value)
+	})
+	return out, err
+}
+
+func isIdentityField(key string) bool {
+	for _, f := range identityFields {
+		if f == key {
+			return true
+		}
+	}
+	return false
+}
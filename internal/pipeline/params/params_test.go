@@ -0,0 +1,179 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package params
+
+import (
+	"errors"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  []corev1alpha1.PipelineParameter
+		want    map[string]interface{}
+		wantErr error
+	}{{
+		name: "value overrides default",
+		params: []corev1alpha1.PipelineParameter{
+			{Name: "uri", Default: ptr("gs://models/v1"), Value: ptr("gs://models/v2")},
+			{Name: "workers", Type: corev1alpha1.ParameterTypeInteger, Default: ptr("4")},
+			{Name: "debug", Type: corev1alpha1.ParameterTypeBoolean, Value: ptr("true")},
+		},
+		want: map[string]interface{}{"uri": "gs://models/v2", "workers": int64(4), "debug": true},
+	}, {
+		name:    "missing value",
+		params:  []corev1alpha1.PipelineParameter{{Name: "uri"}},
+		wantErr: ErrMissingValue,
+	}, {
+		name:    "invalid integer",
+		params:  []corev1alpha1.PipelineParameter{{Name: "workers", Type: corev1alpha1.ParameterTypeInteger, Value: ptr("four")}},
+		wantErr: ErrInvalidValue,
+	}, {
+		name:    "invalid boolean",
+		params:  []corev1alpha1.PipelineParameter{{Name: "debug", Type: corev1alpha1.ParameterTypeBoolean, Value: ptr("maybe")}},
+		wantErr: ErrInvalidValue,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(tt.params)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve() error = %v, want %v", err, tt.wantErr)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("Resolve()[%q] = %#v, want %#v", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	tpl := &corev1alpha1.StepTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Name: "$(params.name)"},
+		Spec: corev1alpha1.StepSpec{
+			Model: &corev1alpha1.ModelSpec{URI: "$(params.uri)"},
+			PodSpec: corev1alpha1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:  "server",
+					Image: "torchserve:$(params.version)",
+					Args:  []string{"--workers=$(params.workers)", "--port=$(PORT)"},
+					Env:   []corev1.EnvVar{{Name: "VERSION", Value: "$(params.version)"}},
+				}},
+			},
+		},
+	}
+	values := map[string]interface{}{"uri": "gs://models/v2", "version": "0.8", "workers": int64(4), "name": "ignored"}
+
+	got, err := Substitute(tpl, values)
+	if err != nil {
+		t.Fatalf("Substitute() error = %v", err)
+	}
+
+	c := got.Spec.Containers[0]
+	if got.Spec.Model.URI != "gs://models/v2" || c.Image != "torchserve:0.8" || c.Env[0].Value != "0.8" {
+		t.Errorf("expected references to be substituted, got %+v", got.Spec)
+	}
+	if c.Args[0] != "--workers=4" || c.Args[1] != "--port=$(PORT)" {
+		t.Errorf("expected only parameter references in args to be substituted, got %v", c.Args)
+	}
+	if got.Name != "$(params.name)" {
+		t.Errorf("expected the name of the step to be left as is, got %q", got.Name)
+	}
+	if tpl.Spec.Model.URI != "$(params.uri)" {
+		t.Errorf("expected the template to be left unmodified")
+	}
+
+	tpl.Spec.Containers[0].Image = "torchserve:$(params.tag)"
+	if _, err := Substitute(tpl, values); !errors.Is(err, ErrUnknownParameter) {
+		t.Errorf("Substitute() error = %v, want %v", err, ErrUnknownParameter)
+	}
+}
+
+func TestSubstituteParamRefs(t *testing.T) {
+	tpl := &corev1alpha1.StepTemplateSpec{
+		Spec: corev1alpha1.StepSpec{
+			PodSpec: corev1alpha1.PodSpec{
+				Containers: []corev1.Container{{Name: "server", Image: "torchserve:0.8"}},
+			},
+		},
+		ParamRefs: map[string]string{
+			"minReplicas":                     "replicas",
+			"rollout.progressDeadlineSeconds": "deadline",
+			"containers.0.stdin":              "debug",
+		},
+	}
+	values := map[string]interface{}{"replicas": int64(3), "deadline": int64(120), "debug": true}
+
+	got, err := Substitute(tpl, values)
+	if err != nil {
+		t.Fatalf("Substitute() error = %v", err)
+	}
+	if got.Spec.MinReplicas == nil || *got.Spec.MinReplicas != 3 {
+		t.Errorf("expected minReplicas to be set from its parameter, got %v", got.Spec.MinReplicas)
+	}
+	if got.Spec.Rollout == nil || got.Spec.Rollout.ProgressDeadlineSeconds == nil || *got.Spec.Rollout.ProgressDeadlineSeconds != 120 {
+		t.Errorf("expected progressDeadlineSeconds to be set from its parameter, got %+v", got.Spec.Rollout)
+	}
+	if !got.Spec.Containers[0].Stdin || got.Spec.Containers[0].Image != "torchserve:0.8" {
+		t.Errorf("expected stdin to be set from its parameter, got %+v", got.Spec.Containers[0])
+	}
+	if tpl.Spec.MinReplicas != nil {
+		t.Errorf("expected the template to be left unmodified")
+	}
+
+	tests := []struct {
+		name      string
+		paramRefs map[string]string
+		wantErr   error
+	}{{
+		name:      "unknown parameter",
+		paramRefs: map[string]string{"minReplicas": "workers"},
+		wantErr:   ErrUnknownParameter,
+	}, {
+		name:      "mismatched type",
+		paramRefs: map[string]string{"minReplicas": "debug"},
+		wantErr:   ErrInvalidValue,
+	}, {
+		name:      "unknown field",
+		paramRefs: map[string]string{"replicas": "replicas"},
+		wantErr:   ErrInvalidValue,
+	}, {
+		name:      "missing list element",
+		paramRefs: map[string]string{"containers.1.stdin": "debug"},
+		wantErr:   ErrInvalidValue,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl := tpl.DeepCopy()
+			tpl.ParamRefs = tt.paramRefs
+			if _, err := Substitute(tpl, values); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Substitute() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
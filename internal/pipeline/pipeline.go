@@ -5,7 +5,11 @@ import (
 	"fmt"
 
 	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/pipeline/reconcilers/piper"
+	"github.com/dreamstax/kai/internal/pipeline/reconcilers/revision"
 	"github.com/dreamstax/kai/internal/pipeline/reconcilers/step"
+	piperclient "github.com/dreamstax/kai/internal/piper"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierr "k8s.io/apimachinery/pkg/api/errors"
 
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -21,11 +25,15 @@ const (
 
 type Client struct {
 	kclient kclient.Client
+	piperc  *piperclient.Client
 }
 
-func New(client kclient.Client) *Client {
+// New returns a client reconciling pipelines. piperc may be nil in which case pipelines
+// are not registered with kai-piper.
+func New(client kclient.Client, piperc *piperclient.Client) *Client {
 	return &Client{
 		kclient: client,
+		piperc:  piperc,
 	}
 }
 
@@ -39,14 +47,38 @@ func (c *Client) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result,
 		return ctrl.Result{}, fmt.Errorf("failed to retrieve latest pipeline %s: %w", req.NamespacedName, err)
 	}
 
-	// TODO: determine resources and reconciler for piper
+	if !p.DeletionTimestamp.IsZero() {
+		if err := piper.NewReconciler(c.kclient, c.piperc).Finalize(ctx, p); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	original := p.DeepCopy()
+
+	var reconcileErr error
 	for _, rec := range []func(context.Context, *corev1alpha1.Pipeline) error{
+		// snapshot the spec first, a rollback replaces the spec the steps are made from
+		revision.NewReconciler(c.kclient).Reconcile,
 		step.NewReconciler(c.kclient).Reconcile,
+		// piper relies on the step endpoints recorded by the step reconciler
+		piper.NewReconciler(c.kclient, c.piperc).Reconcile,
 	} {
-		if err := rec(ctx, p); err != nil {
-			return ctrl.Result{}, err
+		if reconcileErr = rec(ctx, p); reconcileErr != nil {
+			break
+		}
+	}
+	if reconcileErr == nil {
+		p.Status.ObservedGeneration = p.Generation
+	}
+
+	// reconcilers record what they observe on the in-memory pipeline, persist it even
+	// if reconciliation failed part way through
+	if !equality.Semantic.DeepEqual(original.Status, p.Status) {
+		if err := c.kclient.Status().Update(ctx, p); err != nil && reconcileErr == nil {
+			reconcileErr = fmt.Errorf("failed to update status of pipeline %s: %w", req.NamespacedName, err)
 		}
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{}, reconcileErr
 }
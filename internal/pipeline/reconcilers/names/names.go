@@ -17,6 +17,8 @@ limitations under the License.
 package names
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 
 	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
@@ -25,6 +27,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"knative.dev/pkg/kmap"
+	"knative.dev/pkg/kmeta"
 )
 
 var (
@@ -36,16 +39,43 @@ var (
 	excludeAnnotations = sets.NewString()
 )
 
-// StepName returns the name for a step based on pipeline and index of step within a pipeline.
-// This is somewhat crude currently. Users may want to name these steps something more
-// descriptive and maybe we should support that?
-func StepName(p *corev1alpha1.Pipeline, idx int) types.NamespacedName {
+// StepName returns the name for a step based on the pipeline and the key of the step within
+// the pipeline (see StepKey). Named steps keep their name regardless of their position.
+func StepName(p *corev1alpha1.Pipeline, key string) types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: p.Namespace,
+		Name:      fmt.Sprintf("%s-%s", p.GetName(), key),
+	}
+}
+
+// LegacyStepName returns the name steps were given before they could be named, based on the
+// index of the step within the pipeline.
+func LegacyStepName(p *corev1alpha1.Pipeline, idx int) types.NamespacedName {
 	return types.NamespacedName{
 		Namespace: p.Namespace,
 		Name:      fmt.Sprintf("%s-step-%d", p.GetName(), idx),
 	}
 }
 
+// FallbackStepName returns the name for a step whose name from StepName is already taken by another
+// step of the same pipeline, which happens once a named step adopted the legacy name of an unnamed one.
+func FallbackStepName(p *corev1alpha1.Pipeline, key string) types.NamespacedName {
+	sum := sha256.Sum256([]byte(key))
+	return types.NamespacedName{
+		Namespace: p.Namespace,
+		Name:      kmeta.ChildName(fmt.Sprintf("%s-%s-", p.GetName(), key), hex.EncodeToString(sum[:])[:5]),
+	}
+}
+
+// StepKey returns the name used to reference a step from other steps within a pipeline.
+// Steps are referenced by their template name, falling back to the index of the step.
+func StepKey(s *corev1alpha1.StepTemplateSpec, idx int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("step-%d", idx)
+}
+
 func MakeLabels(p *corev1alpha1.Pipeline) map[string]string {
 	labels := kmap.Filter(p.GetLabels(), excludeLabels.Has)
 	labels = kmap.Union(labels, map[string]string{
@@ -56,6 +86,30 @@ func MakeLabels(p *corev1alpha1.Pipeline) map[string]string {
 	return labels
 }
 
+// MakeStepLabels returns the labels for a step created by the pipeline, including the key
+// identifying the step within the pipeline.
+func MakeStepLabels(p *corev1alpha1.Pipeline, key string) map[string]string {
+	return kmap.Union(MakeLabels(p), map[string]string{
+		kai.PipelineStepLabelKey: key,
+	})
+}
+
+// RevisionName returns the name of the revision snapshotting a spec of the pipeline with the given hash.
+func RevisionName(p *corev1alpha1.Pipeline, hash string) types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: p.Namespace,
+		Name:      fmt.Sprintf("%s-%s", p.GetName(), hash),
+	}
+}
+
+// MakeRevisionLabels returns the labels for a revision of the pipeline, including the hash of
+// the spec it snapshots.
+func MakeRevisionLabels(p *corev1alpha1.Pipeline, hash string) map[string]string {
+	return kmap.Union(MakeLabels(p), map[string]string{
+		kai.RevisionHashLabelKey: hash,
+	})
+}
+
 func MakeSelector(p *corev1alpha1.Pipeline) *metav1.LabelSelector {
 	return &metav1.LabelSelector{
 		MatchLabels: map[string]string{
@@ -0,0 +1,214 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package piper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	"github.com/dreamstax/kai/internal/piper"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reasons surfaced on the Registered condition
+const (
+	reasonRegistered          = "Registered"
+	reasonWaitingForEndpoints = "WaitingForEndpoints"
+	reasonRegistrationFailed  = "RegistrationFailed"
+)
+
+type Reconciler struct {
+	client kclient.Client
+	piper  *piper.Client
+}
+
+// NewReconciler returns a reconciler registering pipelines with the given piper client.
+// When piperc is nil the integration with piper is disabled.
+func NewReconciler(client kclient.Client, piperc *piper.Client) *Reconciler {
+	return &Reconciler{
+		client: client,
+		piper:  piperc,
+	}
+}
+
+// Reconcile registers the pipeline definition with piper once the endpoints of all of its
+// steps are known and keeps it up to date as the pipeline changes.
+func (r *Reconciler) Reconcile(ctx context.Context, p *corev1alpha1.Pipeline) error {
+	if r.piper == nil {
+		return nil
+	}
+
+	if !controllerutil.ContainsFinalizer(p, kai.PiperFinalizer) {
+		// updating the pipeline replaces it with the stored object, keep the status
+		// recorded by earlier reconcilers
+		status := p.Status.DeepCopy()
+		controllerutil.AddFinalizer(p, kai.PiperFinalizer)
+		if err := r.client.Update(ctx, p); err != nil {
+			return fmt.Errorf("failed to add finalizer to pipeline %q: %w", p.NamespacedName(), err)
+		}
+		p.Status = *status
+	}
+
+	// an invalid graph is surfaced by the TopologyResolved condition
+	if p.Status.Topology == nil {
+		return nil
+	}
+
+	def, pending := makeDefinition(p)
+	if len(pending) > 0 {
+		meta.SetStatusCondition(&p.Status.Conditions, metav1.Condition{
+			Type:               corev1alpha1.PipelineConditionRegistered,
+			Status:             metav1.ConditionUnknown,
+			ObservedGeneration: p.Generation,
+			Reason:             reasonWaitingForEndpoints,
+			Message:            fmt.Sprintf("waiting for endpoints of steps %v", pending),
+		})
+		return nil
+	}
+
+	hash, err := hashDefinition(def)
+	if err != nil {
+		return err
+	}
+
+	if p.Status.Piper == nil {
+		p.Status.Piper = &corev1alpha1.PiperStatus{}
+	}
+	if p.Status.Piper.PipelineID != "" && p.Status.Piper.DefinitionHash == hash {
+		return nil
+	}
+
+	registered, err := r.register(ctx, p.Status.Piper.PipelineID, def)
+	if err != nil {
+		meta.SetStatusCondition(&p.Status.Conditions, metav1.Condition{
+			Type:               corev1alpha1.PipelineConditionRegistered,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: p.Generation,
+			Reason:             reasonRegistrationFailed,
+			Message:            err.Error(),
+		})
+		return err
+	}
+
+	status := p.Status.DeepCopy()
+	created := registered.ID != p.Status.Piper.PipelineID
+	p.Status.Piper.PipelineID = registered.ID
+	p.Status.Piper.DefinitionHash = hash
+	meta.SetStatusCondition(&p.Status.Conditions, metav1.Condition{
+		Type:               corev1alpha1.PipelineConditionRegistered,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: p.Generation,
+		Reason:             reasonRegistered,
+		Message:            fmt.Sprintf("registered with piper as %q", registered.ID),
+	})
+
+	// record a newly created pipeline right away so failures from here on update it rather than
+	// registering another one
+	if created {
+		if err := r.client.Status().Update(ctx, p); err != nil {
+			p.Status = *status
+			// the pipeline doesn't know about the registration, don't leave it behind
+			if derr := r.piper.DeletePipeline(ctx, registered.ID); derr != nil {
+				log.FromContext(ctx).Error(derr, "failed to delete unrecorded piper pipeline", "pipelineID", registered.ID)
+			}
+			return fmt.Errorf("failed to record piper pipeline %q on pipeline %s: %w", registered.ID, p.NamespacedName(), err)
+		}
+	}
+
+	return nil
+}
+
+// Finalize deregisters the pipeline from piper and releases the pipeline for deletion.
+func (r *Reconciler) Finalize(ctx context.Context, p *corev1alpha1.Pipeline) error {
+	if !controllerutil.ContainsFinalizer(p, kai.PiperFinalizer) {
+		return nil
+	}
+
+	if r.piper != nil && p.Status.Piper != nil && p.Status.Piper.PipelineID != "" {
+		err := r.piper.DeletePipeline(ctx, p.Status.Piper.PipelineID)
+		if err != nil && !errors.Is(err, piper.ErrNotFound) {
+			return err
+		}
+	}
+
+	controllerutil.RemoveFinalizer(p, kai.PiperFinalizer)
+	if err := r.client.Update(ctx, p); err != nil {
+		return fmt.Errorf("failed to remove finalizer from pipeline %q: %w", p.NamespacedName(), err)
+	}
+
+	return nil
+}
+
+// register creates the pipeline within piper or updates it if it was registered previously.
+func (r *Reconciler) register(ctx context.Context, id string, def *piper.Pipeline) (*piper.Pipeline, error) {
+	if id != "" {
+		def.ID = id
+		out, err := r.piper.UpdatePipeline(ctx, def)
+		if !errors.Is(err, piper.ErrNotFound) {
+			return out, err
+		}
+		// piper lost track of the pipeline, register it again
+		def.ID = ""
+	}
+
+	return r.piper.CreatePipeline(ctx, def)
+}
+
+// makeDefinition builds the piper definition of the pipeline from its resolved topology and
+// the endpoints of its steps. The names of steps whose endpoint is not yet known are returned.
+func makeDefinition(p *corev1alpha1.Pipeline) (*piper.Pipeline, []string) {
+	endpoints := make(map[string]string, len(p.Status.Steps))
+	for _, s := range p.Status.Steps {
+		endpoints[s.Name] = s.URL
+	}
+
+	def := &piper.Pipeline{
+		Name:  fmt.Sprintf("%s/%s", p.Namespace, p.Name),
+		Steps: make([]piper.Step, 0, len(p.Status.Topology)),
+	}
+	pending := []string{}
+	for _, t := range p.Status.Topology {
+		if endpoints[t.Name] == "" {
+			pending = append(pending, t.Name)
+			continue
+		}
+		def.Steps = append(def.Steps, piper.Step{
+			Name:      t.Name,
+			Endpoint:  endpoints[t.Name],
+			DependsOn: t.DependsOn,
+		})
+	}
+
+	return def, pending
+}
+
+func hashDefinition(def *piper.Pipeline) (string, error) {
+	b, err := json.Marshal(def)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash pipeline definition: %w", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package piper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	"github.com/dreamstax/kai/internal/piper"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// fakePiper is a local stand-in for the piper API storing pipelines in memory.
+type fakePiper struct {
+	mu        sync.Mutex
+	nextID    int
+	pipelines map[string]piper.Pipeline
+}
+
+func newFakePiper() *fakePiper {
+	return &fakePiper{pipelines: map[string]piper.Pipeline{}}
+}
+
+func (f *fakePiper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1alpha1/pipelines/")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1alpha1/pipelines":
+		p := piper.Pipeline{}
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		f.nextID++
+		p.ID = fmt.Sprintf("pipeline-%d", f.nextID)
+		f.pipelines[p.ID] = p
+		_ = json.NewEncoder(w).Encode(p)
+	case r.Method == http.MethodPut:
+		if _, ok := f.pipelines[id]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		p := piper.Pipeline{}
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		f.pipelines[id] = p
+		_ = json.NewEncoder(w).Encode(p)
+	case r.Method == http.MethodDelete:
+		if _, ok := f.pipelines[id]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(f.pipelines, id)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func newPipeline() *corev1alpha1.Pipeline {
+	return &corev1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{Name: "ensemble", Namespace: "default"},
+		Status: corev1alpha1.PipelineStatus{
+			Topology: []corev1alpha1.StepTopology{
+				{Name: "features", Level: 0},
+				{Name: "classifier", DependsOn: []string{"features"}, Level: 1},
+			},
+			Steps: []corev1alpha1.PipelineStepStatus{
+				{Name: "features", URL: "http://ensemble-features-service.default.svc.cluster.local"},
+				{Name: "classifier", URL: "http://ensemble-classifier-service.default.svc.cluster.local"},
+			},
+		},
+	}
+}
+
+func newReconciler(t *testing.T, p *corev1alpha1.Pipeline, server *httptest.Server, funcs ...interceptor.Funcs) *Reconciler {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	builder := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(p).
+		WithStatusSubresource(p)
+	for _, f := range funcs {
+		builder = builder.WithInterceptorFuncs(f)
+	}
+	kc := builder.Build()
+
+	pc, err := piper.New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewReconciler(kc, pc)
+}
+
+func TestReconcileRegistersPipeline(t *testing.T) {
+	fp := newFakePiper()
+	server := httptest.NewServer(fp)
+	defer server.Close()
+
+	p := newPipeline()
+	r := newReconciler(t, p, server)
+
+	if err := r.Reconcile(context.Background(), p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !controllerutil.ContainsFinalizer(p, kai.PiperFinalizer) {
+		t.Errorf("expected finalizer %q to be added", kai.PiperFinalizer)
+	}
+	if p.Status.Piper == nil || p.Status.Piper.PipelineID == "" {
+		t.Fatalf("expected piper pipeline id to be recorded, got %+v", p.Status.Piper)
+	}
+	if !meta.IsStatusConditionTrue(p.Status.Conditions, corev1alpha1.PipelineConditionRegistered) {
+		t.Errorf("expected pipeline to be registered, got %+v", p.Status.Conditions)
+	}
+
+	registered := fp.pipelines[p.Status.Piper.PipelineID]
+	if len(registered.Steps) != 2 || registered.Steps[1].DependsOn[0] != "features" {
+		t.Errorf("unexpected registered definition %+v", registered)
+	}
+
+	// changing an endpoint updates the existing definition
+	id := p.Status.Piper.PipelineID
+	p.Status.Steps[1].URL = "http://ensemble-classifier-service.default.svc.cluster.local:8080"
+	if err := r.Reconcile(context.Background(), p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Status.Piper.PipelineID != id {
+		t.Errorf("expected pipeline to keep id %q, got %q", id, p.Status.Piper.PipelineID)
+	}
+	if got := fp.pipelines[id].Steps[1].Endpoint; got != p.Status.Steps[1].URL {
+		t.Errorf("expected endpoint to be updated to %q, got %q", p.Status.Steps[1].URL, got)
+	}
+}
+
+func TestReconcileRecordsPipelineID(t *testing.T) {
+	ctx := context.Background()
+	fp := newFakePiper()
+	server := httptest.NewServer(fp)
+	defer server.Close()
+
+	// the id is stored on its own, before the status of the pipeline is persisted
+	p := newPipeline()
+	r := newReconciler(t, p, server)
+	if err := r.Reconcile(ctx, p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stored := &corev1alpha1.Pipeline{}
+	if err := r.client.Get(ctx, kclient.ObjectKeyFromObject(p), stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status.Piper == nil || stored.Status.Piper.PipelineID != p.Status.Piper.PipelineID {
+		t.Errorf("expected piper pipeline id %q to be stored, got %+v", p.Status.Piper.PipelineID, stored.Status.Piper)
+	}
+
+	// a registration which can't be recorded is removed from piper
+	p = newPipeline()
+	conflict := errors.New("conflict")
+	r = newReconciler(t, p, server, interceptor.Funcs{
+		SubResourceUpdate: func(context.Context, kclient.Client, string, kclient.Object, ...kclient.SubResourceUpdateOption) error {
+			return conflict
+		},
+	})
+	if err := r.Reconcile(ctx, p); !errors.Is(err, conflict) {
+		t.Fatalf("expected %v, got %v", conflict, err)
+	}
+	if p.Status.Piper != nil && p.Status.Piper.PipelineID != "" {
+		t.Errorf("expected no piper pipeline id to be recorded, got %q", p.Status.Piper.PipelineID)
+	}
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if len(fp.pipelines) != 1 {
+		t.Errorf("expected the unrecorded registration to be deleted, got %d pipelines", len(fp.pipelines))
+	}
+}
+
+func TestReconcileWaitsForEndpoints(t *testing.T) {
+	fp := newFakePiper()
+	server := httptest.NewServer(fp)
+	defer server.Close()
+
+	p := newPipeline()
+	p.Status.Steps[1].URL = ""
+	r := newReconciler(t, p, server)
+
+	if err := r.Reconcile(context.Background(), p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fp.pipelines) != 0 {
+		t.Errorf("expected no pipelines to be registered, got %d", len(fp.pipelines))
+	}
+	cond := meta.FindStatusCondition(p.Status.Conditions, corev1alpha1.PipelineConditionRegistered)
+	if cond == nil || cond.Reason != reasonWaitingForEndpoints {
+		t.Errorf("expected registration to wait for endpoints, got %+v", cond)
+	}
+}
+
+func TestFinalizeDeregistersPipeline(t *testing.T) {
+	fp := newFakePiper()
+	server := httptest.NewServer(fp)
+	defer server.Close()
+
+	p := newPipeline()
+	r := newReconciler(t, p, server)
+
+	if err := r.Reconcile(context.Background(), p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Finalize(context.Background(), p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fp.pipelines) != 0 {
+		t.Errorf("expected pipeline to be deregistered, got %d pipelines", len(fp.pipelines))
+	}
+	if controllerutil.ContainsFinalizer(p, kai.PiperFinalizer) {
+		t.Errorf("expected finalizer %q to be removed", kai.PiperFinalizer)
+	}
+}
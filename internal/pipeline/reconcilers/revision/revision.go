@@ -0,0 +1,288 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	"github.com/dreamstax/kai/internal/pipeline/reconcilers/names"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"knative.dev/pkg/kmeta"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// length of the spec hash used to name revisions
+const hashLength = 10
+
+type Reconciler struct {
+	client kclient.Client
+}
+
+func NewReconciler(client kclient.Client) *Reconciler {
+	return &Reconciler{
+		client: client,
+	}
+}
+
+// Reconcile snapshots the spec of the pipeline into an immutable revision and records the
+// current and previous revisions in the status. When a rollback is requested the spec of the
+// target revision is restored before the snapshot is taken.
+func (r *Reconciler) Reconcile(ctx context.Context, p *corev1alpha1.Pipeline) error {
+	revisions, err := r.listRevisions(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	if p.Spec.RollbackTo != nil {
+		if err := r.rollback(ctx, p, revisions); err != nil {
+			return err
+		}
+	}
+
+	hash, data, err := hashSpec(&p.Spec)
+	if err != nil {
+		return err
+	}
+
+	var latest int64
+	for _, rev := range revisions {
+		if rev.Revision > latest {
+			latest = rev.Revision
+		}
+	}
+
+	current, err := findRevision(revisions, hash, &p.Spec)
+	if err != nil {
+		return err
+	}
+	switch {
+	case current == nil:
+		current, err = r.createRevision(ctx, p, hash, data, latest+1)
+		if err != nil {
+			return err
+		}
+		revisions = append(revisions, current)
+	case current.Revision < latest:
+		// returning to an earlier spec makes its revision the latest again, the same as
+		// Deployments reusing their old ReplicaSets
+		current.Revision = latest + 1
+		if err := r.client.Update(ctx, current); err != nil {
+			return fmt.Errorf("failed to update revision %q of pipeline %q: %w", current.Name, p.NamespacedName(), err)
+		}
+	}
+
+	if p.Status.CurrentRevision != nil && p.Status.CurrentRevision.Name != current.Name {
+		p.Status.PreviousRevision = p.Status.CurrentRevision
+	}
+	p.Status.CurrentRevision = &corev1alpha1.PipelineRevisionStatus{
+		Name:     current.Name,
+		Revision: current.Revision,
+	}
+
+	return r.pruneRevisions(ctx, p, revisions)
+}
+
+// listRevisions returns the revisions of the pipeline ordered from oldest to newest.
+func (r *Reconciler) listRevisions(ctx context.Context, p *corev1alpha1.Pipeline) ([]*appsv1.ControllerRevision, error) {
+	selector, err := metav1.LabelSelectorAsSelector(names.MakeSelector(p))
+	if err != nil {
+		return nil, fmt.Errorf("failed to make selector for pipeline %q: %w", p.NamespacedName(), err)
+	}
+
+	list := &appsv1.ControllerRevisionList{}
+	err = r.client.List(ctx, list, kclient.InNamespace(p.Namespace), kclient.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions of pipeline %q: %w", p.NamespacedName(), err)
+	}
+
+	revisions := make([]*appsv1.ControllerRevision, 0, len(list.Items))
+	for i := range list.Items {
+		if metav1.IsControlledBy(&list.Items[i], p) {
+			revisions = append(revisions, &list.Items[i])
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+
+	return revisions, nil
+}
+
+// rollback replaces the spec of the pipeline with the one recorded by the requested revision
+// and clears the request.
+func (r *Reconciler) rollback(ctx context.Context, p *corev1alpha1.Pipeline, revisions []*appsv1.ControllerRevision) error {
+	logger := log.FromContext(ctx)
+
+	target := p.Spec.RollbackTo.Revision
+	if target == 0 && p.Status.PreviousRevision != nil {
+		target = p.Status.PreviousRevision.Revision
+	}
+
+	var stored *corev1alpha1.PipelineSpec
+	for _, rev := range revisions {
+		if rev.Revision != target {
+			continue
+		}
+		stored = &corev1alpha1.PipelineSpec{}
+		if err := json.Unmarshal(rev.Data.Raw, stored); err != nil {
+			return fmt.Errorf("failed to decode revision %q of pipeline %q: %w", rev.Name, p.NamespacedName(), err)
+		}
+		break
+	}
+
+	spec := p.Spec.DeepCopy()
+	if stored == nil {
+		// the request can't be satisfied, drop it so the pipeline keeps running as is
+		logger.Info("revision to roll back to not found, ignoring rollback", "pipeline", p.NamespacedName(), "revision", target)
+	} else {
+		// only the fields recorded by revisions are restored, settings of the pipeline itself
+		// such as its history limit are kept
+		logger.Info("rolling back pipeline", "pipeline", p.NamespacedName(), "revision", target)
+		spec.Steps = stored.Steps
+		spec.Parameters = stored.Parameters
+		spec.Defaults = stored.Defaults
+	}
+	spec.RollbackTo = nil
+
+	// updating the pipeline replaces it with the stored object, keep the status recorded so far
+	status := p.Status.DeepCopy()
+	p.Spec = *spec
+	if err := r.client.Update(ctx, p); err != nil {
+		return fmt.Errorf("failed to roll back pipeline %q: %w", p.NamespacedName(), err)
+	}
+	p.Status = *status
+
+	return nil
+}
+
+func (r *Reconciler) createRevision(ctx context.Context, p *corev1alpha1.Pipeline, hash string, data []byte, revision int64) (*appsv1.ControllerRevision, error) {
+	name := names.RevisionName(p, hash)
+	rev := &appsv1.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name.Name,
+			Namespace:       name.Namespace,
+			Labels:          names.MakeRevisionLabels(p, hash),
+			Annotations:     names.MakeAnnotations(p),
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(p)},
+		},
+		Data:     runtime.RawExtension{Raw: data},
+		Revision: revision,
+	}
+
+	if err := r.client.Create(ctx, rev); err != nil {
+		return nil, fmt.Errorf("failed to create revision %q of pipeline %q: %w", name.Name, p.NamespacedName(), err)
+	}
+
+	return rev, nil
+}
+
+// pruneRevisions deletes the oldest revisions beyond the history limit. The current and
+// previous revisions are always kept.
+func (r *Reconciler) pruneRevisions(ctx context.Context, p *corev1alpha1.Pipeline, revisions []*appsv1.ControllerRevision) error {
+	if p.Spec.RevisionHistoryLimit == nil {
+		return nil
+	}
+
+	var history []*appsv1.ControllerRevision
+	for _, rev := range revisions {
+		if rev.Name == p.Status.CurrentRevision.Name {
+			continue
+		}
+		if p.Status.PreviousRevision != nil && rev.Name == p.Status.PreviousRevision.Name {
+			continue
+		}
+		history = append(history, rev)
+	}
+
+	limit := int(*p.Spec.RevisionHistoryLimit)
+	if p.Status.PreviousRevision != nil && limit > 0 {
+		// the previous revision counts towards the history
+		limit--
+	}
+	if len(history) <= limit {
+		return nil
+	}
+
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Revision < history[j].Revision
+	})
+	for _, rev := range history[:len(history)-limit] {
+		err := r.client.Delete(ctx, rev)
+		if kclient.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete revision %q of pipeline %q: %w", rev.Name, p.NamespacedName(), err)
+		}
+	}
+
+	return nil
+}
+
+// snapshotSpec returns the part of the spec recorded by a revision, the fields determining the
+// steps of the pipeline. Settings such as the history limit or the retention of removed steps
+// don't create revisions.
+func snapshotSpec(spec *corev1alpha1.PipelineSpec) *corev1alpha1.PipelineSpec {
+	in := spec.DeepCopy()
+	return &corev1alpha1.PipelineSpec{
+		Steps:      in.Steps,
+		Parameters: in.Parameters,
+		Defaults:   in.Defaults,
+	}
+}
+
+// hashSpec returns the serialized snapshot of the spec stored by a revision along with its hash.
+func hashSpec(spec *corev1alpha1.PipelineSpec) (string, []byte, error) {
+	snapshot := snapshotSpec(spec)
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to serialize pipeline spec: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:hashLength], data, nil
+}
+
+// findRevision returns the revision snapshotting the given spec, nil if there is none.
+func findRevision(revisions []*appsv1.ControllerRevision, hash string, spec *corev1alpha1.PipelineSpec) (*appsv1.ControllerRevision, error) {
+	snapshot := snapshotSpec(spec)
+
+	for _, rev := range revisions {
+		if rev.Labels[kai.RevisionHashLabelKey] != hash {
+			continue
+		}
+		stored := &corev1alpha1.PipelineSpec{}
+		if err := json.Unmarshal(rev.Data.Raw, stored); err != nil {
+			return nil, fmt.Errorf("failed to decode revision %q: %w", rev.Name, err)
+		}
+		// revisions are immutable, never reuse one recording a different spec
+		if !equality.Semantic.DeepEqual(stored, snapshot) {
+			return nil, fmt.Errorf("revision %q does not match the spec it is named after", rev.Name)
+		}
+		return rev, nil
+	}
+	return nil, nil
+}
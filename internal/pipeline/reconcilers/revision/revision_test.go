@@ -0,0 +1,228 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newPipeline() *corev1alpha1.Pipeline {
+	limit := int32(1)
+	return &corev1alpha1.Pipeline{
+		TypeMeta:   metav1.TypeMeta{APIVersion: corev1alpha1.GroupVersion.String(), Kind: "Pipeline"},
+		ObjectMeta: metav1.ObjectMeta{Name: "ensemble", Namespace: "default", UID: "ensemble-uid"},
+		Spec: corev1alpha1.PipelineSpec{
+			Steps: []*corev1alpha1.StepTemplateSpec{
+				{ObjectMeta: metav1.ObjectMeta{Name: "classifier"}, Spec: corev1alpha1.StepSpec{Model: &corev1alpha1.ModelSpec{URI: "gs://models/v1"}}},
+			},
+			RevisionHistoryLimit: &limit,
+		},
+	}
+}
+
+func newReconciler(t *testing.T, p *corev1alpha1.Pipeline) (*Reconciler, kclient.Client) {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	kc := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(p).
+		WithStatusSubresource(p).
+		Build()
+
+	return NewReconciler(kc), kc
+}
+
+// setModel changes the model of the pipeline's step, persisting the edit like a user would.
+func setModel(t *testing.T, kc kclient.Client, p *corev1alpha1.Pipeline, uri string) {
+	t.Helper()
+
+	p.Spec.Steps[0].Spec.Model.URI = uri
+	if err := kc.Update(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reconcile runs the reconciler and persists the status the same as the pipeline client.
+func reconcile(t *testing.T, r *Reconciler, kc kclient.Client, p *corev1alpha1.Pipeline) {
+	t.Helper()
+
+	if err := r.Reconcile(context.Background(), p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := kc.Status().Update(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countRevisions(t *testing.T, kc kclient.Client) int {
+	t.Helper()
+
+	list := &appsv1.ControllerRevisionList{}
+	if err := kc.List(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+	return len(list.Items)
+}
+
+func TestReconcileRecordsRevisions(t *testing.T) {
+	p := newPipeline()
+	r, kc := newReconciler(t, p)
+
+	reconcile(t, r, kc, p)
+	first := p.Status.CurrentRevision
+	if first == nil || first.Revision != 1 {
+		t.Fatalf("expected first revision to be recorded, got %+v", first)
+	}
+
+	// reconciling an unchanged spec keeps the revision
+	reconcile(t, r, kc, p)
+	if *p.Status.CurrentRevision != *first || p.Status.PreviousRevision != nil {
+		t.Errorf("expected revision to be unchanged, got current %+v previous %+v", p.Status.CurrentRevision, p.Status.PreviousRevision)
+	}
+
+	setModel(t, kc, p, "gs://models/v2")
+	reconcile(t, r, kc, p)
+	if p.Status.CurrentRevision.Revision != 2 || *p.Status.PreviousRevision != *first {
+		t.Errorf("expected revision 2 following %+v, got current %+v previous %+v", first, p.Status.CurrentRevision, p.Status.PreviousRevision)
+	}
+
+	// with a history limit of 1 only the current and previous revisions are kept
+	setModel(t, kc, p, "gs://models/v3")
+	reconcile(t, r, kc, p)
+	if got := countRevisions(t, kc); got != 2 {
+		t.Errorf("expected 2 revisions to be kept, got %d", got)
+	}
+}
+
+func TestReconcileRollsBack(t *testing.T) {
+	ctx := context.Background()
+	p := newPipeline()
+	r, kc := newReconciler(t, p)
+
+	reconcile(t, r, kc, p)
+	first := p.Status.CurrentRevision.Name
+
+	setModel(t, kc, p, "gs://models/v2")
+	reconcile(t, r, kc, p)
+
+	// rolling back without a revision returns to the previous one
+	p.Spec.RollbackTo = &corev1alpha1.PipelineRollback{}
+	if err := kc.Update(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	reconcile(t, r, kc, p)
+
+	stored := &corev1alpha1.Pipeline{}
+	if err := kc.Get(ctx, p.NamespacedName(), stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Spec.RollbackTo != nil {
+		t.Errorf("expected rollback request to be cleared")
+	}
+	if got := stored.Spec.Steps[0].Spec.Model.URI; got != "gs://models/v1" {
+		t.Errorf("expected model to be rolled back to gs://models/v1, got %q", got)
+	}
+	if p.Status.CurrentRevision.Name != first || p.Status.CurrentRevision.Revision != 3 {
+		t.Errorf("expected revision %q to be reused as revision 3, got %+v", first, p.Status.CurrentRevision)
+	}
+	if got := countRevisions(t, kc); got != 2 {
+		t.Errorf("expected rollback to reuse the existing revision, got %d revisions", got)
+	}
+}
+
+func TestReconcileIgnoresUnknownRollback(t *testing.T) {
+	ctx := context.Background()
+	p := newPipeline()
+	p.Spec.RollbackTo = &corev1alpha1.PipelineRollback{Revision: 7}
+	r, kc := newReconciler(t, p)
+
+	reconcile(t, r, kc, p)
+
+	stored := &corev1alpha1.Pipeline{}
+	if err := kc.Get(ctx, p.NamespacedName(), stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Spec.RollbackTo != nil {
+		t.Errorf("expected rollback request to be cleared")
+	}
+	if got := stored.Spec.Steps[0].Spec.Model.URI; got != "gs://models/v1" {
+		t.Errorf("expected spec to be unchanged, got model %q", got)
+	}
+}
+
+func TestReconcileIgnoresPipelineSettings(t *testing.T) {
+	ctx := context.Background()
+	p := newPipeline()
+	r, kc := newReconciler(t, p)
+
+	reconcile(t, r, kc, p)
+	first := *p.Status.CurrentRevision
+
+	// settings which don't affect the steps don't create revisions
+	limit := int32(5)
+	p.Spec.RevisionHistoryLimit = &limit
+	p.Spec.StepRetentionPolicy = corev1alpha1.StepRetentionPolicyRetain
+	if err := kc.Update(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	reconcile(t, r, kc, p)
+	if *p.Status.CurrentRevision != first || p.Status.PreviousRevision != nil {
+		t.Errorf("expected revision to be unchanged, got current %+v previous %+v", p.Status.CurrentRevision, p.Status.PreviousRevision)
+	}
+	if got := countRevisions(t, kc); got != 1 {
+		t.Errorf("expected 1 revision, got %d", got)
+	}
+
+	// and are kept when rolling back
+	setModel(t, kc, p, "gs://models/v2")
+	reconcile(t, r, kc, p)
+	p.Spec.RollbackTo = &corev1alpha1.PipelineRollback{Revision: first.Revision}
+	if err := kc.Update(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	reconcile(t, r, kc, p)
+
+	stored := &corev1alpha1.Pipeline{}
+	if err := kc.Get(ctx, p.NamespacedName(), stored); err != nil {
+		t.Fatal(err)
+	}
+	if got := stored.Spec.Steps[0].Spec.Model.URI; got != "gs://models/v1" {
+		t.Errorf("expected model to be rolled back to gs://models/v1, got %q", got)
+	}
+	if stored.Spec.RevisionHistoryLimit == nil || *stored.Spec.RevisionHistoryLimit != 5 ||
+		stored.Spec.StepRetentionPolicy != corev1alpha1.StepRetentionPolicyRetain {
+		t.Errorf("expected pipeline settings to be kept, got limit %v policy %q", stored.Spec.RevisionHistoryLimit, stored.Spec.StepRetentionPolicy)
+	}
+	if p.Status.CurrentRevision.Name != first.Name {
+		t.Errorf("expected revision %q to be reused, got %+v", first.Name, p.Status.CurrentRevision)
+	}
+}
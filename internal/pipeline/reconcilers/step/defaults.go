@@ -0,0 +1,90 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package step
+
+import (
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	stepdefaults "github.com/dreamstax/kai/internal/step/defaults"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"knative.dev/pkg/kmap"
+)
+
+// applyDefaults merges the pipeline defaults into the spec of a step. Values set on the step
+// take precedence over the defaults.
+func applyDefaults(spec *corev1alpha1.StepSpec, d *corev1alpha1.StepDefaults) {
+	if d == nil {
+		return
+	}
+
+	// the env is carried on the step rather than its containers, so it also reaches the
+	// containers the step copies from its model runtime
+	spec.Env = stepdefaults.MergeEnv(spec.Env, d.Env)
+
+	if len(d.NodeSelector) > 0 {
+		spec.NodeSelector = kmap.Union(d.NodeSelector, spec.NodeSelector)
+	}
+
+	for _, t := range d.Tolerations {
+		if !containsToleration(spec.Tolerations, t) {
+			spec.Tolerations = append(spec.Tolerations, t)
+		}
+	}
+
+	for _, s := range d.ImagePullSecrets {
+		if !containsSecret(spec.ImagePullSecrets, s.Name) {
+			spec.ImagePullSecrets = append(spec.ImagePullSecrets, s)
+		}
+	}
+
+	for _, v := range d.Volumes {
+		if !containsVolume(spec.Volumes, v.Name) {
+			spec.Volumes = append(spec.Volumes, v)
+		}
+	}
+
+	if spec.ServiceAccountName == "" {
+		spec.ServiceAccountName = d.ServiceAccountName
+	}
+}
+
+func containsToleration(tolerations []corev1.Toleration, t corev1.Toleration) bool {
+	for _, existing := range tolerations {
+		if equality.Semantic.DeepEqual(existing, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSecret(secrets []corev1.LocalObjectReference, name string) bool {
+	for _, s := range secrets {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsVolume(volumes []corev1.Volume, name string) bool {
+	for _, v := range volumes {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
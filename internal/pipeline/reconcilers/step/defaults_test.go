@@ -0,0 +1,93 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package step
+
+import (
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	stepdefaults "github.com/dreamstax/kai/internal/step/defaults"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	defaults := &corev1alpha1.StepDefaults{
+		Env: []corev1.EnvVar{
+			{Name: "LOG_LEVEL", Value: "info"},
+			{Name: "REGION", Value: "eu-west-1"},
+		},
+		NodeSelector:     map[string]string{"pool": "cpu", "zone": "a"},
+		Tolerations:      []corev1.Toleration{{Key: "dedicated", Value: "ml", Effect: corev1.TaintEffectNoSchedule}},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+		Volumes: []corev1.Volume{
+			{Name: "cache", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		},
+		ServiceAccountName: "models",
+	}
+
+	spec := corev1alpha1.StepSpec{
+		PodSpec: corev1alpha1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "server",
+				Env: []corev1.EnvVar{
+					{Name: "LOG_LEVEL", Value: "debug"},
+					{Name: "ENDPOINT", Value: "https://$(REGION).example.com"},
+				},
+			}},
+			NodeSelector: map[string]string{"pool": "gpu"},
+			Volumes: []corev1.Volume{
+				{Name: "cache", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/cache"}}},
+			},
+		},
+	}
+
+	applyDefaults(&spec, defaults)
+
+	// the env is carried on the step so the step also adds it to the containers of its model runtime
+	if !equality.Semantic.DeepEqual(spec.Env, defaults.Env) {
+		t.Errorf("env = %+v, want %+v", spec.Env, defaults.Env)
+	}
+	wantEnv := []corev1.EnvVar{
+		{Name: "REGION", Value: "eu-west-1"},
+		{Name: "LOG_LEVEL", Value: "debug"},
+		{Name: "ENDPOINT", Value: "https://$(REGION).example.com"},
+	}
+	if env := stepdefaults.MergeEnv(spec.Containers[0].Env, spec.Env); !equality.Semantic.DeepEqual(env, wantEnv) {
+		t.Errorf("container env = %+v, want %+v", env, wantEnv)
+	}
+	wantSelector := map[string]string{"pool": "gpu", "zone": "a"}
+	if !equality.Semantic.DeepEqual(spec.NodeSelector, wantSelector) {
+		t.Errorf("nodeSelector = %v, want %v", spec.NodeSelector, wantSelector)
+	}
+	if len(spec.Tolerations) != 1 || len(spec.ImagePullSecrets) != 1 {
+		t.Errorf("expected default tolerations and pull secrets to be added, got %+v %+v", spec.Tolerations, spec.ImagePullSecrets)
+	}
+	if len(spec.Volumes) != 1 || spec.Volumes[0].HostPath == nil {
+		t.Errorf("expected the step's volume to take precedence, got %+v", spec.Volumes)
+	}
+	if spec.ServiceAccountName != "models" {
+		t.Errorf("serviceAccountName = %q, want %q", spec.ServiceAccountName, "models")
+	}
+
+	// applying the defaults again doesn't change the spec, so steps aren't updated needlessly
+	again := spec.DeepCopy()
+	applyDefaults(again, defaults)
+	if !equality.Semantic.DeepEqual(again, &spec) {
+		t.Errorf("expected applying defaults to be idempotent, got %+v", again)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package step
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/network"
+)
+
+// isExternal reports whether the step is managed outside of the pipeline.
+func isExternal(s *corev1alpha1.StepTemplateSpec) bool {
+	return s.StepRef != nil || s.Endpoint != nil
+}
+
+// observeExternal summarizes a step managed outside of the pipeline. These are only observed,
+// the pipeline never creates, updates or deletes them.
+func (r *Reconciler) observeExternal(ctx context.Context, p *corev1alpha1.Pipeline, key string, s *corev1alpha1.StepTemplateSpec) (corev1alpha1.PipelineStepStatus, error) {
+	switch {
+	case s.StepRef != nil && s.Endpoint != nil:
+		return corev1alpha1.PipelineStepStatus{
+			Name:      key,
+			LastError: "stepRef and endpoint are mutually exclusive",
+		}, nil
+	case s.StepRef != nil:
+		return r.observeStepRef(ctx, p, key, s.StepRef)
+	default:
+		return r.observeEndpoint(ctx, p, key, s.Endpoint)
+	}
+}
+
+// isShared reports whether pipelines in the given namespace may reference the object. Objects are
+// always shared within their namespace, other namespaces have to be listed by the object.
+func isShared(obj metav1.Object, namespace string) bool {
+	if obj.GetNamespace() == namespace {
+		return true
+	}
+	for _, ns := range strings.Split(obj.GetAnnotations()[kai.SharedNamespacesAnnotationKey], ",") {
+		if ns = strings.TrimSpace(ns); ns == "*" || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reconciler) observeStepRef(ctx context.Context, p *corev1alpha1.Pipeline, key string, ref *corev1alpha1.StepReference) (corev1alpha1.PipelineStepStatus, error) {
+	name := types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+	if name.Namespace == "" {
+		name.Namespace = p.Namespace
+	}
+
+	step := &corev1alpha1.Step{}
+	err := r.client.Get(ctx, name, step)
+	if apierrs.IsNotFound(err) || (err == nil && !isShared(step, p.Namespace)) {
+		// steps not shared with the pipeline are reported as missing so their existence isn't revealed
+		out := corev1alpha1.PipelineStepStatus{
+			Name:      key,
+			StepName:  name.Name,
+			LastError: fmt.Sprintf("step %q not found", name),
+		}
+		if name.Namespace != p.Namespace {
+			out.StepNamespace = name.Namespace
+			out.LastError = fmt.Sprintf("step %q not found or not shared with namespace %q", name, p.Namespace)
+		}
+		return out, nil
+	} else if err != nil {
+		return corev1alpha1.PipelineStepStatus{}, fmt.Errorf("failed to get step %q: %w", name, err)
+	}
+
+	out := summarizeStep(key, step)
+	if name.Namespace != p.Namespace {
+		out.StepNamespace = name.Namespace
+	}
+	return out, nil
+}
+
+func (r *Reconciler) observeEndpoint(ctx context.Context, p *corev1alpha1.Pipeline, key string, ref *corev1alpha1.EndpointReference) (corev1alpha1.PipelineStepStatus, error) {
+	out := corev1alpha1.PipelineStepStatus{Name: key}
+
+	switch {
+	case ref.URL != "" && ref.Service != nil:
+		out.LastError = "endpoint url and service are mutually exclusive"
+		return out, nil
+	case ref.URL != "":
+		// there is no way of telling whether an external server is up, trust the user
+		out.URL = ref.URL
+		out.Ready = true
+		return out, nil
+	case ref.Service == nil:
+		out.LastError = "endpoint must set either url or service"
+		return out, nil
+	}
+
+	name := types.NamespacedName{Namespace: ref.Service.Namespace, Name: ref.Service.Name}
+	if name.Namespace == "" {
+		name.Namespace = p.Namespace
+	}
+
+	svc := &corev1.Service{}
+	err := r.client.Get(ctx, name, svc)
+	if apierrs.IsNotFound(err) || (err == nil && !isShared(svc, p.Namespace)) {
+		out.LastError = fmt.Sprintf("service %q not found", name)
+		if name.Namespace != p.Namespace {
+			out.LastError = fmt.Sprintf("service %q not found or not shared with namespace %q", name, p.Namespace)
+		}
+		return out, nil
+	} else if err != nil {
+		return out, fmt.Errorf("failed to get service %q: %w", name, err)
+	}
+
+	port := ref.Service.Port
+	if port == 0 && len(svc.Spec.Ports) > 0 {
+		port = svc.Spec.Ports[0].Port
+	}
+
+	host := network.GetServiceHostname(svc.Name, svc.Namespace)
+	if port == 0 || port == 80 {
+		out.URL = fmt.Sprintf("http://%s", host)
+	} else {
+		out.URL = fmt.Sprintf("http://%s:%d", host, port)
+	}
+	out.Ready = true
+
+	return out, nil
+}
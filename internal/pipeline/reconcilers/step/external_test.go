@@ -0,0 +1,199 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package step
+
+import (
+	"context"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileObservesExternalSteps(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &corev1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{Name: "ensemble", Namespace: "default", UID: "ensemble-uid"},
+		Spec: corev1alpha1.PipelineSpec{
+			Steps: []*corev1alpha1.StepTemplateSpec{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "features"},
+					StepRef:    &corev1alpha1.StepReference{Name: "features", Namespace: "shared"},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "classifier"},
+					DependsOn:  []string{"features"},
+					Endpoint: &corev1alpha1.EndpointReference{
+						Service: &corev1alpha1.ServiceReference{Name: "torchserve"},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "explainer"},
+					DependsOn:  []string{"classifier"},
+					Endpoint:   &corev1alpha1.EndpointReference{URL: "https://explainer.example.com"},
+				},
+			},
+		},
+	}
+	features := &corev1alpha1.Step{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "features",
+			Namespace:   "shared",
+			Generation:  1,
+			Annotations: map[string]string{kai.SharedNamespacesAnnotationKey: "team-a, default"},
+		},
+		Status: corev1alpha1.StepStatus{
+			URL: "http://features-service.shared.svc.cluster.local",
+			Conditions: []metav1.Condition{{
+				Type:               corev1alpha1.StepConditionReady,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: 1,
+				Reason:             "Ready",
+			}},
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "torchserve", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 8080}}},
+	}
+
+	kc := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(p, features, svc).
+		Build()
+
+	if err := NewReconciler(kc).Reconcile(context.Background(), p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []corev1alpha1.PipelineStepStatus{
+		{Name: "features", StepName: "features", StepNamespace: "shared", Ready: true, URL: "http://features-service.shared.svc.cluster.local"},
+		{Name: "classifier", Ready: true, URL: "http://torchserve.default.svc.cluster.local:8080"},
+		{Name: "explainer", Ready: true, URL: "https://explainer.example.com"},
+	}
+	if len(p.Status.Steps) != len(want) {
+		t.Fatalf("expected %d steps in status, got %+v", len(want), p.Status.Steps)
+	}
+	for i := range want {
+		if p.Status.Steps[i] != want[i] {
+			t.Errorf("step %d: expected %+v, got %+v", i, want[i], p.Status.Steps[i])
+		}
+	}
+
+	// external steps are never created by the pipeline
+	steps := &corev1alpha1.StepList{}
+	if err := kc.List(context.Background(), steps, kclient.InNamespace("default")); err != nil {
+		t.Fatal(err)
+	}
+	if len(steps.Items) != 0 {
+		t.Errorf("expected no steps to be created, got %d", len(steps.Items))
+	}
+
+	// a missing reference leaves the pipeline not ready
+	if err := kc.Delete(context.Background(), features); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewReconciler(kc).Reconcile(context.Background(), p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Status.Steps[0].Ready || p.Status.Steps[0].LastError == "" {
+		t.Errorf("expected missing step to be reported, got %+v", p.Status.Steps[0])
+	}
+}
+
+func TestReconcileRequiresSharedReferences(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &corev1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{Name: "ensemble", Namespace: "default", UID: "ensemble-uid"},
+		Spec: corev1alpha1.PipelineSpec{
+			Steps: []*corev1alpha1.StepTemplateSpec{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "features"},
+					StepRef:    &corev1alpha1.StepReference{Name: "features", Namespace: "shared"},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "classifier"},
+					Endpoint: &corev1alpha1.EndpointReference{
+						Service: &corev1alpha1.ServiceReference{Name: "torchserve", Namespace: "models"},
+					},
+				},
+			},
+		},
+	}
+	features := &corev1alpha1.Step{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "features",
+			Namespace:   "shared",
+			Annotations: map[string]string{kai.SharedNamespacesAnnotationKey: "team-a"},
+		},
+		Status: corev1alpha1.StepStatus{URL: "http://features-service.shared.svc.cluster.local"},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "torchserve", Namespace: "models"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 8080}}},
+	}
+
+	kc := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(p, features, svc).
+		Build()
+
+	if err := NewReconciler(kc).Reconcile(ctx, p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range p.Status.Steps {
+		if s.Ready || s.URL != "" || s.LastError == "" {
+			t.Errorf("expected references not shared with the pipeline to be reported missing, got %+v", s)
+		}
+	}
+
+	// sharing the service with all namespaces exposes it to the pipeline
+	svc.Annotations = map[string]string{kai.SharedNamespacesAnnotationKey: "*"}
+	if err := kc.Update(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewReconciler(kc).Reconcile(ctx, p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := corev1alpha1.PipelineStepStatus{Name: "classifier", Ready: true, URL: "http://torchserve.models.svc.cluster.local:8080"}
+	if p.Status.Steps[1] != want {
+		t.Errorf("expected %+v, got %+v", want, p.Status.Steps[1])
+	}
+	if p.Status.Steps[0].URL != "" {
+		t.Errorf("expected step not shared with the pipeline to stay hidden, got %+v", p.Status.Steps[0])
+	}
+}
@@ -18,12 +18,19 @@ package step
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	"github.com/dreamstax/kai/internal/pipeline/dag"
+	"github.com/dreamstax/kai/internal/pipeline/params"
 	"github.com/dreamstax/kai/internal/pipeline/reconcilers/names"
+	stepdefaults "github.com/dreamstax/kai/internal/step/defaults"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"knative.dev/pkg/kmap"
@@ -31,6 +38,30 @@ import (
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// reasons surfaced on the TopologyResolved condition, Resolved is shared with ParametersResolved
+const (
+	reasonResolved          = "Resolved"
+	reasonDuplicateStep     = "DuplicateStep"
+	reasonUnknownDependency = "UnknownDependency"
+	reasonCycleDetected     = "CycleDetected"
+)
+
+// reasons surfaced on the ParametersResolved condition
+const (
+	reasonUnknownParameter = "UnknownParameter"
+	reasonMissingValue     = "MissingValue"
+	reasonInvalidValue     = "InvalidValue"
+)
+
+// reasons surfaced on the Ready condition
+const (
+	reasonStepsReady            = "StepsReady"
+	reasonStepsNotReady         = "StepsNotReady"
+	reasonTopologyNotResolved   = "TopologyNotResolved"
+	reasonParametersNotResolved = "ParametersNotResolved"
+	reasonStepNameConflict      = "StepNameConflict"
+)
+
 type Reconciler struct {
 	client kclient.Client
 }
@@ -43,50 +74,354 @@ func NewReconciler(client kclient.Client) *Reconciler {
 
 // TODO: accept step number as arg to identify appropriate step
 func (r *Reconciler) Reconcile(ctx context.Context, p *corev1alpha1.Pipeline) error {
-	for i, s := range p.Spec.Steps {
-		stepName := names.StepName(p, i)
-		step := &corev1alpha1.Step{}
-		err := r.client.Get(ctx, stepName, step)
-		if apierrs.IsNotFound(err) {
+	topology, err := resolveTopology(p)
+	if err != nil {
+		// an invalid graph can only be fixed by the user so surface it and leave
+		// existing steps untouched until the spec changes
+		reason := reasonCycleDetected
+		switch {
+		case errors.Is(err, dag.ErrDuplicateNode):
+			reason = reasonDuplicateStep
+		case errors.Is(err, dag.ErrUnknownDependency):
+			reason = reasonUnknownDependency
+		}
+		p.Status.Topology = nil
+		meta.SetStatusCondition(&p.Status.Conditions, metav1.Condition{
+			Type:               corev1alpha1.PipelineConditionTopologyResolved,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: p.Generation,
+			Reason:             reason,
+			Message:            err.Error(),
+		})
+		meta.SetStatusCondition(&p.Status.Conditions, metav1.Condition{
+			Type:               corev1alpha1.PipelineConditionReady,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: p.Generation,
+			Reason:             reasonTopologyNotResolved,
+			Message:            err.Error(),
+		})
+		return nil
+	}
+	p.Status.Topology = topology
+	meta.SetStatusCondition(&p.Status.Conditions, metav1.Condition{
+		Type:               corev1alpha1.PipelineConditionTopologyResolved,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: p.Generation,
+		Reason:             reasonResolved,
+	})
+
+	templates, err := resolveParameters(p)
+	if err != nil {
+		// like an invalid graph, unresolved parameters leave existing steps untouched
+		reason := reasonUnknownParameter
+		switch {
+		case errors.Is(err, params.ErrMissingValue):
+			reason = reasonMissingValue
+		case errors.Is(err, params.ErrInvalidValue):
+			reason = reasonInvalidValue
+		}
+		meta.SetStatusCondition(&p.Status.Conditions, metav1.Condition{
+			Type:               corev1alpha1.PipelineConditionParametersResolved,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: p.Generation,
+			Reason:             reason,
+			Message:            err.Error(),
+		})
+		meta.SetStatusCondition(&p.Status.Conditions, metav1.Condition{
+			Type:               corev1alpha1.PipelineConditionReady,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: p.Generation,
+			Reason:             reasonParametersNotResolved,
+			Message:            err.Error(),
+		})
+		return nil
+	}
+	meta.SetStatusCondition(&p.Status.Conditions, metav1.Condition{
+		Type:               corev1alpha1.PipelineConditionParametersResolved,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: p.Generation,
+		Reason:             reasonResolved,
+	})
+
+	existing, err := r.listSteps(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	current := map[types.UID]bool{}
+	summaries := make([]corev1alpha1.PipelineStepStatus, 0, len(templates))
+	conflicts := []string{}
+	for i, s := range templates {
+		key := names.StepKey(s, i)
+		if isExternal(s) {
+			summary, err := r.observeExternal(ctx, p, key, s)
+			if err != nil {
+				return err
+			}
+			summaries = append(summaries, summary)
+			continue
+		}
+
+		step := findStep(p, existing, key, i)
+		if step == nil {
 			// step doesn't exist so create it.
-			objMeta := metav1.ObjectMeta{
-				Name:            stepName.Name,
-				Namespace:       p.Namespace,
-				Labels:          names.MakeLabels(p),
-				Annotations:     names.MakeAnnotations(p),
-				OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(p)},
+			created, err := r.createPipelineStep(ctx, p, key, s)
+			var conflict *nameConflictError
+			if errors.As(err, &conflict) {
+				// the name belongs to a step the pipeline doesn't control, leave it alone
+				conflicts = append(conflicts, conflict.Error())
+				summaries = append(summaries, corev1alpha1.PipelineStepStatus{Name: key, LastError: conflict.Error()})
+				continue
 			}
-			_, err = r.createStep(ctx, stepName, objMeta, s)
 			if err != nil {
-				return fmt.Errorf("failed to create step %q: %w", stepName, err)
+				return err
 			}
-		} else if err != nil {
-			return fmt.Errorf("failed to get step %q: %w", stepName, err)
+			summaries = append(summaries, summarizeStep(key, created))
 		} else {
-			// step exists
-			objMeta := metav1.ObjectMeta{
-				Name:            stepName.Name,
-				Namespace:       step.Namespace,
-				Labels:          names.MakeLabels(p),
-				Annotations:     names.MakeAnnotations(p),
-				OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(p)},
-			}
-			_, err = r.updateStep(ctx, stepName, objMeta, s, step)
+			// step exists, keep its name even if it was derived differently when created
+			stepName := step.NamespacedName()
+			current[step.UID] = true
+			updated, err := r.updateStep(ctx, p, stepName, makeObjectMeta(p, stepName, key), s, step)
 			if err != nil {
-				return fmt.Errorf("failed to update deplyoment %q: %w", stepName, err)
+				return fmt.Errorf("failed to update step %q: %w", stepName, err)
+			}
+			summaries = append(summaries, summarizeStep(key, updated))
+		}
+	}
+	p.Status.Steps = summaries
+	setReadyCondition(p)
+	if len(conflicts) > 0 {
+		meta.SetStatusCondition(&p.Status.Conditions, metav1.Condition{
+			Type:               corev1alpha1.PipelineConditionReady,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: p.Generation,
+			Reason:             reasonStepNameConflict,
+			Message:            strings.Join(conflicts, "; "),
+		})
+	}
+
+	// remove steps which are no longer part of the pipeline
+	if p.Spec.StepRetentionPolicy != corev1alpha1.StepRetentionPolicyRetain {
+		for i := range existing {
+			step := &existing[i]
+			if current[step.UID] || !metav1.IsControlledBy(step, p) {
+				continue
 			}
+			err = r.client.Delete(ctx, step, kclient.PropagationPolicy(metav1.DeletePropagationBackground))
+			if kclient.IgnoreNotFound(err) != nil {
+				return fmt.Errorf("failed to delete step %q: %w", step.NamespacedName(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// listSteps returns the steps created by the pipeline.
+func (r *Reconciler) listSteps(ctx context.Context, p *corev1alpha1.Pipeline) ([]corev1alpha1.Step, error) {
+	selector, err := metav1.LabelSelectorAsSelector(names.MakeSelector(p))
+	if err != nil {
+		return nil, fmt.Errorf("failed to make selector for pipeline %q: %w", p.NamespacedName(), err)
+	}
+
+	steps := &corev1alpha1.StepList{}
+	err = r.client.List(ctx, steps, kclient.InNamespace(p.Namespace), kclient.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list steps for pipeline %q: %w", p.NamespacedName(), err)
+	}
+
+	return steps.Items, nil
+}
 
-			// TODO: Surface step status to pipeline
+// findStep returns the existing step for the given key or nil if the step has not been created.
+// Steps created before steps were identified by key are named by their index and carry no key label,
+// these are adopted in place so naming a step doesn't recreate it and its workloads.
+func findStep(p *corev1alpha1.Pipeline, steps []corev1alpha1.Step, key string, idx int) *corev1alpha1.Step {
+	for i := range steps {
+		if steps[i].Labels[kai.PipelineStepLabelKey] == key {
+			return &steps[i]
 		}
 	}
 
-	// TODO: handle failing pods
+	legacyName := names.LegacyStepName(p, idx).Name
+	for i := range steps {
+		if _, ok := steps[i].Labels[kai.PipelineStepLabelKey]; !ok && steps[i].Name == legacyName {
+			return &steps[i]
+		}
+	}
 
 	return nil
 }
 
-func (r *Reconciler) createStep(ctx context.Context, name types.NamespacedName, objMeta metav1.ObjectMeta, stepTpl *corev1alpha1.StepTemplateSpec) (*corev1alpha1.Step, error) {
-	step, err := r.makeStep(ctx, name, objMeta, stepTpl)
+// summarizeStep reports the observed state of a step for the pipeline status. A step is only
+// considered ready once its latest spec has been observed as ready.
+func summarizeStep(key string, step *corev1alpha1.Step) corev1alpha1.PipelineStepStatus {
+	out := corev1alpha1.PipelineStepStatus{
+		Name:     key,
+		StepName: step.Name,
+		Replicas: step.Status.Replicas,
+		URL:      step.Status.URL,
+	}
+
+	cond := meta.FindStatusCondition(step.Status.Conditions, corev1alpha1.StepConditionReady)
+	if cond == nil {
+		return out
+	}
+	out.Ready = cond.Status == metav1.ConditionTrue && cond.ObservedGeneration == step.Generation
+	if cond.Status == metav1.ConditionFalse {
+		out.LastError = cond.Message
+	}
+
+	return out
+}
+
+// setReadyCondition marks the pipeline ready when all of its steps are ready.
+func setReadyCondition(p *corev1alpha1.Pipeline) {
+	notReady := []string{}
+	for _, s := range p.Status.Steps {
+		if !s.Ready {
+			notReady = append(notReady, s.Name)
+		}
+	}
+
+	if len(notReady) > 0 {
+		meta.SetStatusCondition(&p.Status.Conditions, metav1.Condition{
+			Type:               corev1alpha1.PipelineConditionReady,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: p.Generation,
+			Reason:             reasonStepsNotReady,
+			Message:            fmt.Sprintf("steps not ready: %s", strings.Join(notReady, ", ")),
+		})
+		return
+	}
+
+	meta.SetStatusCondition(&p.Status.Conditions, metav1.Condition{
+		Type:               corev1alpha1.PipelineConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: p.Generation,
+		Reason:             reasonStepsReady,
+	})
+}
+
+// resolveParameters returns the steps of the pipeline with the parameters they reference
+// substituted.
+func resolveParameters(p *corev1alpha1.Pipeline) ([]*corev1alpha1.StepTemplateSpec, error) {
+	values, err := params.Resolve(p.Spec.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*corev1alpha1.StepTemplateSpec, 0, len(p.Spec.Steps))
+	for i, s := range p.Spec.Steps {
+		resolved, err := params.Substitute(s, values)
+		if err != nil {
+			return nil, fmt.Errorf("step %q: %w", names.StepKey(s, i), err)
+		}
+		out = append(out, resolved)
+	}
+
+	return out, nil
+}
+
+// resolveTopology builds the graph of steps from their dependencies and validates it.
+func resolveTopology(p *corev1alpha1.Pipeline) ([]corev1alpha1.StepTopology, error) {
+	nodes := make([]dag.Node, 0, len(p.Spec.Steps))
+	for i, s := range p.Spec.Steps {
+		nodes = append(nodes, dag.Node{
+			Name:      names.StepKey(s, i),
+			DependsOn: s.DependsOn,
+		})
+	}
+
+	vertices, err := dag.Resolve(nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]corev1alpha1.StepTopology, 0, len(vertices))
+	for _, v := range vertices {
+		out = append(out, corev1alpha1.StepTopology{
+			Name:      v.Name,
+			DependsOn: v.DependsOn,
+			Level:     int32(v.Level),
+		})
+	}
+
+	return out, nil
+}
+
+// nameConflictError is returned when the name of a step is taken by a step the pipeline doesn't control.
+type nameConflictError struct {
+	key   string
+	name  types.NamespacedName
+	owner string
+}
+
+func (e *nameConflictError) Error() string {
+	return fmt.Sprintf("step %q can't be created: step %q already exists and is owned by %s", e.key, e.name.Name, e.owner)
+}
+
+// createPipelineStep creates the step for the given key. When the name is already taken by a step
+// of the pipeline for another key, e.g. a legacy step adopted by a named step, the step is created
+// under a fallback name instead; a name taken by anything else is reported as a nameConflictError.
+// A step of the pipeline already created for the key but missed by a stale cache is returned as is.
+func (r *Reconciler) createPipelineStep(ctx context.Context, p *corev1alpha1.Pipeline, key string, s *corev1alpha1.StepTemplateSpec) (*corev1alpha1.Step, error) {
+	stepName := names.StepName(p, key)
+	created, err := r.createStep(ctx, p, stepName, makeObjectMeta(p, stepName, key), s)
+	if !apierrs.IsAlreadyExists(err) {
+		return created, err
+	}
+	taken, err := r.getTakenStep(ctx, p, key, stepName)
+	if err != nil || taken != nil {
+		return taken, err
+	}
+
+	stepName = names.FallbackStepName(p, key)
+	created, err = r.createStep(ctx, p, stepName, makeObjectMeta(p, stepName, key), s)
+	if !apierrs.IsAlreadyExists(err) {
+		return created, err
+	}
+	taken, err = r.getTakenStep(ctx, p, key, stepName)
+	if err != nil || taken != nil {
+		return taken, err
+	}
+	return nil, fmt.Errorf("failed to create step %q: fallback name %q is taken by another step", key, stepName.Name)
+}
+
+// getTakenStep returns the step holding the name if the pipeline created it for the key, or nil if
+// the pipeline created it for another key. A step the pipeline doesn't control is reported as a
+// nameConflictError.
+func (r *Reconciler) getTakenStep(ctx context.Context, p *corev1alpha1.Pipeline, key string, name types.NamespacedName) (*corev1alpha1.Step, error) {
+	taken := &corev1alpha1.Step{}
+	if err := r.client.Get(ctx, name, taken); err != nil {
+		return nil, fmt.Errorf("failed to get step %q: %w", name, err)
+	}
+	if !metav1.IsControlledBy(taken, p) {
+		owner := "no controller"
+		if ref := metav1.GetControllerOf(taken); ref != nil {
+			owner = fmt.Sprintf("%s %q", ref.Kind, ref.Name)
+		}
+		return nil, &nameConflictError{key: key, name: name, owner: owner}
+	}
+	if taken.Labels[kai.PipelineStepLabelKey] == key {
+		return taken, nil
+	}
+	return nil, nil
+}
+
+// makeObjectMeta returns the metadata for the step created for the given key.
+func makeObjectMeta(p *corev1alpha1.Pipeline, name types.NamespacedName, key string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:            name.Name,
+		Namespace:       name.Namespace,
+		Labels:          names.MakeStepLabels(p, key),
+		Annotations:     names.MakeAnnotations(p),
+		OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(p)},
+	}
+}
+
+func (r *Reconciler) createStep(ctx context.Context, p *corev1alpha1.Pipeline, name types.NamespacedName, objMeta metav1.ObjectMeta, stepTpl *corev1alpha1.StepTemplateSpec) (*corev1alpha1.Step, error) {
+	step, err := r.makeStep(ctx, p, name, objMeta, stepTpl)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make step %q: %w", name, err)
 	}
@@ -99,13 +434,14 @@ func (r *Reconciler) createStep(ctx context.Context, name types.NamespacedName,
 	return step, nil
 }
 
-func (r *Reconciler) updateStep(ctx context.Context, name types.NamespacedName, objMeta metav1.ObjectMeta, stepTpl *corev1alpha1.StepTemplateSpec, in *corev1alpha1.Step) (*corev1alpha1.Step, error) {
-	step, err := r.makeStep(ctx, name, objMeta, stepTpl)
+func (r *Reconciler) updateStep(ctx context.Context, p *corev1alpha1.Pipeline, name types.NamespacedName, objMeta metav1.ObjectMeta, stepTpl *corev1alpha1.StepTemplateSpec, in *corev1alpha1.Step) (*corev1alpha1.Step, error) {
+	step, err := r.makeStep(ctx, p, name, objMeta, stepTpl)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update step %q: %w", name, err)
 	}
 
-	if equality.Semantic.DeepEqual(in.Spec, step.Spec) {
+	labels := kmap.Union(step.Labels, in.Labels)
+	if equality.Semantic.DeepEqual(in.Spec, step.Spec) && equality.Semantic.DeepEqual(in.Labels, labels) {
 		// no changes to make just return
 		return in, nil
 	}
@@ -113,7 +449,7 @@ func (r *Reconciler) updateStep(ctx context.Context, name types.NamespacedName,
 	// update step
 	out := in.DeepCopy()
 	out.Spec = step.Spec
-	out.Labels = kmap.Union(step.Labels, out.Labels)
+	out.Labels = labels
 
 	err = r.client.Update(ctx, out)
 	if err != nil {
@@ -123,10 +459,19 @@ func (r *Reconciler) updateStep(ctx context.Context, name types.NamespacedName,
 	return out, nil
 }
 
-func (r *Reconciler) makeStep(ctx context.Context, name types.NamespacedName, objMeta metav1.ObjectMeta, step *corev1alpha1.StepTemplateSpec) (*corev1alpha1.Step, error) {
+func (r *Reconciler) makeStep(ctx context.Context, p *corev1alpha1.Pipeline, name types.NamespacedName, objMeta metav1.ObjectMeta, step *corev1alpha1.StepTemplateSpec) (*corev1alpha1.Step, error) {
 	stepc := step.DeepCopy()
-	return &corev1alpha1.Step{
+	applyDefaults(&stepc.Spec, p.Spec.Defaults)
+	out := &corev1alpha1.Step{
 		ObjectMeta: objMeta,
 		Spec:       stepc.Spec,
-	}, nil
+	}
+
+	// steps are defaulted on admission, default them up front so they compare equal to the
+	// steps read back from the cluster
+	if err := stepdefaults.New(r.client).Apply(ctx, out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
 }
@@ -0,0 +1,472 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package step
+
+import (
+	"context"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	"github.com/dreamstax/kai/internal/pipeline/reconcilers/names"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/kmeta"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func newPipeline(name string, steps ...*corev1alpha1.StepTemplateSpec) *corev1alpha1.Pipeline {
+	return &corev1alpha1.Pipeline{
+		TypeMeta:   metav1.TypeMeta{APIVersion: corev1alpha1.GroupVersion.String(), Kind: "Pipeline"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID("uid-" + name)},
+		Spec:       corev1alpha1.PipelineSpec{Steps: steps},
+	}
+}
+
+func newTemplate(name string) *corev1alpha1.StepTemplateSpec {
+	return &corev1alpha1.StepTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1alpha1.StepSpec{
+			PodSpec: corev1alpha1.PodSpec{
+				Containers: []corev1.Container{{Name: "kai-container", Image: "kai/example"}},
+			},
+		},
+	}
+}
+
+// newStep returns a step owned by the pipeline, labelled with the key if it is set.
+func newStep(p *corev1alpha1.Pipeline, name, key string) corev1alpha1.Step {
+	labels := names.MakeLabels(p)
+	if key != "" {
+		labels = names.MakeStepLabels(p, key)
+	}
+	return corev1alpha1.Step{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       p.Namespace,
+			UID:             types.UID("uid-" + name),
+			Labels:          labels,
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(p)},
+		},
+	}
+}
+
+func TestFindStep(t *testing.T) {
+	p := newPipeline("p")
+
+	tests := []struct {
+		name  string
+		steps []corev1alpha1.Step
+		key   string
+		idx   int
+		want  string
+	}{{
+		name:  "by key",
+		steps: []corev1alpha1.Step{newStep(p, "p-a", "a"), newStep(p, "p-b", "b")},
+		key:   "b",
+		idx:   0,
+		want:  "p-b",
+	}, {
+		name:  "key wins over legacy name",
+		steps: []corev1alpha1.Step{newStep(p, "p-step-0", ""), newStep(p, "p-a", "a")},
+		key:   "a",
+		idx:   0,
+		want:  "p-a",
+	}, {
+		name:  "legacy step adopted by named step",
+		steps: []corev1alpha1.Step{newStep(p, "p-step-0", "")},
+		key:   "a",
+		idx:   0,
+		want:  "p-step-0",
+	}, {
+		name:  "legacy step adopted by unnamed step",
+		steps: []corev1alpha1.Step{newStep(p, "p-step-1", "")},
+		key:   "step-1",
+		idx:   1,
+		want:  "p-step-1",
+	}, {
+		name:  "legacy name already adopted under another key",
+		steps: []corev1alpha1.Step{newStep(p, "p-step-0", "a")},
+		key:   "step-0",
+		idx:   0,
+	}, {
+		name:  "legacy step at another index",
+		steps: []corev1alpha1.Step{newStep(p, "p-step-1", "")},
+		key:   "a",
+		idx:   0,
+	}, {
+		name: "no steps",
+		key:  "a",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findStep(p, tt.steps, tt.key, tt.idx)
+			switch {
+			case tt.want == "" && got != nil:
+				t.Errorf("expected no step, got %q", got.Name)
+			case tt.want != "" && got == nil:
+				t.Errorf("expected step %q, got none", tt.want)
+			case tt.want != "" && got.Name != tt.want:
+				t.Errorf("expected step %q, got %q", tt.want, got.Name)
+			}
+		})
+	}
+}
+
+func TestReconcileAdoptsLegacySteps(t *testing.T) {
+	ctx := context.Background()
+	p := newPipeline("p", newTemplate("a"))
+	legacy := newStep(p, "p-step-0", "")
+
+	kc := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(p, &legacy).Build()
+	if err := NewReconciler(kc).Reconcile(ctx, p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	adopted := &corev1alpha1.Step{}
+	if err := kc.Get(ctx, legacy.NamespacedName(), adopted); err != nil {
+		t.Fatalf("expected legacy step to be kept: %v", err)
+	}
+	if got := adopted.Labels[kai.PipelineStepLabelKey]; got != "a" {
+		t.Errorf("expected legacy step to be labelled with key %q, got %q", "a", got)
+	}
+	if got := p.Status.Steps[0].StepName; got != "p-step-0" {
+		t.Errorf("expected status to report step %q, got %q", "p-step-0", got)
+	}
+
+	// an unnamed step inserted at index 0 would be named like the adopted step, it must not
+	// fail to be created
+	p.Spec.Steps = []*corev1alpha1.StepTemplateSpec{newTemplate(""), newTemplate("a")}
+	if err := NewReconciler(kc).Reconcile(ctx, p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fallback := names.FallbackStepName(p, "step-0")
+	created := &corev1alpha1.Step{}
+	if err := kc.Get(ctx, fallback, created); err != nil {
+		t.Fatalf("expected step to be created with fallback name %q: %v", fallback.Name, err)
+	}
+	if got := created.Labels[kai.PipelineStepLabelKey]; got != "step-0" {
+		t.Errorf("expected created step to be labelled with key %q, got %q", "step-0", got)
+	}
+	if p.Status.Steps[0].StepName != fallback.Name || p.Status.Steps[1].StepName != "p-step-0" {
+		t.Errorf("unexpected steps in status: %+v", p.Status.Steps)
+	}
+
+	// further reconciles find the step by its key
+	if err := NewReconciler(kc).Reconcile(ctx, p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	steps := &corev1alpha1.StepList{}
+	if err := kc.List(ctx, steps, kclient.InNamespace("default")); err != nil {
+		t.Fatal(err)
+	}
+	if len(steps.Items) != 2 {
+		t.Errorf("expected 2 steps, got %d", len(steps.Items))
+	}
+}
+
+func TestReconcileFindsStepsMissedByTheCache(t *testing.T) {
+	ctx := context.Background()
+	p := newPipeline("p", newTemplate("a"))
+	existing := newStep(p, names.StepName(p, "a").Name, "a")
+
+	// the cache hasn't observed the step created by the previous reconcile yet
+	kc := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(p, &existing).WithInterceptorFuncs(interceptor.Funcs{
+		List: func(ctx context.Context, client kclient.WithWatch, list kclient.ObjectList, opts ...kclient.ListOption) error {
+			if _, ok := list.(*corev1alpha1.StepList); ok {
+				return nil
+			}
+			return client.List(ctx, list, opts...)
+		},
+	}).Build()
+	if err := NewReconciler(kc).Reconcile(ctx, p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := p.Status.Steps[0].StepName; got != existing.Name {
+		t.Errorf("expected status to report step %q, got %q", existing.Name, got)
+	}
+	fallback := names.FallbackStepName(p, "a")
+	if err := kc.Get(ctx, fallback, &corev1alpha1.Step{}); !apierrs.IsNotFound(err) {
+		t.Errorf("expected no step to be created under the fallback name %q, got %v", fallback.Name, err)
+	}
+}
+
+func TestReconcileReportsNameConflicts(t *testing.T) {
+	ctx := context.Background()
+
+	// pipeline "a" step "b-c" and pipeline "a-b" step "c" are both named "a-b-c"
+	a := newPipeline("a", newTemplate("b-c"))
+	ab := newPipeline("a-b", newTemplate("c"), newTemplate("d"))
+
+	kc := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(a, ab).Build()
+	if err := NewReconciler(kc).Reconcile(ctx, a); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := NewReconciler(kc).Reconcile(ctx, ab); err != nil {
+		t.Fatalf("expected conflict to be reported on the status, got error: %v", err)
+	}
+
+	cond := meta.FindStatusCondition(ab.Status.Conditions, corev1alpha1.PipelineConditionReady)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != reasonStepNameConflict {
+		t.Fatalf("expected Ready condition with reason %q, got %+v", reasonStepNameConflict, cond)
+	}
+	if ab.Status.Steps[0].LastError == "" || ab.Status.Steps[0].StepName != "" {
+		t.Errorf("expected conflicting step to be reported, got %+v", ab.Status.Steps[0])
+	}
+	if ab.Status.Steps[1].StepName != "a-b-d" {
+		t.Errorf("expected other steps to be created, got %+v", ab.Status.Steps[1])
+	}
+
+	// the step of the other pipeline is left untouched
+	taken := &corev1alpha1.Step{}
+	if err := kc.Get(ctx, names.StepName(a, "b-c"), taken); err != nil {
+		t.Fatal(err)
+	}
+	if !metav1.IsControlledBy(taken, a) || taken.Labels[kai.PipelineStepLabelKey] != "b-c" {
+		t.Errorf("expected step to remain owned by pipeline %q, got %+v", a.Name, taken.ObjectMeta)
+	}
+}
+
+func TestReconcileRemovesSteps(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy corev1alpha1.StepRetentionPolicy
+		want   []string
+	}{{
+		name: "default",
+		want: []string{"p-a"},
+	}, {
+		name:   "delete",
+		policy: corev1alpha1.StepRetentionPolicyDelete,
+		want:   []string{"p-a"},
+	}, {
+		name:   "retain",
+		policy: corev1alpha1.StepRetentionPolicyRetain,
+		want:   []string{"p-a", "p-b"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			p := newPipeline("p", newTemplate("a"))
+			p.Spec.StepRetentionPolicy = tt.policy
+			a := newStep(p, "p-a", "a")
+			b := newStep(p, "p-b", "b")
+			// a step carrying the pipeline labels without being controlled by it is never removed
+			c := newStep(p, "p-c", "c")
+			c.OwnerReferences = nil
+
+			kc := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(p, &a, &b, &c).Build()
+			if err := NewReconciler(kc).Reconcile(ctx, p); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			steps := &corev1alpha1.StepList{}
+			if err := kc.List(ctx, steps, kclient.InNamespace("default")); err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]bool{}
+			for _, s := range steps.Items {
+				got[s.Name] = true
+			}
+			for _, name := range append(tt.want, "p-c") {
+				if !got[name] {
+					t.Errorf("expected step %q to be kept, got %v", name, got)
+				}
+			}
+			if len(got) != len(tt.want)+1 {
+				t.Errorf("expected steps %v and %q, got %v", tt.want, "p-c", got)
+			}
+			if len(p.Status.Steps) != 1 || p.Status.Steps[0].Name != "a" {
+				t.Errorf("expected only the current step in status, got %+v", p.Status.Steps)
+			}
+		})
+	}
+}
+
+func TestSummarizeStep(t *testing.T) {
+	readyCondition := func(status metav1.ConditionStatus, generation int64, message string) []metav1.Condition {
+		return []metav1.Condition{{
+			Type:               corev1alpha1.StepConditionReady,
+			Status:             status,
+			ObservedGeneration: generation,
+			Reason:             "Test",
+			Message:            message,
+		}}
+	}
+
+	tests := []struct {
+		name       string
+		conditions []metav1.Condition
+		want       corev1alpha1.PipelineStepStatus
+	}{{
+		name: "no conditions",
+		want: corev1alpha1.PipelineStepStatus{Name: "a", StepName: "p-a", Replicas: 1, URL: "http://p-a"},
+	}, {
+		name:       "ready",
+		conditions: readyCondition(metav1.ConditionTrue, 2, ""),
+		want:       corev1alpha1.PipelineStepStatus{Name: "a", StepName: "p-a", Ready: true, Replicas: 1, URL: "http://p-a"},
+	}, {
+		name:       "ready for an older generation",
+		conditions: readyCondition(metav1.ConditionTrue, 1, ""),
+		want:       corev1alpha1.PipelineStepStatus{Name: "a", StepName: "p-a", Replicas: 1, URL: "http://p-a"},
+	}, {
+		name:       "not ready",
+		conditions: readyCondition(metav1.ConditionFalse, 2, "image pull failed"),
+		want:       corev1alpha1.PipelineStepStatus{Name: "a", StepName: "p-a", Replicas: 1, URL: "http://p-a", LastError: "image pull failed"},
+	}, {
+		name:       "pending",
+		conditions: readyCondition(metav1.ConditionUnknown, 2, "waiting for DeploymentReady"),
+		want:       corev1alpha1.PipelineStepStatus{Name: "a", StepName: "p-a", Replicas: 1, URL: "http://p-a"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := &corev1alpha1.Step{
+				ObjectMeta: metav1.ObjectMeta{Name: "p-a", Generation: 2},
+				Status: corev1alpha1.StepStatus{
+					Conditions: tt.conditions,
+					Replicas:   1,
+					URL:        "http://p-a",
+				},
+			}
+			if got := summarizeStep("a", step); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSetReadyCondition(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []corev1alpha1.PipelineStepStatus
+		status  metav1.ConditionStatus
+		reason  string
+		message string
+	}{{
+		name:   "no steps",
+		status: metav1.ConditionTrue,
+		reason: reasonStepsReady,
+	}, {
+		name:   "all ready",
+		steps:  []corev1alpha1.PipelineStepStatus{{Name: "a", Ready: true}, {Name: "b", Ready: true}},
+		status: metav1.ConditionTrue,
+		reason: reasonStepsReady,
+	}, {
+		name:    "some not ready",
+		steps:   []corev1alpha1.PipelineStepStatus{{Name: "a", Ready: true}, {Name: "b"}, {Name: "c", LastError: "failed"}},
+		status:  metav1.ConditionFalse,
+		reason:  reasonStepsNotReady,
+		message: "steps not ready: b, c",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPipeline("p")
+			p.Generation = 3
+			p.Status.Steps = tt.steps
+			setReadyCondition(p)
+
+			cond := meta.FindStatusCondition(p.Status.Conditions, corev1alpha1.PipelineConditionReady)
+			if cond == nil {
+				t.Fatal("expected Ready condition to be set")
+			}
+			if cond.Status != tt.status || cond.Reason != tt.reason || cond.Message != tt.message {
+				t.Errorf("expected %s/%s %q, got %s/%s %q", tt.status, tt.reason, tt.message, cond.Status, cond.Reason, cond.Message)
+			}
+			if cond.ObservedGeneration != 3 {
+				t.Errorf("expected observed generation 3, got %d", cond.ObservedGeneration)
+			}
+		})
+	}
+}
+
+func TestReconcileSummarizesSteps(t *testing.T) {
+	ctx := context.Background()
+	p := newPipeline("p", newTemplate("a"), newTemplate("b"))
+	p.Generation = 2
+
+	kc := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(p).Build()
+	if err := NewReconciler(kc).Reconcile(ctx, p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cond := meta.FindStatusCondition(p.Status.Conditions, corev1alpha1.PipelineConditionReady)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Message != "steps not ready: a, b" {
+		t.Fatalf("expected pipeline not to be ready until its steps are, got %+v", cond)
+	}
+
+	// mark both steps ready
+	for _, key := range []string{"a", "b"} {
+		step := &corev1alpha1.Step{}
+		if err := kc.Get(ctx, names.StepName(p, key), step); err != nil {
+			t.Fatal(err)
+		}
+		step.Status.Replicas = 2
+		step.Status.URL = "http://" + step.Name
+		step.Status.Conditions = []metav1.Condition{{
+			Type:               corev1alpha1.StepConditionReady,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: step.Generation,
+			Reason:             "Ready",
+		}}
+		if err := kc.Update(ctx, step); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := NewReconciler(kc).Reconcile(ctx, p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []corev1alpha1.PipelineStepStatus{
+		{Name: "a", StepName: "p-a", Ready: true, Replicas: 2, URL: "http://p-a"},
+		{Name: "b", StepName: "p-b", Ready: true, Replicas: 2, URL: "http://p-b"},
+	}
+	if len(p.Status.Steps) != len(want) {
+		t.Fatalf("expected %d steps in status, got %+v", len(want), p.Status.Steps)
+	}
+	for i := range want {
+		if p.Status.Steps[i] != want[i] {
+			t.Errorf("step %d: expected %+v, got %+v", i, want[i], p.Status.Steps[i])
+		}
+	}
+	cond = meta.FindStatusCondition(p.Status.Conditions, corev1alpha1.PipelineConditionReady)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.ObservedGeneration != 2 {
+		t.Errorf("expected pipeline to be ready, got %+v", cond)
+	}
+}
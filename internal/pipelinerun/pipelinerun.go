@@ -0,0 +1,310 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipelinerun
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/piper"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// how often to poll piper for the progress of a running job
+	pollInterval = 5 * time.Second
+	// how often to check whether the pipeline of a pending run is ready
+	pendingInterval = 10 * time.Second
+)
+
+// reasons surfaced on the Succeeded condition
+const (
+	reasonPending          = "Pending"
+	reasonSubmitted        = "Submitted"
+	reasonPiperDisabled    = "PiperDisabled"
+	reasonPipelineNotFound = "PipelineNotFound"
+	reasonPipelineNotReady = "PipelineNotReady"
+	reasonRunning          = "Running"
+	reasonSucceeded        = "Succeeded"
+	reasonFailed           = "Failed"
+	reasonCancelled        = "Cancelled"
+)
+
+type Client struct {
+	kclient kclient.Client
+	piperc  *piper.Client
+}
+
+// New returns a client reconciling pipeline runs. Runs stay pending when piperc is nil.
+func New(client kclient.Client, piperc *piper.Client) *Client {
+	return &Client{
+		kclient: client,
+		piperc:  piperc,
+	}
+}
+
+func (c *Client) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	run := &corev1alpha1.PipelineRun{}
+	err := c.kclient.Get(ctx, req.NamespacedName, run)
+	if err != nil {
+		if apierr.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("failed to retrieve latest pipelinerun %s: %w", req.NamespacedName, err)
+	}
+
+	// finished runs are a record of what happened, leave them be
+	if run.Status.Phase.IsFinished() {
+		return ctrl.Result{}, nil
+	}
+
+	original := run.DeepCopy()
+	result, reconcileErr := c.reconcile(ctx, run)
+
+	if !equality.Semantic.DeepEqual(original.Status, run.Status) {
+		if err := c.kclient.Status().Update(ctx, run); err != nil && reconcileErr == nil {
+			reconcileErr = fmt.Errorf("failed to update status of pipelinerun %s: %w", req.NamespacedName, err)
+		}
+	}
+
+	return result, reconcileErr
+}
+
+func (c *Client) reconcile(ctx context.Context, run *corev1alpha1.PipelineRun) (ctrl.Result, error) {
+	if run.Status.Phase == "" {
+		markPending(run, reasonPending, "waiting for run to be submitted")
+	}
+
+	if run.Status.JobID == "" {
+		if run.Spec.Cancelled {
+			markFinished(run, corev1alpha1.PipelineRunCancelled, "run was cancelled before it was submitted")
+			return ctrl.Result{}, nil
+		}
+		return c.submit(ctx, run)
+	}
+
+	if c.piperc == nil {
+		// the run was submitted before piper was disabled, nothing to observe
+		return ctrl.Result{}, nil
+	}
+
+	job, err := c.piperc.GetJob(ctx, run.Status.JobID)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if run.Spec.Cancelled {
+		return ctrl.Result{}, c.cancel(ctx, run, job)
+	}
+	if run.Status.StartTime == nil && (job.State == "" || job.State == piper.JobStatePending) {
+		// the job was created but running it failed or wasn't recorded, resume it
+		return c.start(ctx, run)
+	}
+	observeJob(run, job)
+
+	if run.Status.Phase.IsFinished() {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: pollInterval}, nil
+}
+
+// submit starts a job for the run once its pipeline is registered with piper and ready.
+func (c *Client) submit(ctx context.Context, run *corev1alpha1.PipelineRun) (ctrl.Result, error) {
+	if c.piperc == nil {
+		markPending(run, reasonPiperDisabled, "the controller is not configured with a kai-piper address")
+		return ctrl.Result{}, nil
+	}
+
+	p := &corev1alpha1.Pipeline{}
+	name := types.NamespacedName{Namespace: run.Namespace, Name: run.Spec.PipelineRef.Name}
+	err := c.kclient.Get(ctx, name, p)
+	if apierr.IsNotFound(err) {
+		markPending(run, reasonPipelineNotFound, fmt.Sprintf("pipeline %q not found", name.Name))
+		return ctrl.Result{RequeueAfter: pendingInterval}, nil
+	} else if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to get pipeline %q: %w", name, err)
+	}
+
+	if p.Status.Piper == nil || p.Status.Piper.PipelineID == "" ||
+		!meta.IsStatusConditionTrue(p.Status.Conditions, corev1alpha1.PipelineConditionReady) {
+		markPending(run, reasonPipelineNotReady, fmt.Sprintf("pipeline %q is not ready or not registered with piper", name.Name))
+		return ctrl.Result{RequeueAfter: pendingInterval}, nil
+	}
+
+	job := &piper.Job{PipelineID: p.Status.Piper.PipelineID}
+	if run.Spec.Inputs != nil {
+		job.Inputs = run.Spec.Inputs.Raw
+	}
+	job, err = c.piperc.CreateJob(ctx, job)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// record the job before running it so failures from here on resume the job rather than
+	// creating another one
+	status := run.Status.DeepCopy()
+	run.Status.JobID = job.ID
+	markPending(run, reasonSubmitted, fmt.Sprintf("submitted to piper as job %q", job.ID))
+	if err := c.kclient.Status().Update(ctx, run); err != nil {
+		run.Status = *status
+		// the run doesn't know about the job, don't leave it behind to be created again
+		if cerr := c.piperc.CancelJob(ctx, job.ID); cerr != nil {
+			log.FromContext(ctx).Error(cerr, "failed to cancel unrecorded job", "job", job.ID)
+		}
+		return ctrl.Result{}, fmt.Errorf("failed to record job %q on pipelinerun %s: %w", job.ID, run.NamespacedName(), err)
+	}
+
+	return c.start(ctx, run)
+}
+
+// cancel cancels the job of the run. A job which finished before it could be cancelled can't be
+// cancelled anymore, the run records how it finished instead.
+func (c *Client) cancel(ctx context.Context, run *corev1alpha1.PipelineRun, job *piper.Job) error {
+	if phaseFor(job.State).IsFinished() {
+		observeJob(run, job)
+		return nil
+	}
+
+	if err := c.piperc.CancelJob(ctx, job.ID); err != nil {
+		// piper rejects cancelling a job which finished since it was read
+		latest, gerr := c.piperc.GetJob(ctx, job.ID)
+		if gerr != nil || !phaseFor(latest.State).IsFinished() {
+			return err
+		}
+		observeJob(run, latest)
+		return nil
+	}
+	markFinished(run, corev1alpha1.PipelineRunCancelled, "run was cancelled")
+	return nil
+}
+
+// start runs the job submitted for the run.
+func (c *Client) start(ctx context.Context, run *corev1alpha1.PipelineRun) (ctrl.Result, error) {
+	if err := c.piperc.RunJob(ctx, run.Status.JobID); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	run.Status.StartTime = &now
+	run.Status.Phase = corev1alpha1.PipelineRunRunning
+	meta.SetStatusCondition(&run.Status.Conditions, metav1.Condition{
+		Type:               corev1alpha1.PipelineRunConditionSucceeded,
+		Status:             metav1.ConditionUnknown,
+		ObservedGeneration: run.Generation,
+		Reason:             reasonRunning,
+		Message:            fmt.Sprintf("running as piper job %q", run.Status.JobID),
+	})
+
+	return ctrl.Result{RequeueAfter: pollInterval}, nil
+}
+
+// observeJob records the progress of the piper job on the run.
+func observeJob(run *corev1alpha1.PipelineRun, job *piper.Job) {
+	steps := make([]corev1alpha1.PipelineRunStepStatus, 0, len(job.Steps))
+	for _, s := range job.Steps {
+		status := corev1alpha1.PipelineRunStepStatus{
+			Name:           s.Name,
+			Phase:          phaseFor(s.State),
+			StartTime:      toTime(s.StartTime),
+			CompletionTime: toTime(s.EndTime),
+			Message:        s.Error,
+		}
+		if len(s.Output) > 0 {
+			status.Output = &runtime.RawExtension{Raw: s.Output}
+		}
+		steps = append(steps, status)
+	}
+	run.Status.Steps = steps
+
+	switch phase := phaseFor(job.State); phase {
+	case corev1alpha1.PipelineRunSucceeded:
+		markFinished(run, phase, "all steps completed")
+	case corev1alpha1.PipelineRunFailed:
+		markFinished(run, phase, job.Error)
+	case corev1alpha1.PipelineRunCancelled:
+		markFinished(run, phase, "run was cancelled")
+	default:
+		run.Status.Phase = corev1alpha1.PipelineRunRunning
+	}
+}
+
+func phaseFor(state piper.JobState) corev1alpha1.PipelineRunPhase {
+	switch state {
+	case piper.JobStateRunning:
+		return corev1alpha1.PipelineRunRunning
+	case piper.JobStateSucceeded:
+		return corev1alpha1.PipelineRunSucceeded
+	case piper.JobStateFailed:
+		return corev1alpha1.PipelineRunFailed
+	case piper.JobStateCancelled:
+		return corev1alpha1.PipelineRunCancelled
+	default:
+		return corev1alpha1.PipelineRunPending
+	}
+}
+
+func toTime(t *time.Time) *metav1.Time {
+	if t == nil {
+		return nil
+	}
+	out := metav1.NewTime(*t)
+	return &out
+}
+
+func markPending(run *corev1alpha1.PipelineRun, reason, message string) {
+	run.Status.Phase = corev1alpha1.PipelineRunPending
+	meta.SetStatusCondition(&run.Status.Conditions, metav1.Condition{
+		Type:               corev1alpha1.PipelineRunConditionSucceeded,
+		Status:             metav1.ConditionUnknown,
+		ObservedGeneration: run.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+func markFinished(run *corev1alpha1.PipelineRun, phase corev1alpha1.PipelineRunPhase, message string) {
+	now := metav1.Now()
+	run.Status.Phase = phase
+	run.Status.CompletionTime = &now
+
+	cond := metav1.Condition{
+		Type:               corev1alpha1.PipelineRunConditionSucceeded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: run.Generation,
+		Message:            message,
+	}
+	switch phase {
+	case corev1alpha1.PipelineRunSucceeded:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = reasonSucceeded
+	case corev1alpha1.PipelineRunCancelled:
+		cond.Reason = reasonCancelled
+	default:
+		cond.Reason = reasonFailed
+	}
+	meta.SetStatusCondition(&run.Status.Conditions, cond)
+}
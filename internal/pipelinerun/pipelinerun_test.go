@@ -0,0 +1,397 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipelinerun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/piper"
+	corev1 "k8s.io/api/core/v1"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// fakePiper is a local stand-in for the piper API storing jobs in memory.
+type fakePiper struct {
+	mu     sync.Mutex
+	nextID int
+	jobs   map[string]*piper.Job
+	// runs counts the calls to run each job
+	runs map[string]int
+	// failRuns is the number of calls to run a job failing before one succeeds
+	failRuns int
+	// finishOnCancel is the state a job finishes in right before a call to cancel it
+	finishOnCancel piper.JobState
+}
+
+func newFakePiper() *fakePiper {
+	return &fakePiper{jobs: map[string]*piper.Job{}, runs: map[string]int{}}
+}
+
+func (f *fakePiper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1alpha1/pipelineJobs")
+	id, action, _ := strings.Cut(strings.TrimPrefix(path, "/"), ":")
+	if id != "" && f.jobs[id] == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		job := &piper.Job{}
+		_ = json.NewDecoder(r.Body).Decode(job)
+		f.nextID++
+		job.ID = fmt.Sprintf("job-%d", f.nextID)
+		job.State = piper.JobStatePending
+		f.jobs[job.ID] = job
+		_ = json.NewEncoder(w).Encode(job)
+	case r.Method == http.MethodPost && action == "run":
+		f.runs[id]++
+		if f.failRuns > 0 {
+			f.failRuns--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		f.jobs[id].State = piper.JobStateRunning
+	case r.Method == http.MethodPost && action == "cancel":
+		if f.finishOnCancel != "" {
+			f.jobs[id].State = f.finishOnCancel
+		}
+		switch f.jobs[id].State {
+		case piper.JobStateSucceeded, piper.JobStateFailed, piper.JobStateCancelled:
+			http.Error(w, "job is finished", http.StatusConflict)
+			return
+		}
+		f.jobs[id].State = piper.JobStateCancelled
+	case r.Method == http.MethodGet && id != "":
+		_ = json.NewEncoder(w).Encode(f.jobs[id])
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func (f *fakePiper) job(id string) piper.Job {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return *f.jobs[id]
+}
+
+func newRun() *corev1alpha1.PipelineRun {
+	return &corev1alpha1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "default", Generation: 1},
+		Spec: corev1alpha1.PipelineRunSpec{
+			PipelineRef: corev1.LocalObjectReference{Name: "ensemble"},
+		},
+	}
+}
+
+func newReadyPipeline() *corev1alpha1.Pipeline {
+	return &corev1alpha1.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{Name: "ensemble", Namespace: "default"},
+		Status: corev1alpha1.PipelineStatus{
+			Conditions: []metav1.Condition{{
+				Type:   corev1alpha1.PipelineConditionReady,
+				Status: metav1.ConditionTrue,
+				Reason: "StepsReady",
+			}},
+			Piper: &corev1alpha1.PiperStatus{PipelineID: "pipeline-1"},
+		},
+	}
+}
+
+type fixture struct {
+	t      *testing.T
+	piper  *fakePiper
+	client kclient.Client
+	runc   *Client
+}
+
+func newFixture(t *testing.T, funcs *interceptor.Funcs, objs ...kclient.Object) *fixture {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	builder := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithStatusSubresource(&corev1alpha1.PipelineRun{})
+	if funcs != nil {
+		builder = builder.WithInterceptorFuncs(*funcs)
+	}
+	kc := builder.Build()
+
+	fp := newFakePiper()
+	server := httptest.NewServer(fp)
+	t.Cleanup(server.Close)
+	pc, err := piper.New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &fixture{t: t, piper: fp, client: kc, runc: New(kc, pc)}
+}
+
+// reconcile reconciles the run and returns its latest state.
+func (f *fixture) reconcile() (*corev1alpha1.PipelineRun, error) {
+	f.t.Helper()
+
+	req := ctrl.Request{NamespacedName: newRun().NamespacedName()}
+	_, err := f.runc.Reconcile(context.Background(), req)
+
+	run := &corev1alpha1.PipelineRun{}
+	if gerr := f.client.Get(context.Background(), req.NamespacedName, run); gerr != nil {
+		f.t.Fatal(gerr)
+	}
+	return run, err
+}
+
+func TestReconcileSubmitsRun(t *testing.T) {
+	f := newFixture(t, nil, newRun(), newReadyPipeline())
+
+	run, err := f.reconcile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if run.Status.JobID != "job-1" || run.Status.Phase != corev1alpha1.PipelineRunRunning || run.Status.StartTime == nil {
+		t.Fatalf("expected run to be running as job-1, got %+v", run.Status)
+	}
+	if got := f.piper.job("job-1"); got.PipelineID != "pipeline-1" || got.State != piper.JobStateRunning {
+		t.Errorf("expected job of pipeline-1 to be running, got %+v", got)
+	}
+
+	// further reconciles observe the job instead of submitting another one
+	if _, err := f.reconcile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(f.piper.jobs) != 1 || f.piper.runs["job-1"] != 1 {
+		t.Errorf("expected a single job run once, got %d jobs and %d runs", len(f.piper.jobs), f.piper.runs["job-1"])
+	}
+}
+
+func TestReconcileWaitsForPipeline(t *testing.T) {
+	p := newReadyPipeline()
+	p.Status.Conditions[0].Status = metav1.ConditionFalse
+	f := newFixture(t, nil, newRun(), p)
+
+	run, err := f.reconcile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cond := meta.FindStatusCondition(run.Status.Conditions, corev1alpha1.PipelineRunConditionSucceeded)
+	if run.Status.Phase != corev1alpha1.PipelineRunPending || cond == nil || cond.Reason != reasonPipelineNotReady {
+		t.Errorf("expected run to wait for the pipeline, got %+v", run.Status)
+	}
+	if len(f.piper.jobs) != 0 {
+		t.Errorf("expected no job to be created, got %d", len(f.piper.jobs))
+	}
+}
+
+func TestReconcileResumesRunAfterRunJobError(t *testing.T) {
+	f := newFixture(t, nil, newRun(), newReadyPipeline())
+	f.piper.failRuns = 1
+
+	run, err := f.reconcile()
+	if err == nil {
+		t.Fatal("expected error running the job")
+	}
+	// the job is recorded even though it couldn't be run
+	cond := meta.FindStatusCondition(run.Status.Conditions, corev1alpha1.PipelineRunConditionSucceeded)
+	if run.Status.JobID != "job-1" || run.Status.Phase != corev1alpha1.PipelineRunPending || cond == nil || cond.Reason != reasonSubmitted {
+		t.Fatalf("expected submitted job to be recorded, got %+v", run.Status)
+	}
+
+	run, err = f.reconcile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if run.Status.JobID != "job-1" || run.Status.Phase != corev1alpha1.PipelineRunRunning || run.Status.StartTime == nil {
+		t.Fatalf("expected run to be running as job-1, got %+v", run.Status)
+	}
+	if len(f.piper.jobs) != 1 || f.piper.runs["job-1"] != 2 {
+		t.Errorf("expected job-1 to be run again, got %d jobs and %d runs", len(f.piper.jobs), f.piper.runs["job-1"])
+	}
+}
+
+func TestReconcileCancelsUnrecordedJob(t *testing.T) {
+	conflict := &interceptor.Funcs{
+		SubResourceUpdate: func(ctx context.Context, c kclient.Client, subResource string, obj kclient.Object, opts ...kclient.SubResourceUpdateOption) error {
+			return apierr.NewConflict(schema.GroupResource{Group: "core.kai.io", Resource: "pipelineruns"}, obj.GetName(), errors.New("modified"))
+		},
+	}
+	f := newFixture(t, conflict, newRun(), newReadyPipeline())
+
+	if _, err := f.reconcile(); err == nil {
+		t.Fatal("expected error recording the job")
+	}
+	if got := f.piper.job("job-1"); got.State != piper.JobStateCancelled {
+		t.Errorf("expected unrecorded job to be cancelled, got %s", got.State)
+	}
+	if f.piper.runs["job-1"] != 0 {
+		t.Errorf("expected unrecorded job not to be run, got %d runs", f.piper.runs["job-1"])
+	}
+}
+
+func TestReconcileTracksJob(t *testing.T) {
+	f := newFixture(t, nil, newRun(), newReadyPipeline())
+	if _, err := f.reconcile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f.piper.mu.Lock()
+	f.piper.jobs["job-1"].Steps = []piper.JobStep{
+		{Name: "features", State: piper.JobStateSucceeded, Output: json.RawMessage(`{"features":[1,2]}`)},
+		{Name: "classifier", State: piper.JobStateRunning},
+	}
+	f.piper.mu.Unlock()
+
+	run, err := f.reconcile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if run.Status.Phase != corev1alpha1.PipelineRunRunning || len(run.Status.Steps) != 2 {
+		t.Fatalf("expected running run with 2 steps, got %+v", run.Status)
+	}
+	if run.Status.Steps[0].Phase != corev1alpha1.PipelineRunSucceeded || run.Status.Steps[0].Output == nil {
+		t.Errorf("expected first step to have succeeded with output, got %+v", run.Status.Steps[0])
+	}
+	if run.Status.Steps[1].Phase != corev1alpha1.PipelineRunRunning {
+		t.Errorf("expected second step to be running, got %+v", run.Status.Steps[1])
+	}
+
+	f.piper.mu.Lock()
+	f.piper.jobs["job-1"].State = piper.JobStateFailed
+	f.piper.jobs["job-1"].Error = "classifier failed"
+	f.piper.mu.Unlock()
+
+	run, err = f.reconcile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cond := meta.FindStatusCondition(run.Status.Conditions, corev1alpha1.PipelineRunConditionSucceeded)
+	if run.Status.Phase != corev1alpha1.PipelineRunFailed || run.Status.CompletionTime == nil ||
+		cond == nil || cond.Status != metav1.ConditionFalse || cond.Message != "classifier failed" {
+		t.Errorf("expected run to have failed, got %+v", run.Status)
+	}
+}
+
+func TestReconcileCancelsRun(t *testing.T) {
+	f := newFixture(t, nil, newRun(), newReadyPipeline())
+	run, err := f.reconcile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	run.Spec.Cancelled = true
+	if err := f.client.Update(context.Background(), run); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err = f.reconcile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if run.Status.Phase != corev1alpha1.PipelineRunCancelled || run.Status.CompletionTime == nil {
+		t.Errorf("expected run to be cancelled, got %+v", run.Status)
+	}
+	if got := f.piper.job("job-1"); got.State != piper.JobStateCancelled {
+		t.Errorf("expected job to be cancelled, got %s", got.State)
+	}
+}
+
+func TestReconcileCancelsFinishedRun(t *testing.T) {
+	tests := []struct {
+		name string
+		// state is the state of the job when the run is cancelled
+		state piper.JobState
+		// finishOnCancel is the state the job finishes in while it is being cancelled
+		finishOnCancel piper.JobState
+		want           corev1alpha1.PipelineRunPhase
+	}{
+		{name: "succeeded", state: piper.JobStateSucceeded, want: corev1alpha1.PipelineRunSucceeded},
+		{name: "failed", state: piper.JobStateFailed, want: corev1alpha1.PipelineRunFailed},
+		{name: "finished while cancelling", state: piper.JobStateRunning, finishOnCancel: piper.JobStateSucceeded, want: corev1alpha1.PipelineRunSucceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, nil, newRun(), newReadyPipeline())
+			run, err := f.reconcile()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			f.piper.mu.Lock()
+			f.piper.jobs["job-1"].State = tt.state
+			f.piper.finishOnCancel = tt.finishOnCancel
+			f.piper.mu.Unlock()
+
+			run.Spec.Cancelled = true
+			if err := f.client.Update(context.Background(), run); err != nil {
+				t.Fatal(err)
+			}
+
+			// piper doesn't cancel finished jobs, the run records how the job finished
+			run, err = f.reconcile()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if run.Status.Phase != tt.want || run.Status.CompletionTime == nil {
+				t.Errorf("expected run to be %s, got %+v", tt.want, run.Status)
+			}
+		})
+	}
+}
+
+func TestReconcileCancelsUnsubmittedRun(t *testing.T) {
+	run := newRun()
+	run.Spec.Cancelled = true
+	f := newFixture(t, nil, run, newReadyPipeline())
+
+	run, err := f.reconcile()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if run.Status.Phase != corev1alpha1.PipelineRunCancelled || run.Status.JobID != "" {
+		t.Errorf("expected run to be cancelled without a job, got %+v", run.Status)
+	}
+	if len(f.piper.jobs) != 0 {
+		t.Errorf("expected no job to be created, got %d", len(f.piper.jobs))
+	}
+}
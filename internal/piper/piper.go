@@ -0,0 +1,203 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package piper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the requested resource doesn't exist within piper.
+var ErrNotFound = errors.New("not found")
+
+// Pipeline is the definition of a pipeline registered with piper.
+type Pipeline struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Steps []Step `json:"steps"`
+}
+
+// Step is a single step of a pipeline definition. Piper calls the endpoint of each step once
+// all of the steps it depends on have completed.
+type Step struct {
+	Name      string   `json:"name"`
+	Endpoint  string   `json:"endpoint"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// Client talks to the kai-piper API.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+}
+
+// New returns a client for the piper server at the given address.
+func New(address string) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(address, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid piper address %q: %w", address, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid piper address %q: must include scheme and host", address)
+	}
+
+	return &Client{
+		baseURL: u,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+func (c *Client) CreatePipeline(ctx context.Context, p *Pipeline) (*Pipeline, error) {
+	out := &Pipeline{}
+	err := c.do(ctx, http.MethodPost, "/v1alpha1/pipelines", p, out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pipeline %q: %w", p.Name, err)
+	}
+	return out, nil
+}
+
+func (c *Client) UpdatePipeline(ctx context.Context, p *Pipeline) (*Pipeline, error) {
+	out := &Pipeline{}
+	err := c.do(ctx, http.MethodPut, "/v1alpha1/pipelines/"+url.PathEscape(p.ID), p, out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update pipeline %q: %w", p.ID, err)
+	}
+	return out, nil
+}
+
+func (c *Client) DeletePipeline(ctx context.Context, id string) error {
+	err := c.do(ctx, http.MethodDelete, "/v1alpha1/pipelines/"+url.PathEscape(id), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete pipeline %q: %w", id, err)
+	}
+	return nil
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response into out if set.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL.String()+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// JobState is the execution state of a pipeline job or one of its steps.
+type JobState string
+
+// job states reported by piper
+const (
+	JobStatePending   JobState = "PENDING"
+	JobStateRunning   JobState = "RUNNING"
+	JobStateSucceeded JobState = "SUCCEEDED"
+	JobStateFailed    JobState = "FAILED"
+	JobStateCancelled JobState = "CANCELLED"
+)
+
+// Job is a single execution of a registered pipeline.
+type Job struct {
+	ID         string          `json:"id,omitempty"`
+	PipelineID string          `json:"pipelineId"`
+	Inputs     json.RawMessage `json:"inputs,omitempty"`
+	State      JobState        `json:"state,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Steps      []JobStep       `json:"steps,omitempty"`
+}
+
+// JobStep reports the execution of a single step of a job.
+type JobStep struct {
+	Name      string          `json:"name"`
+	State     JobState        `json:"state"`
+	StartTime *time.Time      `json:"startTime,omitempty"`
+	EndTime   *time.Time      `json:"endTime,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+func (c *Client) CreateJob(ctx context.Context, j *Job) (*Job, error) {
+	out := &Job{}
+	err := c.do(ctx, http.MethodPost, "/v1alpha1/pipelineJobs", j, out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job for pipeline %q: %w", j.PipelineID, err)
+	}
+	return out, nil
+}
+
+func (c *Client) RunJob(ctx context.Context, id string) error {
+	err := c.do(ctx, http.MethodPost, "/v1alpha1/pipelineJobs/"+url.PathEscape(id)+":run", nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to run job %q: %w", id, err)
+	}
+	return nil
+}
+
+func (c *Client) GetJob(ctx context.Context, id string) (*Job, error) {
+	out := &Job{}
+	err := c.do(ctx, http.MethodGet, "/v1alpha1/pipelineJobs/"+url.PathEscape(id), nil, out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job %q: %w", id, err)
+	}
+	return out, nil
+}
+
+func (c *Client) CancelJob(ctx context.Context, id string) error {
+	err := c.do(ctx, http.MethodPost, "/v1alpha1/pipelineJobs/"+url.PathEscape(id)+":cancel", nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to cancel job %q: %w", id, err)
+	}
+	return nil
+}
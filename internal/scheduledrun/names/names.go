@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package names
+
+import (
+	"fmt"
+	"time"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/kmap"
+)
+
+// RunName returns the name of the run scheduled for the given time. Names are derived from the
+// scheduled time so a run is only ever created once per schedule.
+func RunName(s *corev1alpha1.ScheduledPipelineRun, scheduled time.Time) types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: s.Namespace,
+		Name:      fmt.Sprintf("%s-%d", s.GetName(), scheduled.Unix()/60),
+	}
+}
+
+// MakeLabels returns the labels of a run created on schedule, those set on the run template
+// are kept.
+func MakeLabels(s *corev1alpha1.ScheduledPipelineRun) map[string]string {
+	return kmap.Union(s.Spec.RunTemplate.Labels, map[string]string{
+		kai.ScheduledPipelineRunLabelKey:    s.Name,
+		kai.ScheduledPipelineRunUIDLabelKey: string(s.UID),
+	})
+}
+
+// MakeAnnotations returns the annotations of a run created on schedule, recording the time the
+// run was scheduled for.
+func MakeAnnotations(s *corev1alpha1.ScheduledPipelineRun, scheduled time.Time) map[string]string {
+	return kmap.Union(s.Spec.RunTemplate.Annotations, map[string]string{
+		kai.ScheduledTimeAnnotationKey: scheduled.Format(time.RFC3339),
+	})
+}
+
+func MakeSelector(s *corev1alpha1.ScheduledPipelineRun) *metav1.LabelSelector {
+	return &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			kai.ScheduledPipelineRunUIDLabelKey: string(s.UID),
+		},
+	}
+}
@@ -0,0 +1,365 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduledrun
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	"github.com/dreamstax/kai/internal/scheduledrun/names"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/kmeta"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// the number of missed schedules after which the missed runs are reported as skipped,
+// this mirrors the limit CronJobs use
+const maxMissedSchedules = 100
+
+// reasons surfaced on the Scheduled condition
+const (
+	reasonOnSchedule             = "OnSchedule"
+	reasonInvalidSchedule        = "InvalidSchedule"
+	reasonTooManyMissedSchedules = "TooManyMissedSchedules"
+)
+
+type Client struct {
+	kclient kclient.Client
+	now     func() time.Time
+}
+
+func New(client kclient.Client) *Client {
+	return &Client{
+		kclient: client,
+		now:     time.Now,
+	}
+}
+
+func (c *Client) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	s := &corev1alpha1.ScheduledPipelineRun{}
+	err := c.kclient.Get(ctx, req.NamespacedName, s)
+	if err != nil {
+		if apierr.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("failed to retrieve latest scheduledpipelinerun %s: %w", req.NamespacedName, err)
+	}
+
+	original := s.DeepCopy()
+	result, reconcileErr := c.reconcile(ctx, s)
+
+	if !equality.Semantic.DeepEqual(original.Status, s.Status) {
+		if err := c.kclient.Status().Update(ctx, s); err != nil && reconcileErr == nil {
+			reconcileErr = fmt.Errorf("failed to update status of scheduledpipelinerun %s: %w", req.NamespacedName, err)
+		}
+	}
+
+	return result, reconcileErr
+}
+
+func (c *Client) reconcile(ctx context.Context, s *corev1alpha1.ScheduledPipelineRun) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	runs, err := c.listRuns(ctx, s)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	active, successful, failed := []*corev1alpha1.PipelineRun{}, []*corev1alpha1.PipelineRun{}, []*corev1alpha1.PipelineRun{}
+	for i := range runs {
+		run := &runs[i]
+		switch run.Status.Phase {
+		case corev1alpha1.PipelineRunSucceeded:
+			successful = append(successful, run)
+		case corev1alpha1.PipelineRunFailed, corev1alpha1.PipelineRunCancelled:
+			failed = append(failed, run)
+		default:
+			active = append(active, run)
+		}
+
+		scheduled := scheduledTime(run)
+		if scheduled == nil {
+			continue
+		}
+		if s.Status.LastScheduleTime == nil || s.Status.LastScheduleTime.Before(scheduled) {
+			s.Status.LastScheduleTime = scheduled
+		}
+		if run.Status.Phase == corev1alpha1.PipelineRunSucceeded && run.Status.CompletionTime != nil &&
+			(s.Status.LastSuccessfulTime == nil || s.Status.LastSuccessfulTime.Before(run.Status.CompletionTime)) {
+			s.Status.LastSuccessfulTime = run.Status.CompletionTime
+		}
+	}
+
+	s.Status.Active = nil
+	for _, run := range active {
+		s.Status.Active = append(s.Status.Active, corev1.ObjectReference{
+			APIVersion:      corev1alpha1.GroupVersion.String(),
+			Kind:            "PipelineRun",
+			Namespace:       run.Namespace,
+			Name:            run.Name,
+			UID:             run.UID,
+			ResourceVersion: run.ResourceVersion,
+		})
+	}
+
+	if err := c.pruneHistory(ctx, successful, s.Spec.SuccessfulRunsHistoryLimit); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := c.pruneHistory(ctx, failed, s.Spec.FailedRunsHistoryLimit); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if s.Spec.Suspend != nil && *s.Spec.Suspend {
+		return ctrl.Result{}, nil
+	}
+
+	sched, err := parseSchedule(s)
+	if err != nil {
+		// the schedule won't become valid until the spec changes, don't requeue
+		logger.Error(err, "invalid schedule", "scheduledpipelinerun", s.NamespacedName())
+		setScheduledCondition(s, metav1.ConditionFalse, reasonInvalidSchedule, err.Error())
+		return ctrl.Result{}, nil
+	}
+
+	now := c.now()
+	missed, next, count := nextSchedules(s, sched, now)
+	result := ctrl.Result{RequeueAfter: next.Sub(now)}
+
+	if missed.IsZero() {
+		return result, nil
+	}
+	if count > maxMissedSchedules {
+		// like CronJobs, skip the missed runs and carry on with the most recent one
+		logger.Info("too many missed start times, starting the most recent", "missed", count, "scheduled", missed)
+		setScheduledCondition(s, metav1.ConditionFalse, reasonTooManyMissedSchedules,
+			fmt.Sprintf("more than %d start times were missed, only the run scheduled at %s was started; set or decrease startingDeadlineSeconds",
+				maxMissedSchedules, missed.Format(time.RFC3339)))
+	}
+
+	if s.Spec.StartingDeadlineSeconds != nil &&
+		missed.Add(time.Duration(*s.Spec.StartingDeadlineSeconds)*time.Second).Before(now) {
+		logger.Info("missed starting deadline for last run, waiting for next schedule", "scheduled", missed)
+		return result, nil
+	}
+
+	switch s.Spec.ConcurrencyPolicy {
+	case corev1alpha1.ForbidConcurrent:
+		if len(active) > 0 {
+			logger.Info("concurrency policy blocks concurrent runs, skipping", "active", len(active))
+			return result, nil
+		}
+	case corev1alpha1.ReplaceConcurrent:
+		for _, run := range active {
+			if err := c.cancelRun(ctx, run); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	run := makeRun(s, missed)
+	err = c.kclient.Create(ctx, run)
+	if err != nil && !apierr.IsAlreadyExists(err) {
+		return ctrl.Result{}, fmt.Errorf("failed to create pipelinerun %q: %w", run.Name, err)
+	}
+
+	scheduled := metav1.NewTime(missed)
+	s.Status.LastScheduleTime = &scheduled
+	if count <= maxMissedSchedules {
+		setScheduledCondition(s, metav1.ConditionTrue, reasonOnSchedule, "")
+	}
+	if err == nil {
+		s.Status.Active = append(s.Status.Active, corev1.ObjectReference{
+			APIVersion: corev1alpha1.GroupVersion.String(),
+			Kind:       "PipelineRun",
+			Namespace:  run.Namespace,
+			Name:       run.Name,
+			UID:        run.UID,
+		})
+	}
+
+	return result, nil
+}
+
+// listRuns returns the runs created by the scheduled run.
+func (c *Client) listRuns(ctx context.Context, s *corev1alpha1.ScheduledPipelineRun) ([]corev1alpha1.PipelineRun, error) {
+	selector, err := metav1.LabelSelectorAsSelector(names.MakeSelector(s))
+	if err != nil {
+		return nil, fmt.Errorf("failed to make selector for scheduledpipelinerun %q: %w", s.NamespacedName(), err)
+	}
+
+	runs := &corev1alpha1.PipelineRunList{}
+	err = c.kclient.List(ctx, runs, kclient.InNamespace(s.Namespace), kclient.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pipelineruns for scheduledpipelinerun %q: %w", s.NamespacedName(), err)
+	}
+
+	return runs.Items, nil
+}
+
+// pruneHistory deletes the oldest finished runs beyond the history limit.
+func (c *Client) pruneHistory(ctx context.Context, runs []*corev1alpha1.PipelineRun, limit *int32) error {
+	if limit == nil || len(runs) <= int(*limit) {
+		return nil
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreationTimestamp.Before(&runs[j].CreationTimestamp)
+	})
+	for _, run := range runs[:len(runs)-int(*limit)] {
+		err := c.kclient.Delete(ctx, run, kclient.PropagationPolicy(metav1.DeletePropagationBackground))
+		if kclient.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete pipelinerun %q: %w", run.NamespacedName(), err)
+		}
+	}
+
+	return nil
+}
+
+// cancelRun requests an active run be stopped, the run is kept as part of the history.
+func (c *Client) cancelRun(ctx context.Context, run *corev1alpha1.PipelineRun) error {
+	if run.Spec.Cancelled {
+		return nil
+	}
+
+	out := run.DeepCopy()
+	out.Spec.Cancelled = true
+	if err := c.kclient.Update(ctx, out); err != nil {
+		return fmt.Errorf("failed to cancel pipelinerun %q: %w", run.NamespacedName(), err)
+	}
+
+	return nil
+}
+
+func makeRun(s *corev1alpha1.ScheduledPipelineRun, scheduled time.Time) *corev1alpha1.PipelineRun {
+	name := names.RunName(s, scheduled)
+	return &corev1alpha1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name.Name,
+			Namespace:       name.Namespace,
+			Labels:          names.MakeLabels(s),
+			Annotations:     names.MakeAnnotations(s, scheduled),
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(s)},
+		},
+		Spec: *s.Spec.RunTemplate.Spec.DeepCopy(),
+	}
+}
+
+func parseSchedule(s *corev1alpha1.ScheduledPipelineRun) (cron.Schedule, error) {
+	spec := s.Spec.Schedule
+	if s.Spec.TimeZone != nil && *s.Spec.TimeZone != "" {
+		spec = fmt.Sprintf("CRON_TZ=%s %s", *s.Spec.TimeZone, spec)
+	}
+
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("unparseable schedule %q: %w", s.Spec.Schedule, err)
+	}
+	return sched, nil
+}
+
+// nextSchedules returns the most recent scheduled time which has not been run yet (zero if
+// there is none), the next time a run is scheduled and the number of scheduled times missed.
+// The count stops being exact once it exceeds maxMissedSchedules.
+func nextSchedules(s *corev1alpha1.ScheduledPipelineRun, sched cron.Schedule, now time.Time) (time.Time, time.Time, int) {
+	earliest := s.CreationTimestamp.Time
+	if s.Status.LastScheduleTime != nil {
+		earliest = s.Status.LastScheduleTime.Time
+	}
+	if s.Spec.StartingDeadlineSeconds != nil {
+		// runs missed by more than the deadline will never start, don't count them
+		deadline := now.Add(-time.Duration(*s.Spec.StartingDeadlineSeconds) * time.Second)
+		if deadline.After(earliest) {
+			earliest = deadline
+		}
+	}
+	if earliest.After(now) {
+		return time.Time{}, sched.Next(now), 0
+	}
+
+	var missed time.Time
+	count := 0
+	for t := sched.Next(earliest); !t.IsZero() && !t.After(now); t = sched.Next(t) {
+		missed = t
+		count++
+		if count > maxMissedSchedules {
+			// don't walk every missed schedule, skip ahead to the most recent one
+			return mostRecentSchedule(sched, missed, now), sched.Next(now), count
+		}
+	}
+
+	return missed, sched.Next(now), count
+}
+
+// mostRecentSchedule returns the latest scheduled time at or before now, given from is a
+// scheduled time at or before now. Rather than walking every schedule since from, it looks
+// back from now over windows of growing size until one holds a scheduled time.
+func mostRecentSchedule(sched cron.Schedule, from, now time.Time) time.Time {
+	for window := time.Minute; ; window *= 2 {
+		start := now.Add(-window)
+		if !start.After(from) {
+			start = from
+		}
+
+		latest := time.Time{}
+		for t := sched.Next(start); !t.IsZero() && !t.After(now); t = sched.Next(t) {
+			latest = t
+		}
+		if !latest.IsZero() {
+			return latest
+		}
+		if start.Equal(from) {
+			return from
+		}
+	}
+}
+
+// setScheduledCondition records whether runs are being created on schedule.
+func setScheduledCondition(s *corev1alpha1.ScheduledPipelineRun, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&s.Status.Conditions, metav1.Condition{
+		Type:               corev1alpha1.ScheduledPipelineRunConditionScheduled,
+		Status:             status,
+		ObservedGeneration: s.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// scheduledTime returns the time a run was scheduled for, nil if the run wasn't created on schedule.
+func scheduledTime(run *corev1alpha1.PipelineRun) *metav1.Time {
+	value, ok := run.Annotations[kai.ScheduledTimeAnnotationKey]
+	if !ok {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	out := metav1.NewTime(t)
+	return &out
+}
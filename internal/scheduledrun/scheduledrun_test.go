@@ -0,0 +1,259 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduledrun
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/scheduledrun/names"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNextSchedules(t *testing.T) {
+	created := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+	deadline := int64(600)
+
+	tests := []struct {
+		name       string
+		last       *time.Time
+		deadline   *int64
+		now        time.Time
+		wantMissed time.Time
+		wantNext   time.Time
+		wantCount  int
+	}{{
+		name:     "nothing due",
+		now:      created.Add(30 * time.Minute),
+		wantNext: created.Add(time.Hour),
+	}, {
+		name:       "due since creation",
+		now:        created.Add(time.Hour + time.Minute),
+		wantMissed: created.Add(time.Hour),
+		wantNext:   created.Add(2 * time.Hour),
+		wantCount:  1,
+	}, {
+		name:       "latest of several missed",
+		last:       &created,
+		now:        created.Add(3*time.Hour + time.Minute),
+		wantMissed: created.Add(3 * time.Hour),
+		wantNext:   created.Add(4 * time.Hour),
+		wantCount:  3,
+	}, {
+		name:     "already scheduled",
+		last:     ptr(created.Add(time.Hour)),
+		now:      created.Add(time.Hour + time.Minute),
+		wantNext: created.Add(2 * time.Hour),
+	}, {
+		name:       "too many missed",
+		now:        created.Add(200*time.Hour + time.Minute),
+		wantMissed: created.Add(200 * time.Hour),
+		wantNext:   created.Add(201 * time.Hour),
+		wantCount:  maxMissedSchedules + 1,
+	}, {
+		name:       "too many missed over years",
+		now:        created.AddDate(3, 0, 0).Add(30 * time.Minute),
+		wantMissed: created.AddDate(3, 0, 0),
+		wantNext:   created.AddDate(3, 0, 0).Add(time.Hour),
+		wantCount:  maxMissedSchedules + 1,
+	}, {
+		name:       "deadline bounds missed",
+		deadline:   &deadline,
+		now:        created.Add(200*time.Hour + time.Minute),
+		wantMissed: created.Add(200 * time.Hour),
+		wantNext:   created.Add(201 * time.Hour),
+		wantCount:  1,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &corev1alpha1.ScheduledPipelineRun{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+				Spec: corev1alpha1.ScheduledPipelineRunSpec{
+					Schedule:                "0 * * * *",
+					StartingDeadlineSeconds: tt.deadline,
+				},
+			}
+			if tt.last != nil {
+				last := metav1.NewTime(*tt.last)
+				s.Status.LastScheduleTime = &last
+			}
+
+			sched, err := parseSchedule(s)
+			if err != nil {
+				t.Fatalf("parseSchedule() error = %v", err)
+			}
+
+			missed, next, count := nextSchedules(s, sched, tt.now)
+			if !missed.Equal(tt.wantMissed) {
+				t.Errorf("nextSchedules() missed = %v, want %v", missed, tt.wantMissed)
+			}
+			if !next.Equal(tt.wantNext) {
+				t.Errorf("nextSchedules() next = %v, want %v", next, tt.wantNext)
+			}
+			if count != tt.wantCount {
+				t.Errorf("nextSchedules() count = %d, want %d", count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestParseScheduleTimeZone(t *testing.T) {
+	tz := "America/New_York"
+	s := &corev1alpha1.ScheduledPipelineRun{
+		Spec: corev1alpha1.ScheduledPipelineRunSpec{Schedule: "0 9 * * *", TimeZone: &tz},
+	}
+
+	sched, err := parseSchedule(s)
+	if err != nil {
+		t.Fatalf("parseSchedule() error = %v", err)
+	}
+
+	got := sched.Next(time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC))
+	want := time.Date(2023, 6, 1, 13, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("Next() = %v, want %v", got.UTC(), want)
+	}
+
+	s.Spec.Schedule = "not a schedule"
+	if _, err := parseSchedule(s); err == nil {
+		t.Error("parseSchedule() expected error for invalid schedule")
+	}
+}
+
+func TestMostRecentSchedule(t *testing.T) {
+	s := &corev1alpha1.ScheduledPipelineRun{
+		// mondays at 09:00, once every minute during the hour
+		Spec: corev1alpha1.ScheduledPipelineRunSpec{Schedule: "* 9 * * 1"},
+	}
+	sched, err := parseSchedule(s)
+	if err != nil {
+		t.Fatalf("parseSchedule() error = %v", err)
+	}
+
+	from := time.Date(2023, 6, 5, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{{
+		name: "from is the latest",
+		now:  from.Add(30 * time.Second),
+		want: from,
+	}, {
+		name: "within the hour",
+		now:  from.Add(42*time.Minute + 30*time.Second),
+		want: from.Add(42 * time.Minute),
+	}, {
+		name: "weeks later",
+		now:  time.Date(2024, 2, 14, 12, 0, 0, 0, time.UTC),
+		want: time.Date(2024, 2, 12, 9, 59, 0, 0, time.UTC),
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mostRecentSchedule(sched, from, tt.now); !got.Equal(tt.want) {
+				t.Errorf("mostRecentSchedule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileSkipsTooManyMissedSchedules(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)
+	s := &corev1alpha1.ScheduledPipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "nightly",
+			Namespace:         "default",
+			UID:               "nightly-uid",
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: corev1alpha1.ScheduledPipelineRunSpec{
+			Schedule: "0 * * * *",
+			RunTemplate: corev1alpha1.PipelineRunTemplateSpec{
+				Spec: corev1alpha1.PipelineRunSpec{PipelineRef: corev1.LocalObjectReference{Name: "ensemble"}},
+			},
+		},
+	}
+	kc := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(s).
+		WithStatusSubresource(s).
+		Build()
+
+	now := created.Add(200*time.Hour + time.Minute)
+	c := New(kc)
+	c.now = func() time.Time { return now }
+
+	req := ctrl.Request{NamespacedName: s.NamespacedName()}
+	result, err := c.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter != 59*time.Minute {
+		t.Errorf("expected requeue at the next schedule, got %v", result.RequeueAfter)
+	}
+
+	// the most recent schedule is run
+	missed := created.Add(200 * time.Hour)
+	run := &corev1alpha1.PipelineRun{}
+	if err := kc.Get(ctx, names.RunName(s, missed), run); err != nil {
+		t.Fatalf("expected run scheduled at %v to be created: %v", missed, err)
+	}
+
+	got := &corev1alpha1.ScheduledPipelineRun{}
+	if err := kc.Get(ctx, req.NamespacedName, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.LastScheduleTime == nil || !got.Status.LastScheduleTime.Time.Equal(missed) {
+		t.Errorf("expected last schedule time %v, got %v", missed, got.Status.LastScheduleTime)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, corev1alpha1.ScheduledPipelineRunConditionScheduled)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != reasonTooManyMissedSchedules {
+		t.Fatalf("expected skipped schedules to be reported, got %+v", cond)
+	}
+
+	// the next run on schedule clears the warning
+	now = now.Add(time.Hour)
+	if _, err := c.Reconcile(ctx, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := kc.Get(ctx, req.NamespacedName, got); err != nil {
+		t.Fatal(err)
+	}
+	cond = meta.FindStatusCondition(got.Status.Conditions, corev1alpha1.ScheduledPipelineRunConditionScheduled)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != reasonOnSchedule {
+		t.Errorf("expected runs to be on schedule, got %+v", cond)
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package defaults holds the defaults of a Step. They are written into steps on admission and
+// applied again by the reconcilers so steps admitted without the webhook behave the same.
+package defaults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/step/modelruntime"
+	autoscaling "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// MinReplicas is the number of replicas a step is scaled down to when unset. Scaling to
+	// zero isn't supported yet so it is also the lowest number of replicas of a step.
+	MinReplicas int32 = 1
+
+	// CPUUtilization is the average CPU utilization targeted by the autoscaler of a step
+	// without metrics.
+	CPUUtilization int32 = 80
+
+	// ProgressDeadlineSeconds is the time a rollout of a step may take to make progress.
+	ProgressDeadlineSeconds int32 = 60
+)
+
+var (
+	// MaxUnavailable keeps steps serving at full capacity while rolling out.
+	MaxUnavailable = intstr.FromInt(0)
+
+	// MaxSurge matches the default of deployments.
+	MaxSurge = intstr.FromString("25%")
+)
+
+// SetDefaults fills in the unset replicas, metrics and rollout settings of the spec. An unset
+// maxReplicas is left to the autoscaler of the step, which doesn't scale it beyond minReplicas.
+func SetDefaults(spec *corev1alpha1.StepSpec) {
+	// TODO: support scale to zero with hpa alpha feature gate
+	if spec.MinReplicas == nil || *spec.MinReplicas < MinReplicas {
+		min := MinReplicas
+		spec.MinReplicas = &min
+	}
+
+	if len(spec.Metrics) == 0 {
+		utilization := CPUUtilization
+		spec.Metrics = []autoscaling.MetricSpec{{
+			Type: autoscaling.ResourceMetricSourceType,
+			Resource: &autoscaling.ResourceMetricSource{
+				Name: corev1.ResourceCPU,
+				Target: autoscaling.MetricTarget{
+					Type:               autoscaling.UtilizationMetricType,
+					AverageUtilization: &utilization,
+				},
+			},
+		}}
+	}
+
+	setRolloutDefaults(spec)
+}
+
+// setRolloutDefaults fills in the unset rollout settings of the spec.
+func setRolloutDefaults(spec *corev1alpha1.StepSpec) {
+	if spec.Rollout == nil {
+		spec.Rollout = &corev1alpha1.StepRollout{}
+	}
+	if spec.Rollout.ProgressDeadlineSeconds == nil {
+		deadline := ProgressDeadlineSeconds
+		spec.Rollout.ProgressDeadlineSeconds = &deadline
+	}
+	if spec.Rollout.MaxUnavailable == nil {
+		maxUnavailable := MaxUnavailable
+		spec.Rollout.MaxUnavailable = &maxUnavailable
+	}
+	if spec.Rollout.MaxSurge == nil {
+		maxSurge := MaxSurge
+		spec.Rollout.MaxSurge = &maxSurge
+	}
+}
+
+// Defaulter writes the defaults of steps into them on admission.
+type Defaulter struct {
+	client kclient.Client
+}
+
+var _ admission.CustomDefaulter = &Defaulter{}
+
+func New(client kclient.Client) *Defaulter {
+	return &Defaulter{
+		client: client,
+	}
+}
+
+// Default implements admission.CustomDefaulter
+func (d *Defaulter) Default(ctx context.Context, obj runtime.Object) error {
+	s, ok := obj.(*corev1alpha1.Step)
+	if !ok {
+		return fmt.Errorf("expected a Step but got %T", obj)
+	}
+	return d.Apply(ctx, s)
+}
+
+// Apply fills in the defaults of the step. Steps serving a model are bound to the model runtime
+// resolved for them and inherit the replicas and metrics of the runtime they leave unset. A
+// runtime named by the step is kept even if it doesn't exist yet. While no runtime supports the
+// model only the rollout settings are defaulted, the rest is left to the reconciler so a
+// runtime created later still applies.
+func (d *Defaulter) Apply(ctx context.Context, s *corev1alpha1.Step) error {
+	if s.Spec.Model != nil {
+		rt, err := modelruntime.Resolve(ctx, d.client, s)
+		if errors.Is(err, modelruntime.ErrNotFound) {
+			setRolloutDefaults(&s.Spec)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if s.Spec.Model.ModelRuntime == "" {
+			s.Spec.Model.ModelRuntime = rt.Name
+		}
+		ApplyModelRuntime(&s.Spec, &rt.Spec)
+	}
+
+	SetDefaults(&s.Spec)
+	return nil
+}
+
+// ApplyModelRuntime fills in the autoscaling settings the step leaves unset from its model runtime.
+func ApplyModelRuntime(spec *corev1alpha1.StepSpec, rt *corev1alpha1.ModelRuntimeSpec) {
+	// both values could be empty but always default to modelRuntime value
+	if spec.MinReplicas == nil || (*spec.MinReplicas) < 1 {
+		spec.MinReplicas = rt.MinReplicas
+	}
+
+	if spec.MaxReplicas == 0 {
+		spec.MaxReplicas = rt.MaxReplicas
+	}
+
+	if len(spec.Metrics) == 0 {
+		spec.Metrics = rt.Metrics
+	}
+
+	if spec.Behavior == nil {
+		spec.Behavior = rt.Behavior
+	}
+}
+
+// MergeEnv returns the default variables the container doesn't set itself followed by the
+// variables of the container, so the container can reference the defaults in its own values.
+func MergeEnv(env, defaults []corev1.EnvVar) []corev1.EnvVar {
+	if len(defaults) == 0 {
+		return env
+	}
+
+	set := map[string]bool{}
+	for _, e := range env {
+		set[e.Name] = true
+	}
+
+	out := make([]corev1.EnvVar, 0, len(env)+len(defaults))
+	for _, e := range defaults {
+		if !set[e.Name] {
+			out = append(out, e)
+		}
+	}
+	return append(out, env...)
+}
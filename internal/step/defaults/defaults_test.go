@@ -0,0 +1,192 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package defaults
+
+import (
+	"context"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	autoscaling "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func int32Ptr(v int32) *int32 {
+	return &v
+}
+
+func TestSetDefaults(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		spec := &corev1alpha1.StepSpec{}
+		SetDefaults(spec)
+
+		// maxReplicas is left to the autoscaler so it never overrides a rejected maxReplicas
+		if *spec.MinReplicas != MinReplicas || spec.MaxReplicas != 0 {
+			t.Errorf("expected replicas %d with maxReplicas unset, got %d-%d", MinReplicas, *spec.MinReplicas, spec.MaxReplicas)
+		}
+		if len(spec.Metrics) != 1 || *spec.Metrics[0].Resource.Target.AverageUtilization != CPUUtilization {
+			t.Errorf("expected %d%% cpu utilization metric, got %v", CPUUtilization, spec.Metrics)
+		}
+		want := &corev1alpha1.StepRollout{
+			ProgressDeadlineSeconds: int32Ptr(ProgressDeadlineSeconds),
+			MaxUnavailable:          &MaxUnavailable,
+			MaxSurge:                &MaxSurge,
+		}
+		if !equality.Semantic.DeepEqual(spec.Rollout, want) {
+			t.Errorf("expected rollout %v, got %v", want, spec.Rollout)
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		maxSurge := intstr.FromInt(1)
+		metrics := []autoscaling.MetricSpec{{
+			Type: autoscaling.ResourceMetricSourceType,
+			Resource: &autoscaling.ResourceMetricSource{
+				Name:   corev1.ResourceMemory,
+				Target: autoscaling.MetricTarget{Type: autoscaling.UtilizationMetricType, AverageUtilization: int32Ptr(60)},
+			},
+		}}
+		spec := &corev1alpha1.StepSpec{
+			MinReplicas: int32Ptr(2),
+			MaxReplicas: 5,
+			Metrics:     metrics,
+			Rollout:     &corev1alpha1.StepRollout{MaxSurge: &maxSurge},
+		}
+		SetDefaults(spec)
+
+		if *spec.MinReplicas != 2 || spec.MaxReplicas != 5 {
+			t.Errorf("expected replicas 2-5, got %d-%d", *spec.MinReplicas, spec.MaxReplicas)
+		}
+		if !equality.Semantic.DeepEqual(spec.Metrics, metrics) {
+			t.Errorf("expected metrics to be kept, got %v", spec.Metrics)
+		}
+		if spec.Rollout.MaxSurge.IntValue() != 1 || *spec.Rollout.ProgressDeadlineSeconds != ProgressDeadlineSeconds {
+			t.Errorf("expected rollout to be completed, got %v", spec.Rollout)
+		}
+	})
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := &corev1alpha1.ModelRuntime{
+		ObjectMeta: metav1.ObjectMeta{Name: "torchserve", Namespace: "default"},
+		Spec: corev1alpha1.ModelRuntimeSpec{
+			SupportedModelFormats: []corev1alpha1.ModelFormat{corev1alpha1.PytorchModelFormat},
+			Containers:            []corev1.Container{{Name: corev1alpha1.InferenceContainerName, Image: "torchserve"}},
+			MinReplicas:           int32Ptr(2),
+			MaxReplicas:           4,
+		},
+	}
+	kc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(rt).Build()
+	d := New(kc)
+
+	t.Run("model runtime", func(t *testing.T) {
+		s := &corev1alpha1.Step{
+			ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "default"},
+			Spec: corev1alpha1.StepSpec{
+				Model: &corev1alpha1.ModelSpec{ModelFormat: corev1alpha1.PytorchModelFormat, URI: "gs://models/resnet"},
+			},
+		}
+		if err := d.Default(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+
+		if s.Spec.Model.ModelRuntime != rt.Name {
+			t.Errorf("expected model runtime %q, got %q", rt.Name, s.Spec.Model.ModelRuntime)
+		}
+		if *s.Spec.MinReplicas != 2 || s.Spec.MaxReplicas != 4 {
+			t.Errorf("expected replicas of the runtime 2-4, got %d-%d", *s.Spec.MinReplicas, s.Spec.MaxReplicas)
+		}
+		if len(s.Spec.Metrics) != 1 || *s.Spec.Metrics[0].Resource.Target.AverageUtilization != CPUUtilization {
+			t.Errorf("expected %d%% cpu utilization metric, got %v", CPUUtilization, s.Spec.Metrics)
+		}
+		if s.Spec.Rollout == nil || *s.Spec.Rollout.ProgressDeadlineSeconds != ProgressDeadlineSeconds {
+			t.Errorf("expected rollout defaults to be applied, got %+v", s.Spec.Rollout)
+		}
+	})
+
+	t.Run("missing named model runtime", func(t *testing.T) {
+		s := &corev1alpha1.Step{
+			ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "default"},
+			Spec: corev1alpha1.StepSpec{
+				Model: &corev1alpha1.ModelSpec{ModelFormat: corev1alpha1.PytorchModelFormat, ModelRuntime: "custom", URI: "gs://models/resnet"},
+			},
+		}
+		if err := d.Default(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+
+		// the runtime named by the step is kept even while another runtime serves the model
+		if s.Spec.Model.ModelRuntime != "custom" {
+			t.Errorf("expected model runtime %q to be kept, got %q", "custom", s.Spec.Model.ModelRuntime)
+		}
+	})
+
+	t.Run("no model runtime", func(t *testing.T) {
+		s := &corev1alpha1.Step{
+			ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "default"},
+			Spec: corev1alpha1.StepSpec{
+				Model: &corev1alpha1.ModelSpec{ModelFormat: corev1alpha1.OnnxModelFormat, URI: "gs://models/resnet"},
+			},
+		}
+		if err := d.Default(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+
+		// the autoscaling settings are left to the reconciler so a runtime created later applies
+		if s.Spec.Model.ModelRuntime != "" {
+			t.Errorf("expected model runtime to be left unset, got %q", s.Spec.Model.ModelRuntime)
+		}
+		if s.Spec.MinReplicas != nil || s.Spec.MaxReplicas != 0 || s.Spec.Metrics != nil {
+			t.Errorf("expected autoscaling settings to be left to the reconciler, got %+v", s.Spec)
+		}
+		if s.Spec.Rollout == nil || *s.Spec.Rollout.ProgressDeadlineSeconds != ProgressDeadlineSeconds {
+			t.Errorf("expected rollout defaults to be applied, got %+v", s.Spec.Rollout)
+		}
+	})
+
+	t.Run("containers", func(t *testing.T) {
+		s := &corev1alpha1.Step{
+			ObjectMeta: metav1.ObjectMeta{Name: "echo", Namespace: "default"},
+			Spec: corev1alpha1.StepSpec{
+				PodSpec:     corev1alpha1.PodSpec{Containers: []corev1.Container{{Name: "echo", Image: "echo"}}},
+				MinReplicas: int32Ptr(3),
+			},
+		}
+		if err := d.Default(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+
+		if *s.Spec.MinReplicas != 3 || s.Spec.MaxReplicas != 0 {
+			t.Errorf("expected replicas to be kept, got %d-%d", *s.Spec.MinReplicas, s.Spec.MaxReplicas)
+		}
+		if s.Spec.Rollout == nil || len(s.Spec.Metrics) == 0 {
+			t.Errorf("expected defaults to be applied, got %+v", s.Spec)
+		}
+	})
+}
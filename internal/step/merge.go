@@ -0,0 +1,97 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package step
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// mergeContainers merges the containers of a step onto the containers of its model runtime.
+// A step container is merged onto the runtime container of the same name with strategic merge
+// semantics, so env is merged by name and resources by resource name, while its args are
+// combined according to the policy. Step containers not named after a runtime container run
+// alongside the runtime containers.
+func mergeContainers(runtime, step []corev1.Container, policy corev1alpha1.ArgsPolicy) ([]corev1.Container, error) {
+	overrides := make(map[string]*corev1.Container, len(step))
+	for i := range step {
+		overrides[step[i].Name] = &step[i]
+	}
+
+	out := make([]corev1.Container, 0, len(runtime)+len(step))
+	for _, c := range runtime {
+		override, ok := overrides[c.Name]
+		if !ok {
+			out = append(out, *c.DeepCopy())
+			continue
+		}
+		delete(overrides, c.Name)
+
+		merged, err := mergeContainer(&c, override, policy)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *merged)
+	}
+
+	// keep the order the step declared its own containers in
+	for _, c := range step {
+		if _, ok := overrides[c.Name]; ok {
+			out = append(out, *c.DeepCopy())
+		}
+	}
+
+	return out, nil
+}
+
+func mergeContainer(base, override *corev1.Container, policy corev1alpha1.ArgsPolicy) (*corev1.Container, error) {
+	// args have no merge key and would be replaced by the patch, combine them separately
+	patch := override.DeepCopy()
+	patch.Args = nil
+
+	original, err := json.Marshal(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal container %q: %w", base.Name, err)
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal container %q of step: %w", override.Name, err)
+	}
+	data, err = strategicpatch.StrategicMergePatch(original, data, corev1.Container{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge container %q onto model runtime: %w", override.Name, err)
+	}
+
+	merged := &corev1.Container{}
+	if err := json.Unmarshal(data, merged); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal container %q: %w", override.Name, err)
+	}
+
+	switch {
+	case len(override.Args) == 0:
+	case policy == corev1alpha1.ArgsPolicyReplace:
+		merged.Args = append([]string{}, override.Args...)
+	default:
+		merged.Args = append(merged.Args, override.Args...)
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package step
+
+import (
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func runtimeContainers() []corev1.Container {
+	return []corev1.Container{
+		{
+			Name:  corev1alpha1.InferenceContainerName,
+			Image: "pytorch/torchserve-kfs:0.8.2",
+			Args:  []string{"torchserve", "--start"},
+			Env: []corev1.EnvVar{
+				{Name: "TS_WORKERS", Value: "1"},
+				{Name: "TS_LOG_LEVEL", Value: "info"},
+			},
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("1"),
+					corev1.ResourceMemory: resource.MustParse("2Gi"),
+				},
+			},
+			Ports: []corev1.ContainerPort{{ContainerPort: 8085}},
+		},
+		{Name: "agent", Image: "agent"},
+	}
+}
+
+func TestMergeContainers(t *testing.T) {
+	override := corev1.Container{
+		Name: corev1alpha1.InferenceContainerName,
+		Args: []string{"--ncs"},
+		Env:  []corev1.EnvVar{{Name: "TS_WORKERS", Value: "4"}, {Name: "TS_METRICS", Value: "prometheus"}},
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("16Gi")},
+		},
+	}
+	sidecar := corev1.Container{Name: "logger", Image: "logger"}
+
+	tests := []struct {
+		name     string
+		step     []corev1.Container
+		policy   corev1alpha1.ArgsPolicy
+		wantArgs []string
+	}{
+		{
+			name:     "append args",
+			step:     []corev1.Container{override, sidecar},
+			wantArgs: []string{"torchserve", "--start", "--ncs"},
+		},
+		{
+			name:     "replace args",
+			step:     []corev1.Container{override, sidecar},
+			policy:   corev1alpha1.ArgsPolicyReplace,
+			wantArgs: []string{"--ncs"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeContainers(runtimeContainers(), tt.step, tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 3 || got[1].Name != "agent" || got[2].Name != "logger" {
+				t.Fatalf("expected runtime containers followed by the sidecar, got %v", got)
+			}
+
+			c := got[0]
+			if c.Image != "pytorch/torchserve-kfs:0.8.2" || len(c.Ports) != 1 {
+				t.Errorf("expected fields not set by the step to be kept, got %v", c)
+			}
+			if !equality.Semantic.DeepEqual(c.Args, tt.wantArgs) {
+				t.Errorf("expected args %v, got %v", tt.wantArgs, c.Args)
+			}
+			wantEnv := []corev1.EnvVar{
+				{Name: "TS_WORKERS", Value: "4"},
+				{Name: "TS_METRICS", Value: "prometheus"},
+				{Name: "TS_LOG_LEVEL", Value: "info"},
+			}
+			if !envEqual(c.Env, wantEnv) {
+				t.Errorf("expected env %v, got %v", wantEnv, c.Env)
+			}
+			wantLimits := corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("1"),
+				corev1.ResourceMemory: resource.MustParse("16Gi"),
+			}
+			if !equality.Semantic.DeepEqual(c.Resources.Limits, wantLimits) {
+				t.Errorf("expected limits %v, got %v", wantLimits, c.Resources.Limits)
+			}
+		})
+	}
+}
+
+func TestMergeContainersWithoutOverrides(t *testing.T) {
+	got, err := mergeContainers(runtimeContainers(), nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equality.Semantic.DeepEqual(got, runtimeContainers()) {
+		t.Errorf("expected runtime containers, got %v", got)
+	}
+}
+
+func TestMergeRuntimeSpecAppliesEnv(t *testing.T) {
+	s := &corev1alpha1.Step{
+		Spec: corev1alpha1.StepSpec{
+			Model: &corev1alpha1.ModelSpec{URI: "gs://models/resnet"},
+			Env: []corev1.EnvVar{
+				{Name: "LOG_LEVEL", Value: "info"},
+				{Name: "TS_WORKERS", Value: "4"},
+			},
+		},
+	}
+
+	if err := mergeRuntimeSpec(s, &corev1alpha1.ModelRuntimeSpec{Containers: runtimeContainers()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the env of the step reaches the containers of the runtime, which keep their own values
+	want := map[string][]corev1.EnvVar{
+		corev1alpha1.InferenceContainerName: {
+			{Name: "LOG_LEVEL", Value: "info"},
+			{Name: "TS_WORKERS", Value: "1"},
+			{Name: "TS_LOG_LEVEL", Value: "info"},
+		},
+		"agent": {
+			{Name: "LOG_LEVEL", Value: "info"},
+			{Name: "TS_WORKERS", Value: "4"},
+		},
+	}
+	if len(s.Spec.Containers) != len(want) {
+		t.Fatalf("expected %d containers, got %d", len(want), len(s.Spec.Containers))
+	}
+	for _, c := range s.Spec.Containers {
+		if !envEqual(c.Env, want[c.Name]) {
+			t.Errorf("container %q env = %v, want %v", c.Name, c.Env, want[c.Name])
+		}
+	}
+}
+
+// envEqual compares env ignoring order, strategic merge doesn't keep the order of merged lists
+func envEqual(a, b []corev1.EnvVar) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	values := make(map[string]string, len(a))
+	for _, e := range a {
+		values[e.Name] = e.Value
+	}
+	for _, e := range b {
+		if v, ok := values[e.Name]; !ok || v != e.Value {
+			return false
+		}
+	}
+	return true
+}
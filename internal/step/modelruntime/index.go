@@ -0,0 +1,54 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modelruntime
+
+import (
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// StepIndex indexes steps by the model runtime reported in their status. Steps serving a model
+// without a runtime are indexed as Unbound so they pick up runtimes created later.
+const StepIndex = ".status.modelRuntime"
+
+// Unbound is the StepIndex value of steps serving a model without a runtime.
+const Unbound = "unbound"
+
+// ClusterBound is an additional StepIndex value of steps bound to a ClusterModelRuntime. Model
+// runtimes in the namespace of a step take precedence over cluster model runtimes, so these steps
+// are resolved again when one is created in their namespace.
+const ClusterBound = "clusterbound"
+
+// IndexKey returns the StepIndex value of the steps bound to the runtime.
+func IndexKey(kind, name string) string {
+	return kind + "/" + name
+}
+
+// IndexStep returns the StepIndex values of a step.
+func IndexStep(obj kclient.Object) []string {
+	s := obj.(*corev1alpha1.Step)
+	if s.Spec.Model == nil {
+		return nil
+	}
+	if rt := s.Status.ModelRuntime; rt != nil {
+		if rt.Kind == KindClusterModelRuntime {
+			return []string{IndexKey(rt.Kind, rt.Name), ClusterBound}
+		}
+		return []string{IndexKey(rt.Kind, rt.Name)}
+	}
+	return []string{Unbound}
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package modelruntime resolves the model runtime serving the model of a step.
+package modelruntime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// kinds of model runtimes
+const (
+	KindModelRuntime        = "ModelRuntime"
+	KindClusterModelRuntime = "ClusterModelRuntime"
+)
+
+// ErrNotFound is returned when no model runtime supports the model of a step.
+var ErrNotFound = errors.New("no supporting modelruntime found")
+
+// Runtime is a ModelRuntime or ClusterModelRuntime resolved for a step.
+type Runtime struct {
+	// Kind is either ModelRuntime or ClusterModelRuntime.
+	Kind string
+
+	// Name of the runtime.
+	Name string
+
+	Spec corev1alpha1.ModelRuntimeSpec
+
+	// Reason and Message explain why the runtime was selected, they are reported in the status
+	// of the step.
+	Reason  string
+	Message string
+}
+
+// Selection returns the status reporting the runtime selected for a step.
+func (rt *Runtime) Selection() *corev1alpha1.ModelRuntimeSelection {
+	return &corev1alpha1.ModelRuntimeSelection{
+		Kind:    rt.Kind,
+		Name:    rt.Name,
+		Reason:  rt.Reason,
+		Message: rt.Message,
+	}
+}
+
+// Resolve returns the model runtime serving the model of the step. Runtimes are looked up in
+// the namespace of the step first and then among the cluster model runtimes, runtimes in other
+// namespaces never serve the step. Among the runtimes of a scope supporting the model format,
+// the one with the highest priority is selected and ties are broken by name. Runtimes being
+// deleted are never selected for a step, steps naming them or already bound to them keep using
+// them until another runtime supports the model.
+func Resolve(ctx context.Context, client kclient.Client, s *corev1alpha1.Step) (*Runtime, error) {
+	model := s.Spec.Model
+
+	// if modelRuntime is specified in spec use that ilo modelformat
+	if model.ModelRuntime != "" {
+		rt, err := get(ctx, client, s.Namespace, model.ModelRuntime)
+		if err != nil || rt != nil {
+			return rt, err
+		}
+	}
+
+	// modelRuntime not specified so match based on modelFormat
+	runtimes := &corev1alpha1.ModelRuntimeList{}
+	if err := client.List(ctx, runtimes, kclient.InNamespace(s.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list modelruntimes %w", err)
+	}
+	candidates := make([]candidate, 0, len(runtimes.Items))
+	for _, rt := range runtimes.Items {
+		if rt.DeletionTimestamp != nil {
+			continue
+		}
+		candidates = append(candidates, candidate{name: rt.Name, spec: rt.Spec})
+	}
+	if rt := pick(KindModelRuntime, candidates, model); rt != nil {
+		return rt, nil
+	}
+
+	clusterRuntimes := &corev1alpha1.ClusterModelRuntimeList{}
+	if err := client.List(ctx, clusterRuntimes); err != nil {
+		return nil, fmt.Errorf("failed to list clustermodelruntimes %w", err)
+	}
+	candidates = candidates[:0]
+	for _, rt := range clusterRuntimes.Items {
+		if rt.DeletionTimestamp != nil {
+			continue
+		}
+		candidates = append(candidates, candidate{name: rt.Name, spec: rt.Spec})
+	}
+	if rt := pick(KindClusterModelRuntime, candidates, model); rt != nil {
+		return rt, nil
+	}
+
+	rt, err := bound(ctx, client, s)
+	if err != nil || rt != nil {
+		return rt, err
+	}
+
+	return nil, ErrNotFound
+}
+
+// bound returns the runtime the step is bound to if it is being deleted and still supports the
+// model. The runtime is held by its finalizer until the step moves to another runtime, so the
+// step keeps serving in the meantime. It returns nil otherwise.
+func bound(ctx context.Context, client kclient.Client, s *corev1alpha1.Step) (*Runtime, error) {
+	selection := s.Status.ModelRuntime
+	if selection == nil {
+		return nil, nil
+	}
+
+	var obj kclient.Object
+	var spec *corev1alpha1.ModelRuntimeSpec
+	switch selection.Kind {
+	case KindModelRuntime:
+		rt := &corev1alpha1.ModelRuntime{}
+		obj, spec = rt, &rt.Spec
+	case KindClusterModelRuntime:
+		rt := &corev1alpha1.ClusterModelRuntime{}
+		obj, spec = rt, &rt.Spec
+	default:
+		return nil, nil
+	}
+
+	key := types.NamespacedName{Name: selection.Name}
+	if selection.Kind == KindModelRuntime {
+		key.Namespace = s.Namespace
+	}
+	if err := client.Get(ctx, key, obj); err != nil {
+		if apierrs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get %s %q: %w", strings.ToLower(selection.Kind), selection.Name, err)
+	}
+	// runtimes which aren't being deleted were already considered
+	if obj.GetDeletionTimestamp() == nil {
+		return nil, nil
+	}
+	if _, ok := supports(*spec, s.Spec.Model); !ok {
+		return nil, nil
+	}
+
+	return &Runtime{
+		Kind:    selection.Kind,
+		Name:    selection.Name,
+		Spec:    *spec,
+		Reason:  selection.Reason,
+		Message: selection.Message,
+	}, nil
+}
+
+// get returns the runtime with the given name, preferring the one in the namespace. It returns
+// nil if neither exists.
+func get(ctx context.Context, client kclient.Client, namespace, name string) (*Runtime, error) {
+	rt := &corev1alpha1.ModelRuntime{}
+	err := client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, rt)
+	if err == nil {
+		return requested(KindModelRuntime, rt.Name, rt.Spec), nil
+	}
+	if !apierrs.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get modelruntime %q: %w", name, err)
+	}
+
+	crt := &corev1alpha1.ClusterModelRuntime{}
+	err = client.Get(ctx, types.NamespacedName{Name: name}, crt)
+	if err == nil {
+		return requested(KindClusterModelRuntime, crt.Name, crt.Spec), nil
+	}
+	if !apierrs.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get clustermodelruntime %q: %w", name, err)
+	}
+
+	return nil, nil
+}
+
+func requested(kind, name string, spec corev1alpha1.ModelRuntimeSpec) *Runtime {
+	return &Runtime{
+		Kind:    kind,
+		Name:    name,
+		Spec:    spec,
+		Reason:  corev1alpha1.ModelRuntimeReasonRequested,
+		Message: fmt.Sprintf("%s %q is named by the step", kind, name),
+	}
+}
+
+type candidate struct {
+	name     string
+	spec     corev1alpha1.ModelRuntimeSpec
+	priority int32
+}
+
+// pick returns the runtime with the highest priority supporting the model, runtimes of equal
+// priority are ordered by name so the selection doesn't depend on the order of the list.
+func pick(kind string, candidates []candidate, model *corev1alpha1.ModelSpec) *Runtime {
+	var best *candidate
+	for i := range candidates {
+		c := &candidates[i]
+		priority, ok := supports(c.spec, model)
+		if !ok {
+			continue
+		}
+		c.priority = priority
+		if best == nil || c.priority > best.priority || (c.priority == best.priority && c.name < best.name) {
+			best = c
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	format := string(model.ModelFormat)
+	if model.ModelFormatVersion != "" {
+		format += " " + model.ModelFormatVersion
+	}
+	return &Runtime{
+		Kind:    kind,
+		Name:    best.name,
+		Spec:    best.spec,
+		Reason:  corev1alpha1.ModelRuntimeReasonAutoSelected,
+		Message: fmt.Sprintf("%s %q has the highest priority (%d) for %s", kind, best.name, best.priority, format),
+	}
+}
+
+// supports returns the highest priority of the formats of the runtime automatically selected
+// for the model.
+func supports(spec corev1alpha1.ModelRuntimeSpec, model *corev1alpha1.ModelSpec) (int32, bool) {
+	var priority int32
+	found := false
+	for _, f := range spec.GetModelFormats() {
+		if f.Name != model.ModelFormat || !versionMatches(f.Version, model.ModelFormatVersion) {
+			continue
+		}
+		if f.AutoSelect != nil && !*f.AutoSelect {
+			continue
+		}
+		var p int32
+		if f.Priority != nil {
+			p = *f.Priority
+		}
+		if !found || p > priority {
+			priority = p
+		}
+		found = true
+	}
+	return priority, found
+}
+
+// versionMatches reports whether a runtime supporting the version serves the requested version.
+// A version supports itself and the versions it is a prefix of e.g.; "2" supports "2.1".
+func versionMatches(supported *string, requested string) bool {
+	if requested == "" || supported == nil || *supported == "" {
+		return true
+	}
+	return requested == *supported || strings.HasPrefix(requested, *supported+".")
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package modelruntime
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func runtimeSpec(formats ...corev1alpha1.ModelFormat) corev1alpha1.ModelRuntimeSpec {
+	return corev1alpha1.ModelRuntimeSpec{SupportedModelFormats: formats}
+}
+
+func runtimeFormats(formats ...corev1alpha1.SupportedModelFormat) corev1alpha1.ModelRuntimeSpec {
+	return corev1alpha1.ModelRuntimeSpec{ModelFormats: formats}
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	low, high := int32(1), int32(5)
+	v1, v2 := "1", "2"
+	manual := false
+
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	objs := []kclient.Object{
+		&corev1alpha1.ModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-torchserve", Namespace: "team-a"},
+			Spec:       runtimeSpec(corev1alpha1.PytorchModelFormat),
+		},
+		&corev1alpha1.ModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "hijack", Namespace: "team-b"},
+			Spec:       runtimeSpec(corev1alpha1.PytorchModelFormat, "onnx"),
+		},
+		&corev1alpha1.ModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "b-torchserve", Namespace: "team-d"},
+			Spec:       runtimeSpec(corev1alpha1.PytorchModelFormat),
+		},
+		&corev1alpha1.ModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "a-torchserve", Namespace: "team-d"},
+			Spec:       runtimeFormats(corev1alpha1.SupportedModelFormat{Name: corev1alpha1.PytorchModelFormat}),
+		},
+		&corev1alpha1.ModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "onnx-server", Namespace: "team-d"},
+			Spec:       runtimeFormats(corev1alpha1.SupportedModelFormat{Name: "onnx", Priority: &low}),
+		},
+		&corev1alpha1.ModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "triton", Namespace: "team-d"},
+			Spec:       runtimeFormats(corev1alpha1.SupportedModelFormat{Name: "onnx", Priority: &high}),
+		},
+		&corev1alpha1.ModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "tf1", Namespace: "team-d"},
+			Spec:       runtimeFormats(corev1alpha1.SupportedModelFormat{Name: "tensorflow", Version: &v1, Priority: &high}),
+		},
+		&corev1alpha1.ModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "tf2", Namespace: "team-d"},
+			Spec:       runtimeFormats(corev1alpha1.SupportedModelFormat{Name: "tensorflow", Version: &v2}),
+		},
+		&corev1alpha1.ModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "mlserver", Namespace: "team-d"},
+			Spec:       runtimeFormats(corev1alpha1.SupportedModelFormat{Name: "sklearn", AutoSelect: &manual}),
+		},
+		&corev1alpha1.ClusterModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "torchserve"},
+			Spec:       runtimeSpec(corev1alpha1.PytorchModelFormat),
+		},
+	}
+	kc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+	tests := []struct {
+		name      string
+		namespace string
+		model     corev1alpha1.ModelSpec
+		wantKind  string
+		wantName  string
+		wantErr   error
+	}{
+		{
+			name:      "equal priorities are ordered by name",
+			namespace: "team-d",
+			model:     corev1alpha1.ModelSpec{ModelFormat: corev1alpha1.PytorchModelFormat},
+			wantKind:  KindModelRuntime,
+			wantName:  "a-torchserve",
+		},
+		{
+			name:      "highest priority",
+			namespace: "team-d",
+			model:     corev1alpha1.ModelSpec{ModelFormat: "onnx"},
+			wantKind:  KindModelRuntime,
+			wantName:  "triton",
+		},
+		{
+			name:      "format version",
+			namespace: "team-d",
+			model:     corev1alpha1.ModelSpec{ModelFormat: "tensorflow", ModelFormatVersion: "2.11"},
+			wantKind:  KindModelRuntime,
+			wantName:  "tf2",
+		},
+		{
+			name:      "no format version",
+			namespace: "team-d",
+			model:     corev1alpha1.ModelSpec{ModelFormat: "tensorflow"},
+			wantKind:  KindModelRuntime,
+			wantName:  "tf1",
+		},
+		{
+			name:      "unsupported format version",
+			namespace: "team-d",
+			model:     corev1alpha1.ModelSpec{ModelFormat: "tensorflow", ModelFormatVersion: "3"},
+			wantErr:   ErrNotFound,
+		},
+		{
+			name:      "runtimes not selected automatically",
+			namespace: "team-d",
+			model:     corev1alpha1.ModelSpec{ModelFormat: "sklearn"},
+			wantErr:   ErrNotFound,
+		},
+		{
+			name:      "named runtime not selected automatically",
+			namespace: "team-d",
+			model:     corev1alpha1.ModelSpec{ModelFormat: "sklearn", ModelRuntime: "mlserver"},
+			wantKind:  KindModelRuntime,
+			wantName:  "mlserver",
+		},
+		{
+			name:      "namespace runtime takes precedence",
+			namespace: "team-a",
+			model:     corev1alpha1.ModelSpec{ModelFormat: corev1alpha1.PytorchModelFormat},
+			wantKind:  KindModelRuntime,
+			wantName:  "team-torchserve",
+		},
+		{
+			name:      "cluster runtime",
+			namespace: "team-c",
+			model:     corev1alpha1.ModelSpec{ModelFormat: corev1alpha1.PytorchModelFormat},
+			wantKind:  KindClusterModelRuntime,
+			wantName:  "torchserve",
+		},
+		{
+			name:      "named cluster runtime",
+			namespace: "team-a",
+			model:     corev1alpha1.ModelSpec{ModelFormat: corev1alpha1.PytorchModelFormat, ModelRuntime: "torchserve"},
+			wantKind:  KindClusterModelRuntime,
+			wantName:  "torchserve",
+		},
+		{
+			name:      "runtimes of other namespaces are ignored",
+			namespace: "team-a",
+			model:     corev1alpha1.ModelSpec{ModelFormat: "onnx"},
+			wantErr:   ErrNotFound,
+		},
+		{
+			name:      "named runtime of another namespace is ignored",
+			namespace: "team-c",
+			model:     corev1alpha1.ModelSpec{ModelFormat: "onnx", ModelRuntime: "hijack"},
+			wantErr:   ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := tt.model
+			s := &corev1alpha1.Step{
+				ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: tt.namespace},
+				Spec:       corev1alpha1.StepSpec{Model: &model},
+			}
+
+			rt, err := Resolve(ctx, kc, s)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rt.Kind != tt.wantKind || rt.Name != tt.wantName {
+				t.Errorf("expected %s %q, got %s %q", tt.wantKind, tt.wantName, rt.Kind, rt.Name)
+			}
+
+			reason := corev1alpha1.ModelRuntimeReasonAutoSelected
+			if model.ModelRuntime != "" {
+				reason = corev1alpha1.ModelRuntimeReasonRequested
+			}
+			if sel := rt.Selection(); sel.Reason != reason || sel.Message == "" {
+				t.Errorf("expected reason %s with a message, got %v", reason, sel)
+			}
+		})
+	}
+}
+
+func TestResolveDeletedRuntimes(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	if err := corev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	now := metav1.Now()
+	meta := func(namespace, name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			DeletionTimestamp: &now,
+			Finalizers:        []string{"core.kai.io/modelruntime-protection"},
+		}
+	}
+	objs := []kclient.Object{
+		&corev1alpha1.ModelRuntime{
+			ObjectMeta: meta("team-a", "torchserve"),
+			Spec:       runtimeSpec(corev1alpha1.PytorchModelFormat),
+		},
+		&corev1alpha1.ModelRuntime{
+			ObjectMeta: meta("team-a", "mlserver"),
+			Spec:       runtimeSpec("sklearn"),
+		},
+		&corev1alpha1.ClusterModelRuntime{
+			ObjectMeta: meta("", "triton"),
+			Spec:       runtimeSpec("onnx"),
+		},
+		&corev1alpha1.ClusterModelRuntime{
+			ObjectMeta: metav1.ObjectMeta{Name: "mlserver"},
+			Spec:       runtimeSpec("sklearn"),
+		},
+	}
+	kc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+	tests := []struct {
+		name     string
+		format   corev1alpha1.ModelFormat
+		bound    *corev1alpha1.ModelRuntimeSelection
+		wantKind string
+		wantName string
+		wantErr  error
+	}{
+		{
+			name:    "deleted runtimes aren't selected",
+			format:  corev1alpha1.PytorchModelFormat,
+			wantErr: ErrNotFound,
+		},
+		{
+			name:     "bound runtime is kept while deleted",
+			format:   corev1alpha1.PytorchModelFormat,
+			bound:    &corev1alpha1.ModelRuntimeSelection{Kind: KindModelRuntime, Name: "torchserve", Reason: corev1alpha1.ModelRuntimeReasonAutoSelected, Message: "selected"},
+			wantKind: KindModelRuntime,
+			wantName: "torchserve",
+		},
+		{
+			name:     "bound cluster runtime is kept while deleted",
+			format:   "onnx",
+			bound:    &corev1alpha1.ModelRuntimeSelection{Kind: KindClusterModelRuntime, Name: "triton", Reason: corev1alpha1.ModelRuntimeReasonAutoSelected, Message: "selected"},
+			wantKind: KindClusterModelRuntime,
+			wantName: "triton",
+		},
+		{
+			name:     "bound runtime is left for another runtime",
+			format:   "sklearn",
+			bound:    &corev1alpha1.ModelRuntimeSelection{Kind: KindModelRuntime, Name: "mlserver", Reason: corev1alpha1.ModelRuntimeReasonAutoSelected, Message: "selected"},
+			wantKind: KindClusterModelRuntime,
+			wantName: "mlserver",
+		},
+		{
+			name:    "bound runtime no longer supporting the model",
+			format:  "onnx",
+			bound:   &corev1alpha1.ModelRuntimeSelection{Kind: KindModelRuntime, Name: "torchserve", Reason: corev1alpha1.ModelRuntimeReasonAutoSelected, Message: "selected"},
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &corev1alpha1.Step{
+				ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "team-a"},
+				Spec:       corev1alpha1.StepSpec{Model: &corev1alpha1.ModelSpec{ModelFormat: tt.format}},
+				Status:     corev1alpha1.StepStatus{ModelRuntime: tt.bound},
+			}
+
+			rt, err := Resolve(ctx, kc, s)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rt.Kind != tt.wantKind || rt.Name != tt.wantName {
+				t.Errorf("expected %s %q, got %s %q", tt.wantKind, tt.wantName, rt.Kind, rt.Name)
+			}
+		})
+	}
+}
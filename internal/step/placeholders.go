@@ -0,0 +1,76 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package step
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// resolvePlaceholders replaces the placeholders in the command, args and env values of the
+// containers with their values for the step.
+func resolvePlaceholders(s *corev1alpha1.Step, containers []corev1.Container) error {
+	port := ""
+	for _, c := range containers {
+		if c.Name == corev1alpha1.InferenceContainerName && len(c.Ports) > 0 {
+			port = strconv.Itoa(int(c.Ports[0].ContainerPort))
+			break
+		}
+	}
+
+	r := strings.NewReplacer(
+		corev1alpha1.ModelURIPlaceholder, s.Spec.Model.URI,
+		corev1alpha1.ModelNamePlaceholder, s.Name,
+		corev1alpha1.ModelMountPathPlaceholder, modelMountPath,
+		corev1alpha1.StepNamePlaceholder, s.Name,
+		corev1alpha1.StepNamespacePlaceholder, s.Namespace,
+		corev1alpha1.PortPlaceholder, port,
+	)
+
+	resolve := func(value string) (string, error) {
+		if port == "" && strings.Contains(value, corev1alpha1.PortPlaceholder) {
+			return "", fmt.Errorf("%s is referenced but container %q exposes no port", corev1alpha1.PortPlaceholder, corev1alpha1.InferenceContainerName)
+		}
+		return r.Replace(value), nil
+	}
+
+	for i := range containers {
+		c := &containers[i]
+		for _, values := range [][]string{c.Command, c.Args} {
+			for j, v := range values {
+				resolved, err := resolve(v)
+				if err != nil {
+					return err
+				}
+				values[j] = resolved
+			}
+		}
+		for j, e := range c.Env {
+			resolved, err := resolve(e.Value)
+			if err != nil {
+				return err
+			}
+			c.Env[j].Value = resolved
+		}
+	}
+
+	return nil
+}
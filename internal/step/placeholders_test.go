@@ -0,0 +1,86 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package step
+
+import (
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolvePlaceholders(t *testing.T) {
+	s := &corev1alpha1.Step{
+		ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "vision"},
+		Spec: corev1alpha1.StepSpec{
+			Model: &corev1alpha1.ModelSpec{ModelFormat: corev1alpha1.TensorflowModelFormat, URI: "gs://models/resnet"},
+		},
+	}
+	containers := []corev1.Container{{
+		Name:    corev1alpha1.InferenceContainerName,
+		Command: []string{"/usr/bin/tensorflow_model_server"},
+		Args: []string{
+			"--model_name=$(model.name)",
+			"--model_base_path=$(model.mountPath)",
+			"--rest_api_port=$(runtime.port)",
+			"--workers=$(WORKERS)",
+		},
+		Env: []corev1.EnvVar{
+			{Name: "MODEL_URI", Value: "$(model.uri)"},
+			{Name: "STEP", Value: "$(step.namespace)/$(step.name)"},
+		},
+		Ports: []corev1.ContainerPort{{ContainerPort: 8080}},
+	}}
+
+	if err := resolvePlaceholders(s, containers); err != nil {
+		t.Fatal(err)
+	}
+
+	wantArgs := []string{
+		"--model_name=classifier",
+		"--model_base_path=/mnt/models",
+		"--rest_api_port=8080",
+		"--workers=$(WORKERS)",
+	}
+	if !equality.Semantic.DeepEqual(containers[0].Args, wantArgs) {
+		t.Errorf("expected args %v, got %v", wantArgs, containers[0].Args)
+	}
+	wantEnv := []corev1.EnvVar{
+		{Name: "MODEL_URI", Value: "gs://models/resnet"},
+		{Name: "STEP", Value: "vision/classifier"},
+	}
+	if !equality.Semantic.DeepEqual(containers[0].Env, wantEnv) {
+		t.Errorf("expected env %v, got %v", wantEnv, containers[0].Env)
+	}
+}
+
+func TestResolvePlaceholdersWithoutPort(t *testing.T) {
+	s := &corev1alpha1.Step{
+		ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "vision"},
+		Spec:       corev1alpha1.StepSpec{Model: &corev1alpha1.ModelSpec{URI: "gs://models/resnet"}},
+	}
+	containers := []corev1.Container{{
+		Name: corev1alpha1.InferenceContainerName,
+		Args: []string{"--port=$(runtime.port)"},
+	}}
+
+	if err := resolvePlaceholders(s, containers); err == nil {
+		t.Error("expected an error for the port of a runtime exposing none")
+	}
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adoption
+
+import (
+	"fmt"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/kmeta"
+)
+
+// Claim makes the step the controller of an object it adopts. Objects controlled by anything
+// else are never taken over.
+func Claim(s *corev1alpha1.Step, obj metav1.Object) error {
+	if metav1.IsControlledBy(obj, s) {
+		return nil
+	}
+	if owner := metav1.GetControllerOf(obj); owner != nil {
+		return fmt.Errorf("%q is already controlled by %s %q", obj.GetName(), owner.Kind, owner.Name)
+	}
+
+	obj.SetOwnerReferences(append(obj.GetOwnerReferences(), *kmeta.NewControllerRef(s)))
+	return nil
+}
@@ -22,26 +22,40 @@ import (
 	"fmt"
 
 	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	"github.com/dreamstax/kai/internal/step/defaults"
+	"github.com/dreamstax/kai/internal/step/reconcilers/adoption"
 	"github.com/dreamstax/kai/internal/step/reconcilers/names"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	"knative.dev/pkg/kmap"
 	"knative.dev/pkg/kmeta"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// reasons surfaced on the DeploymentReady condition
+const (
+	reasonAvailable                = "Available"
+	reasonDeploying                = "Deploying"
+	reasonProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+)
+
 type Reconciler struct {
 	client kclient.Client
+	// apiReader reads the pods of adopted deployments, which the cache of the client leaves
+	// out until they're labeled for the step
+	apiReader kclient.Reader
 }
 
-func NewReconciler(client kclient.Client) *Reconciler {
+func NewReconciler(client kclient.Client, apiReader kclient.Reader) *Reconciler {
 	return &Reconciler{
-		client: client,
+		client:    client,
+		apiReader: apiReader,
 	}
 }
 
@@ -51,24 +65,106 @@ func (r *Reconciler) Reconcile(ctx context.Context, s *corev1alpha1.Step) error
 	err := r.client.Get(ctx, deploymentName, deployment)
 	if apierrs.IsNotFound(err) {
 		// deplyoment doesn't exist so create it.
-		_, err = r.createDeployment(ctx, deploymentName, s)
+		deployment, err = r.createDeployment(ctx, deploymentName, s)
 		if err != nil {
 			return fmt.Errorf("failed to create deployment %q: %w", deploymentName, err)
 		}
 	} else if err != nil {
 		return fmt.Errorf("failed to get deployment %q: %w", deploymentName, err)
+	} else if deployment.DeletionTimestamp != nil || needsReplacement(s, deployment) {
+		// the deployment is created again once deleted
+		return r.replaceDeployment(ctx, s, deployment)
 	} else {
 		// deployment exists
-		_, err = r.updateDeployment(ctx, deploymentName, s, deployment)
+		deployment, err = r.updateDeployment(ctx, deploymentName, s, deployment)
 		if err != nil {
 			return fmt.Errorf("failed to update deplyoment %q: %w", deploymentName, err)
 		}
+	}
+
+	surfaceStatus(s, deployment)
+
+	// the pods of a replaced deployment serve until the new one is available
+	if meta.IsStatusConditionTrue(s.Status.Conditions, corev1alpha1.StepConditionDeploymentReady) {
+		if err := r.deleteOrphanedReplicaSets(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	if names.IsAdoptedDeployment(s, deployment.Name) {
+		if err := r.labelAdoptedPods(ctx, s, deployment); err != nil {
+			return err
+		}
+	}
+
+	// earlier revisions pinned by the traffic of the step run alongside the latest one
+	if err := r.reconcileRevisions(ctx, s, deployment); err != nil {
+		return err
+	}
+
+	// failing pods don't fail the deployment until its progress deadline passes and even then
+	// the deployment doesn't say why, check the pods directly so the step reports the cause
+	if !meta.IsStatusConditionTrue(s.Status.Conditions, corev1alpha1.StepConditionDeploymentReady) {
+		failure, err := r.checkPods(ctx, s)
+		if err != nil {
+			return err
+		}
+		if failure != nil {
+			meta.SetStatusCondition(&s.Status.Conditions, metav1.Condition{
+				Type:               corev1alpha1.StepConditionDeploymentReady,
+				Status:             metav1.ConditionFalse,
+				ObservedGeneration: s.Generation,
+				Reason:             failure.reason,
+				Message:            failure.message,
+			})
+		}
+	}
+
+	return nil
+}
 
-		// TODO: Surface deployment status to step
+// surfaceStatus reflects the rollout state of the deployment on the step.
+func surfaceStatus(s *corev1alpha1.Step, d *appsv1.Deployment) {
+	s.Status.Replicas = d.Status.ReadyReplicas
+	if d.Spec.Replicas != nil {
+		s.Status.DesiredReplicas = *d.Spec.Replicas
 	}
 
-	// TODO: handle failing pods
+	cond := metav1.Condition{
+		Type:               corev1alpha1.StepConditionDeploymentReady,
+		ObservedGeneration: s.Generation,
+	}
+
+	progressing := deploymentCondition(d, appsv1.DeploymentProgressing)
+	available := deploymentCondition(d, appsv1.DeploymentAvailable)
+	switch {
+	case d.Status.ObservedGeneration < d.Generation:
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = reasonDeploying
+		cond.Message = "waiting for deployment spec update to be observed"
+	case progressing != nil && progressing.Status == corev1.ConditionFalse && progressing.Reason == "ProgressDeadlineExceeded":
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reasonProgressDeadlineExceeded
+		cond.Message = progressing.Message
+	case available != nil && available.Status == corev1.ConditionTrue && d.Status.UpdatedReplicas == d.Status.Replicas:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = reasonAvailable
+		cond.Message = fmt.Sprintf("%d of %d replicas ready", d.Status.ReadyReplicas, s.Status.DesiredReplicas)
+	default:
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = reasonDeploying
+		cond.Message = fmt.Sprintf("%d of %d replicas ready", d.Status.ReadyReplicas, s.Status.DesiredReplicas)
+	}
+
+	meta.SetStatusCondition(&s.Status.Conditions, cond)
+}
 
+func deploymentCondition(d *appsv1.Deployment, t appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range d.Status.Conditions {
+		if d.Status.Conditions[i].Type == t {
+			return &d.Status.Conditions[i]
+		}
+	}
 	return nil
 }
 
@@ -96,13 +192,20 @@ func (r *Reconciler) updateDeployment(ctx context.Context, name types.Namespaced
 	deployment.Spec.Replicas = in.Spec.Replicas
 	deployment.Spec.Selector = in.Spec.Selector
 
-	if equality.Semantic.DeepEqual(in.Spec, deployment.Spec) {
+	if names.IsAdoptedDeployment(step, in.Name) {
+		adoptTemplate(step, in, deployment)
+	}
+
+	if equality.Semantic.DeepEqual(in.Spec, deployment.Spec) && metav1.IsControlledBy(in, step) {
 		// no changes to make just return
 		return in, nil
 	}
 
 	// update deployment
 	out := in.DeepCopy()
+	if err := adoption.Claim(step, out); err != nil {
+		return nil, fmt.Errorf("failed to adopt deployment %q: %w", name, err)
+	}
 	out.Spec = deployment.Spec
 	out.Labels = kmap.Union(deployment.Labels, out.Labels)
 
@@ -114,23 +217,43 @@ func (r *Reconciler) updateDeployment(ctx context.Context, name types.Namespaced
 	return out, nil
 }
 
+// adoptTemplate keeps the pods of an adopted deployment running untouched until the step
+// changes them. Once they change the pods are labeled for the step, keeping the labels the
+// immutable selector of the deployment matches on.
+func adoptTemplate(s *corev1alpha1.Step, in, desired *appsv1.Deployment) {
+	if in.Spec.Template.Labels[kai.StepUIDLabelKey] != string(s.UID) &&
+		equality.Semantic.DeepDerivative(desired.Spec.Template.Spec, in.Spec.Template.Spec) {
+		desired.Spec.Template = in.Spec.Template
+		return
+	}
+	desired.Spec.Template.Labels = kmap.Union(in.Spec.Template.Labels, desired.Spec.Template.Labels)
+}
+
 func (r *Reconciler) makeDeployment(ctx context.Context, name types.NamespacedName, step *corev1alpha1.Step) (*appsv1.Deployment, error) {
-	stepSpec := step.Spec.DeepCopy()
+	spec := step.Spec.DeepCopy()
+	defaults.SetDefaults(spec)
 
-	var initialReplicaCount int32
-	if stepSpec.MinReplicas == nil || (*stepSpec.MinReplicas) < 1 {
-		initialReplicaCount = 1
-	} else {
-		initialReplicaCount = *stepSpec.MinReplicas
+	podLabels := names.MakePodLabels(step, step.Status.LatestRevision, false)
+	deployment, err := makeDeployment(name, step, &step.Spec.PodSpec, podLabels, *spec.MinReplicas)
+	if err != nil {
+		return nil, err
 	}
-	// TODO: get deadline from step
-	var progressDeadline int32 = 60
-	maxUnavailable := intstr.FromInt(0)
+	deployment.Labels = names.MakeLabels(step)
+	// the deployment runs each new revision of the step in turn, its selector can't depend on
+	// the revision as selectors are immutable
+	deployment.Spec.Selector = names.MakeLatestSelector(step)
+
+	return deployment, nil
+}
+
+// makeDeployment returns a deployment running the given pod spec of the step.
+func makeDeployment(name types.NamespacedName, step *corev1alpha1.Step, podSpec *corev1alpha1.PodSpec, podLabels map[string]string, replicas int32) (*appsv1.Deployment, error) {
+	spec := step.Spec.DeepCopy()
+	defaults.SetDefaults(spec)
 
-	labels := names.MakeLabels(step)
 	annotations := names.MakeAnnotations(step)
 
-	podSpecJson, err := json.Marshal(stepSpec.PodSpec)
+	podSpecJson, err := json.Marshal(podSpec)
 	if err != nil {
 		return nil, err
 	}
@@ -144,23 +267,24 @@ func (r *Reconciler) makeDeployment(ctx context.Context, name types.NamespacedNa
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            name.Name,
 			Namespace:       step.Namespace,
-			Labels:          labels,
+			Labels:          podLabels,
 			Annotations:     annotations,
 			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(step)},
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas:                &initialReplicaCount,
-			Selector:                names.MakeSelector(step),
-			ProgressDeadlineSeconds: &progressDeadline,
+			Replicas:                &replicas,
+			Selector:                names.MakeRevisionSelector(step, podLabels[kai.StepRevisionLabelKey]),
+			ProgressDeadlineSeconds: spec.Rollout.ProgressDeadlineSeconds,
 			Strategy: appsv1.DeploymentStrategy{
 				Type: appsv1.RollingUpdateDeploymentStrategyType,
 				RollingUpdate: &appsv1.RollingUpdateDeployment{
-					MaxUnavailable: &maxUnavailable,
+					MaxUnavailable: spec.Rollout.MaxUnavailable,
+					MaxSurge:       spec.Rollout.MaxSurge,
 				},
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels:      labels,
+					Labels:      podLabels,
 					Annotations: annotations,
 				},
 				Spec: corePodSpec,
@@ -0,0 +1,395 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	"github.com/dreamstax/kai/internal/step/reconcilers/names"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{corev1alpha1.AddToScheme, appsv1.AddToScheme, corev1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return scheme
+}
+
+func TestReconcileAdoptsDeployment(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := newScheme(t)
+
+	replicas := int32(3)
+	container := corev1.Container{Name: "server", Image: "torchserve:0.8"}
+	existing := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy-model", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "legacy-model"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "legacy-model"}},
+				Spec: corev1.PodSpec{
+					Containers:                    []corev1.Container{container},
+					TerminationGracePeriodSeconds: func() *int64 { v := int64(30); return &v }(),
+				},
+			},
+		},
+	}
+	s := &corev1alpha1.Step{
+		TypeMeta:   metav1.TypeMeta{APIVersion: corev1alpha1.GroupVersion.String(), Kind: "Step"},
+		ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "default", UID: "classifier-uid"},
+		Spec: corev1alpha1.StepSpec{
+			PodSpec: corev1alpha1.PodSpec{Containers: []corev1.Container{container}},
+			Adopt:   &corev1alpha1.StepAdoption{Deployment: "legacy-model"},
+		},
+		Status: corev1alpha1.StepStatus{
+			LatestRevision: "classifier-aaaaaaaaaa",
+			Traffic: []corev1alpha1.TrafficTargetStatus{
+				{RevisionName: "classifier-aaaaaaaaaa", LatestRevision: true, Percent: 100},
+			},
+		},
+	}
+
+	kc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).Build()
+	r := NewReconciler(kc, kc)
+
+	if err := r.Reconcile(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	adopted := &appsv1.Deployment{}
+	if err := kc.Get(ctx, kclient.ObjectKeyFromObject(existing), adopted); err != nil {
+		t.Fatal(err)
+	}
+	if !metav1.IsControlledBy(adopted, s) {
+		t.Errorf("expected deployment to be controlled by the step, got owners %+v", adopted.OwnerReferences)
+	}
+	if adopted.Labels[kai.StepUIDLabelKey] != string(s.UID) {
+		t.Errorf("expected deployment to be labeled for the step, got %v", adopted.Labels)
+	}
+	if _, ok := adopted.Spec.Template.Labels[kai.StepUIDLabelKey]; ok || *adopted.Spec.Replicas != replicas {
+		t.Errorf("expected pods of the adopted deployment to be left untouched, got template labels %v replicas %d",
+			adopted.Spec.Template.Labels, *adopted.Spec.Replicas)
+	}
+
+	// changing the pods relabels them while keeping the labels the selector matches on
+	s.Spec.Containers[0].Image = "torchserve:0.9"
+	if err := r.Reconcile(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := kc.Get(ctx, kclient.ObjectKeyFromObject(existing), adopted); err != nil {
+		t.Fatal(err)
+	}
+	labels := adopted.Spec.Template.Labels
+	if labels["app"] != "legacy-model" || labels[kai.StepUIDLabelKey] != string(s.UID) {
+		t.Errorf("expected pods to keep their labels and be labeled for the step, got %v", labels)
+	}
+	if got := adopted.Spec.Template.Spec.Containers[0].Image; got != "torchserve:0.9" {
+		t.Errorf("expected image to be updated, got %q", got)
+	}
+}
+
+func TestReconcileRefusesControlledDeployment(t *testing.T) {
+	scheme := newScheme(t)
+
+	controller := true
+	existing := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "legacy-model",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "argoproj.io/v1alpha1", Kind: "Rollout", Name: "legacy-model", UID: "rollout-uid", Controller: &controller},
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "legacy-model"}},
+		},
+	}
+	s := &corev1alpha1.Step{
+		TypeMeta:   metav1.TypeMeta{APIVersion: corev1alpha1.GroupVersion.String(), Kind: "Step"},
+		ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "default", UID: "classifier-uid"},
+		Spec: corev1alpha1.StepSpec{
+			Adopt: &corev1alpha1.StepAdoption{Deployment: "legacy-model"},
+		},
+	}
+
+	kc := fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).Build()
+	if err := NewReconciler(kc, kc).Reconcile(context.Background(), s); err == nil {
+		t.Error("expected adopting a deployment controlled by another resource to fail")
+	}
+}
+
+func TestReconcileLabelsAdoptedPods(t *testing.T) {
+	ctx := context.Background()
+
+	replicas := int32(1)
+	container := corev1.Container{Name: "server", Image: "torchserve:0.8"}
+	existing := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy-model", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "legacy-model"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "legacy-model"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{container}},
+			},
+		},
+	}
+	crashing := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy-model-1", Namespace: "default", Labels: map[string]string{"app": "legacy-model"}},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "server",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			}},
+		},
+	}
+	other := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", Labels: map[string]string{"app": "other"}},
+	}
+	s := &corev1alpha1.Step{
+		TypeMeta:   metav1.TypeMeta{APIVersion: corev1alpha1.GroupVersion.String(), Kind: "Step"},
+		ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "default", UID: "classifier-uid"},
+		Spec: corev1alpha1.StepSpec{
+			PodSpec: corev1alpha1.PodSpec{Containers: []corev1.Container{container}},
+			Adopt:   &corev1alpha1.StepAdoption{Deployment: "legacy-model"},
+		},
+	}
+
+	kc := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(existing, crashing, other).Build()
+	if err := NewReconciler(kc, kc).Reconcile(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the pods of the deployment are labeled for the step so they're watched and checked like
+	// the pods the step creates
+	pod := &corev1.Pod{}
+	if err := kc.Get(ctx, kclient.ObjectKeyFromObject(crashing), pod); err != nil {
+		t.Fatal(err)
+	}
+	if pod.Labels["app"] != "legacy-model" || pod.Labels[kai.StepLabelKey] != s.Name || pod.Labels[kai.StepUIDLabelKey] != string(s.UID) {
+		t.Errorf("expected pod to keep its labels and be labeled for the step, got %v", pod.Labels)
+	}
+	if err := kc.Get(ctx, kclient.ObjectKeyFromObject(other), pod); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pod.Labels[kai.StepUIDLabelKey]; ok {
+		t.Errorf("expected pods outside of the deployment to be left alone, got %v", pod.Labels)
+	}
+
+	cond := meta.FindStatusCondition(s.Status.Conditions, corev1alpha1.StepConditionDeploymentReady)
+	if cond == nil || cond.Reason != reasonCrashLoopBackOff {
+		t.Errorf("expected failure of the adopted pod to be reported, got %+v", cond)
+	}
+}
+
+func TestReconcileReplacesLegacyDeployment(t *testing.T) {
+	ctx := context.Background()
+
+	container := corev1.Container{Name: "server", Image: "torchserve:0.8"}
+	s := &corev1alpha1.Step{
+		TypeMeta:   metav1.TypeMeta{APIVersion: corev1alpha1.GroupVersion.String(), Kind: "Step"},
+		ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "default", UID: "classifier-uid"},
+		Spec: corev1alpha1.StepSpec{
+			PodSpec: corev1alpha1.PodSpec{Containers: []corev1.Container{container}},
+		},
+		Status: corev1alpha1.StepStatus{LatestRevision: "classifier-aaaaaaaaaa"},
+	}
+
+	// created before the latest revision ran apart from pinned revisions, its selector matches
+	// the pods of every revision
+	legacy, err := makeDeployment(names.DeploymentName(s), s, &s.Spec.PodSpec, names.MakeLabels(s), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.Spec.Selector = names.MakeSelector(s)
+	legacy.UID = "legacy-uid"
+	owner := *metav1.NewControllerRef(legacy, appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	orphaned := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "classifier-deployment-1", Namespace: "default", Labels: names.MakeLabels(s)},
+	}
+	pinned := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "classifier-pinned-1",
+			Namespace:       "default",
+			Labels:          names.MakeLabels(s),
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+	}
+
+	kc := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(legacy, orphaned, pinned).WithStatusSubresource(legacy).Build()
+	r := NewReconciler(kc, kc)
+
+	// the legacy deployment is deleted and its pods keep serving meanwhile
+	if err := r.Reconcile(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := kc.Get(ctx, names.DeploymentName(s), &appsv1.Deployment{}); !apierrs.IsNotFound(err) {
+		t.Fatalf("expected legacy deployment to be deleted, got %v", err)
+	}
+	cond := meta.FindStatusCondition(s.Status.Conditions, corev1alpha1.StepConditionDeploymentReady)
+	if cond == nil || cond.Status != metav1.ConditionUnknown {
+		t.Errorf("expected deployment to be reported as deploying, got %+v", cond)
+	}
+
+	// the deployment created in its place only selects the latest revision
+	if err := r.Reconcile(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	replaced := &appsv1.Deployment{}
+	if err := kc.Get(ctx, names.DeploymentName(s), replaced); err != nil {
+		t.Fatal(err)
+	}
+	if !equality.Semantic.DeepEqual(replaced.Spec.Selector, names.MakeLatestSelector(s)) {
+		t.Errorf("expected deployment to select the latest revision, got %v", replaced.Spec.Selector)
+	}
+	if err := kc.Get(ctx, kclient.ObjectKeyFromObject(orphaned), &appsv1.ReplicaSet{}); err != nil {
+		t.Errorf("expected replica set of the legacy deployment to serve until the new one is available, got %v", err)
+	}
+
+	// once available the replica sets left behind are deleted
+	replaced.Status = appsv1.DeploymentStatus{
+		ObservedGeneration: replaced.Generation,
+		Replicas:           1,
+		UpdatedReplicas:    1,
+		ReadyReplicas:      1,
+		Conditions:         []appsv1.DeploymentCondition{{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue}},
+	}
+	if err := kc.Status().Update(ctx, replaced); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reconcile(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := kc.Get(ctx, kclient.ObjectKeyFromObject(orphaned), &appsv1.ReplicaSet{}); !apierrs.IsNotFound(err) {
+		t.Errorf("expected orphaned replica set to be deleted, got %v", err)
+	}
+	if err := kc.Get(ctx, kclient.ObjectKeyFromObject(pinned), &appsv1.ReplicaSet{}); err != nil {
+		t.Errorf("expected controlled replica set to be kept, got %v", err)
+	}
+}
+
+func TestReconcilePinnedRevisions(t *testing.T) {
+	ctx := context.Background()
+
+	container := corev1.Container{Name: "server", Image: "torchserve:0.8"}
+	podSpec, err := json.Marshal(corev1alpha1.PodSpec{Containers: []corev1.Container{container}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := &appsv1.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{Name: "classifier-aaaaaaaaaa", Namespace: "default"},
+		Data:       runtime.RawExtension{Raw: podSpec},
+		Revision:   1,
+	}
+
+	container.Image = "torchserve:0.9"
+	s := &corev1alpha1.Step{
+		TypeMeta:   metav1.TypeMeta{APIVersion: corev1alpha1.GroupVersion.String(), Kind: "Step"},
+		ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "default", UID: "classifier-uid"},
+		Spec: corev1alpha1.StepSpec{
+			PodSpec: corev1alpha1.PodSpec{Containers: []corev1.Container{container}},
+		},
+		Status: corev1alpha1.StepStatus{
+			LatestRevision: "classifier-bbbbbbbbbb",
+			Traffic: []corev1alpha1.TrafficTargetStatus{
+				{RevisionName: "classifier-aaaaaaaaaa", Percent: 50},
+				{RevisionName: "classifier-bbbbbbbbbb", LatestRevision: true, Percent: 50},
+			},
+		},
+	}
+
+	kc := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(pinned).Build()
+	r := NewReconciler(kc, kc)
+	if err := r.Reconcile(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	latest := &appsv1.Deployment{}
+	if err := kc.Get(ctx, names.DeploymentName(s), latest); err != nil {
+		t.Fatal(err)
+	}
+	revision := &appsv1.Deployment{}
+	if err := kc.Get(ctx, names.RevisionDeploymentName(s, "classifier-aaaaaaaaaa"), revision); err != nil {
+		t.Fatal(err)
+	}
+
+	// the deployments never select each other's pods, the autoscaler of the step only observes
+	// the latest revision
+	latestSelector, err := metav1.LabelSelectorAsSelector(latest.Spec.Selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisionSelector, err := metav1.LabelSelectorAsSelector(revision.Spec.Selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latestSelector.Matches(labels.Set(latest.Spec.Template.Labels)) || latestSelector.Matches(labels.Set(revision.Spec.Template.Labels)) {
+		t.Errorf("expected latest deployment to only select its own pods, got selector %v", latestSelector)
+	}
+	if !revisionSelector.Matches(labels.Set(revision.Spec.Template.Labels)) || revisionSelector.Matches(labels.Set(latest.Spec.Template.Labels)) {
+		t.Errorf("expected revision deployment to only select its own pods, got selector %v", revisionSelector)
+	}
+
+	// both revisions receive traffic through the service
+	service := labels.SelectorFromSet(names.MakeServiceSelector(s))
+	if !service.Matches(labels.Set(latest.Spec.Template.Labels)) || !service.Matches(labels.Set(revision.Spec.Template.Labels)) {
+		t.Errorf("expected service to select both revisions, got selector %v", service)
+	}
+
+	// shifting all traffic to the pinned revision leaves the pods of the latest revision running
+	// untouched and only takes them out of the service
+	s.Status.Traffic = []corev1alpha1.TrafficTargetStatus{
+		{RevisionName: "classifier-aaaaaaaaaa", Percent: 100},
+		{RevisionName: "classifier-bbbbbbbbbb", LatestRevision: true, Percent: 0},
+	}
+	if err := r.Reconcile(ctx, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated := &appsv1.Deployment{}
+	if err := kc.Get(ctx, names.DeploymentName(s), updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Generation != latest.Generation || !equality.Semantic.DeepEqual(updated.Spec.Template, latest.Spec.Template) {
+		t.Errorf("expected pods of the latest revision to be left untouched, got template %+v", updated.Spec.Template)
+	}
+
+	service = labels.SelectorFromSet(names.MakeServiceSelector(s))
+	if service.Matches(labels.Set(latest.Spec.Template.Labels)) || !service.Matches(labels.Set(revision.Spec.Template.Labels)) {
+		t.Errorf("expected service to only select the pinned revision, got selector %v", service)
+	}
+}
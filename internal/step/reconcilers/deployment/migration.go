@@ -0,0 +1,90 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"fmt"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/step/reconcilers/names"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// needsReplacement reports whether the deployment of the step was created with a selector
+// matching all the pods of the step, including those of the revisions pinned by its traffic.
+// Selectors are immutable so the deployment has to be replaced to only select the latest
+// revision. Adopted deployments keep the selector they were adopted with, which never matches
+// the pods of pinned revisions.
+func needsReplacement(s *corev1alpha1.Step, d *appsv1.Deployment) bool {
+	return !names.IsAdoptedDeployment(s, d.Name) && !equality.Semantic.DeepEqual(d.Spec.Selector, names.MakeLatestSelector(s))
+}
+
+// replaceDeployment deletes the deployment of the step while orphaning its replica sets, so its
+// pods keep serving until the deployment created in its place is available.
+func (r *Reconciler) replaceDeployment(ctx context.Context, s *corev1alpha1.Step, d *appsv1.Deployment) error {
+	if d.DeletionTimestamp == nil {
+		err := r.client.Delete(ctx, d,
+			kclient.PropagationPolicy(metav1.DeletePropagationOrphan),
+			kclient.Preconditions{UID: &d.UID})
+		if err != nil && !apierrs.IsNotFound(err) {
+			return fmt.Errorf("failed to replace deployment %q: %w", d.Name, err)
+		}
+	}
+
+	meta.SetStatusCondition(&s.Status.Conditions, metav1.Condition{
+		Type:               corev1alpha1.StepConditionDeploymentReady,
+		Status:             metav1.ConditionUnknown,
+		ObservedGeneration: s.Generation,
+		Reason:             reasonDeploying,
+		Message:            fmt.Sprintf("replacing deployment %q to update its selector", d.Name),
+	})
+	return nil
+}
+
+// deleteOrphanedReplicaSets deletes the replica sets of the step left behind by a replaced
+// deployment, along with their pods.
+func (r *Reconciler) deleteOrphanedReplicaSets(ctx context.Context, s *corev1alpha1.Step) error {
+	selector, err := metav1.LabelSelectorAsSelector(names.MakeSelector(s))
+	if err != nil {
+		return fmt.Errorf("failed to make selector for step %q: %w", s.NamespacedName(), err)
+	}
+
+	replicaSets := &appsv1.ReplicaSetList{}
+	err = r.client.List(ctx, replicaSets, kclient.InNamespace(s.Namespace), kclient.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list replica sets for step %q: %w", s.NamespacedName(), err)
+	}
+
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		if rs.DeletionTimestamp != nil || metav1.GetControllerOf(rs) != nil {
+			continue
+		}
+		err := r.client.Delete(ctx, rs, kclient.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !apierrs.IsNotFound(err) {
+			return fmt.Errorf("failed to delete replica set %q: %w", rs.Name, err)
+		}
+	}
+
+	return nil
+}
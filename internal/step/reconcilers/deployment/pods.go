@@ -0,0 +1,172 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"fmt"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	"github.com/dreamstax/kai/internal/step/reconcilers/names"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/kmap"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reasons surfaced on the DeploymentReady condition when pods of the step are failing
+const (
+	reasonCrashLoopBackOff         = "CrashLoopBackOff"
+	reasonImagePullBackOff         = "ImagePullBackOff"
+	reasonOOMKilled                = "OOMKilled"
+	reasonStorageInitializerFailed = "StorageInitializerFailed"
+)
+
+const storageInitializerContainerName = "storage-initializer"
+
+// podFailure describes why a container of a step's pod is unable to run.
+type podFailure struct {
+	reason  string
+	message string
+}
+
+// checkPods inspects the pods of a step and returns the first failure found, or nil if
+// none of the pods are failing.
+func (r *Reconciler) checkPods(ctx context.Context, s *corev1alpha1.Step) (*podFailure, error) {
+	selector, err := metav1.LabelSelectorAsSelector(names.MakeSelector(s))
+	if err != nil {
+		return nil, fmt.Errorf("failed to make selector for step %q: %w", s.NamespacedName(), err)
+	}
+
+	pods := &corev1.PodList{}
+	err = r.client.List(ctx, pods, kclient.InNamespace(s.Namespace), kclient.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods for step %q: %w", s.NamespacedName(), err)
+	}
+
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		for _, cs := range pod.Status.InitContainerStatuses {
+			if f := containerFailure(cs); f != nil {
+				if cs.Name == storageInitializerContainerName && f.reason != reasonImagePullBackOff {
+					// the model couldn't be downloaded, most likely a bad uri or missing credentials
+					f.reason = reasonStorageInitializerFailed
+				}
+				return f, nil
+			}
+		}
+
+		for _, cs := range pod.Status.ContainerStatuses {
+			if f := containerFailure(cs); f != nil {
+				return f, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// labelAdoptedPods labels the pods of an adopted deployment for the step. The deployment keeps
+// its pods running untouched until the step changes them, without the labels of the step they'd
+// be left out of the pods watched for the step and checked for failures. Those pods are listed
+// through the selector of the deployment as the cache only holds pods labeled for a step.
+func (r *Reconciler) labelAdoptedPods(ctx context.Context, s *corev1alpha1.Step, d *appsv1.Deployment) error {
+	selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	if err != nil {
+		return fmt.Errorf("failed to parse selector of deployment %q: %w", d.Name, err)
+	}
+
+	pods := &corev1.PodList{}
+	err = r.apiReader.List(ctx, pods, kclient.InNamespace(d.Namespace), kclient.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list pods of deployment %q: %w", d.Name, err)
+	}
+
+	labels := map[string]string{
+		kai.StepLabelKey:    s.Name,
+		kai.StepUIDLabelKey: string(s.UID),
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || pod.Labels[kai.StepUIDLabelKey] == string(s.UID) {
+			continue
+		}
+		patch := kclient.MergeFrom(pod.DeepCopy())
+		pod.Labels = kmap.Union(pod.Labels, labels)
+		if err := r.client.Patch(ctx, pod, patch); err != nil && !apierrs.IsNotFound(err) {
+			return fmt.Errorf("failed to label pod %q: %w", pod.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// containerFailure classifies the state of a container, returning nil if the container
+// is not failing.
+func containerFailure(cs corev1.ContainerStatus) *podFailure {
+	last := cs.LastTerminationState.Terminated
+
+	if w := cs.State.Waiting; w != nil {
+		switch w.Reason {
+		case "ImagePullBackOff", "ErrImagePull", "InvalidImageName":
+			return &podFailure{
+				reason:  reasonImagePullBackOff,
+				message: fmt.Sprintf("container %q is unable to pull image %q: %s", cs.Name, cs.Image, w.Message),
+			}
+		case "CrashLoopBackOff":
+			reason := reasonCrashLoopBackOff
+			if last != nil && last.Reason == reasonOOMKilled {
+				reason = reasonOOMKilled
+			}
+			return &podFailure{
+				reason:  reason,
+				message: fmt.Sprintf("container %q is crashing: %s", cs.Name, terminationMessage(last, w.Message)),
+			}
+		}
+	}
+
+	if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+		reason := reasonCrashLoopBackOff
+		if t.Reason == reasonOOMKilled {
+			reason = reasonOOMKilled
+		}
+		return &podFailure{
+			reason:  reason,
+			message: fmt.Sprintf("container %q terminated: %s", cs.Name, terminationMessage(t, "")),
+		}
+	}
+
+	return nil
+}
+
+// terminationMessage returns the message a container left when it terminated, falling back
+// to its exit reason and code.
+func terminationMessage(t *corev1.ContainerStateTerminated, fallback string) string {
+	if t == nil {
+		return fallback
+	}
+	if t.Message != "" {
+		return t.Message
+	}
+	return fmt.Sprintf("%s (exit code %d)", t.Reason, t.ExitCode)
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func waiting(name, reason, message string) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:  name,
+		Image: "kai/" + name,
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: message}},
+	}
+}
+
+func terminated(reason string, exitCode int32, message string) *corev1.ContainerStateTerminated {
+	return &corev1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode, Message: message}
+}
+
+func TestContainerFailure(t *testing.T) {
+	crashLoop := func(last *corev1.ContainerStateTerminated) corev1.ContainerStatus {
+		cs := waiting("server", "CrashLoopBackOff", "back-off 5m0s restarting failed container")
+		cs.LastTerminationState.Terminated = last
+		return cs
+	}
+
+	tests := []struct {
+		name    string
+		status  corev1.ContainerStatus
+		reason  string
+		message string
+	}{{
+		name:   "running",
+		status: corev1.ContainerStatus{Name: "server", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+	}, {
+		name:   "creating",
+		status: waiting("server", "ContainerCreating", ""),
+	}, {
+		name:    "image pull back off",
+		status:  waiting("server", "ImagePullBackOff", "Back-off pulling image"),
+		reason:  reasonImagePullBackOff,
+		message: `container "server" is unable to pull image "kai/server": Back-off pulling image`,
+	}, {
+		name:    "image pull error",
+		status:  waiting("server", "ErrImagePull", "manifest unknown"),
+		reason:  reasonImagePullBackOff,
+		message: `container "server" is unable to pull image "kai/server": manifest unknown`,
+	}, {
+		name:    "invalid image name",
+		status:  waiting("server", "InvalidImageName", "couldn't parse image reference"),
+		reason:  reasonImagePullBackOff,
+		message: `container "server" is unable to pull image "kai/server": couldn't parse image reference`,
+	}, {
+		name:    "crash loop with termination message",
+		status:  crashLoop(terminated("Error", 1, "model.mar not found")),
+		reason:  reasonCrashLoopBackOff,
+		message: `container "server" is crashing: model.mar not found`,
+	}, {
+		name:    "crash loop without termination message",
+		status:  crashLoop(terminated("Error", 2, "")),
+		reason:  reasonCrashLoopBackOff,
+		message: `container "server" is crashing: Error (exit code 2)`,
+	}, {
+		name:    "crash loop without last state",
+		status:  crashLoop(nil),
+		reason:  reasonCrashLoopBackOff,
+		message: `container "server" is crashing: back-off 5m0s restarting failed container`,
+	}, {
+		name:    "crash loop after oom",
+		status:  crashLoop(terminated("OOMKilled", 137, "")),
+		reason:  reasonOOMKilled,
+		message: `container "server" is crashing: OOMKilled (exit code 137)`,
+	}, {
+		name: "terminated with error",
+		status: corev1.ContainerStatus{
+			Name:  "server",
+			State: corev1.ContainerState{Terminated: terminated("Error", 1, "")},
+		},
+		reason:  reasonCrashLoopBackOff,
+		message: `container "server" terminated: Error (exit code 1)`,
+	}, {
+		name: "oom killed",
+		status: corev1.ContainerStatus{
+			Name:  "server",
+			State: corev1.ContainerState{Terminated: terminated("OOMKilled", 137, "")},
+		},
+		reason:  reasonOOMKilled,
+		message: `container "server" terminated: OOMKilled (exit code 137)`,
+	}, {
+		name: "completed",
+		status: corev1.ContainerStatus{
+			Name:  "server",
+			State: corev1.ContainerState{Terminated: terminated("Completed", 0, "")},
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := containerFailure(tt.status)
+			if tt.reason == "" {
+				if f != nil {
+					t.Errorf("expected no failure, got %+v", f)
+				}
+				return
+			}
+			if f == nil {
+				t.Fatalf("expected failure %s, got none", tt.reason)
+			}
+			if f.reason != tt.reason || f.message != tt.message {
+				t.Errorf("expected %s %q, got %s %q", tt.reason, tt.message, f.reason, f.message)
+			}
+		})
+	}
+}
+
+func TestCheckPods(t *testing.T) {
+	s := &corev1alpha1.Step{
+		ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "default", UID: "classifier-uid"},
+	}
+	pod := func(name string, init []corev1.ContainerStatus, containers ...corev1.ContainerStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{kai.StepUIDLabelKey: "classifier-uid"},
+			},
+			Status: corev1.PodStatus{InitContainerStatuses: init, ContainerStatuses: containers},
+		}
+	}
+	running := corev1.ContainerStatus{Name: "server", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}
+	initializing := waiting("server", "PodInitializing", "")
+	storageFailed := corev1.ContainerStatus{
+		Name:                 storageInitializerContainerName,
+		State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		LastTerminationState: corev1.ContainerState{Terminated: terminated("Error", 1, "no such bucket")},
+	}
+
+	deleting := pod("deleting", nil, waiting("server", "ImagePullBackOff", ""))
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	deleting.Finalizers = []string{"kubernetes"}
+	otherStep := pod("other", nil, waiting("server", "ImagePullBackOff", ""))
+	otherStep.Labels[kai.StepUIDLabelKey] = "other-uid"
+
+	tests := []struct {
+		name    string
+		pods    []*corev1.Pod
+		reason  string
+		message string
+	}{{
+		name: "no pods",
+	}, {
+		name: "healthy",
+		pods: []*corev1.Pod{pod("a", nil, running)},
+	}, {
+		name:    "storage initializer failed",
+		pods:    []*corev1.Pod{pod("a", []corev1.ContainerStatus{storageFailed}, initializing)},
+		reason:  reasonStorageInitializerFailed,
+		message: `container "storage-initializer" is crashing: no such bucket`,
+	}, {
+		name:    "storage initializer image pull",
+		pods:    []*corev1.Pod{pod("a", []corev1.ContainerStatus{waiting(storageInitializerContainerName, "ImagePullBackOff", "not found")}, initializing)},
+		reason:  reasonImagePullBackOff,
+		message: `container "storage-initializer" is unable to pull image "kai/storage-initializer": not found`,
+	}, {
+		name:    "other init container failed",
+		pods:    []*corev1.Pod{pod("a", []corev1.ContainerStatus{waiting("setup", "CrashLoopBackOff", "back-off")}, initializing)},
+		reason:  reasonCrashLoopBackOff,
+		message: `container "setup" is crashing: back-off`,
+	}, {
+		name:    "failing pod among healthy pods",
+		pods:    []*corev1.Pod{pod("a", nil, running), pod("b", nil, running, waiting("sidecar", "ErrImagePull", "denied"))},
+		reason:  reasonImagePullBackOff,
+		message: `container "sidecar" is unable to pull image "kai/sidecar": denied`,
+	}, {
+		name: "deleted pods are ignored",
+		pods: []*corev1.Pod{deleting, pod("a", nil, running)},
+	}, {
+		name: "pods of other steps are ignored",
+		pods: []*corev1.Pod{otherStep, pod("a", nil, running)},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(newScheme(t))
+			for _, p := range tt.pods {
+				builder = builder.WithObjects(p.DeepCopy())
+			}
+
+			f, err := NewReconciler(builder.Build(), nil).checkPods(context.Background(), s)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.reason == "" {
+				if f != nil {
+					t.Errorf("expected no failure, got %+v", f)
+				}
+				return
+			}
+			if f == nil {
+				t.Fatalf("expected failure %s, got none", tt.reason)
+			}
+			if f.reason != tt.reason || f.message != tt.message {
+				t.Errorf("expected %s %q, got %s %q", tt.reason, tt.message, f.reason, f.message)
+			}
+		})
+	}
+}
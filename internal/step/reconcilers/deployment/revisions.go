@@ -0,0 +1,248 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"fmt"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	"github.com/dreamstax/kai/internal/step/reconcilers/names"
+	"github.com/dreamstax/kai/internal/step/reconcilers/revision"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/kmap"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcileRevisions runs a deployment for each earlier revision of the step receiving traffic
+// and removes the deployments of revisions no longer receiving any. The latest revision runs
+// in the deployment of the step which is scaled by the autoscaler, pinned revisions are scaled
+// relative to it according to their share of the traffic.
+func (r *Reconciler) reconcileRevisions(ctx context.Context, s *corev1alpha1.Step, latest *appsv1.Deployment) error {
+	pinned := pinnedPercents(s)
+
+	deployments := map[string]*appsv1.Deployment{}
+	for rev, percent := range pinned {
+		d, err := r.reconcileRevision(ctx, s, rev, revisionReplicas(s, latest, percent))
+		if err != nil {
+			return err
+		}
+		deployments[rev] = d
+	}
+
+	if err := r.deleteUnpinned(ctx, s, pinned); err != nil {
+		return err
+	}
+
+	surfaceTraffic(s, latest, deployments)
+
+	return nil
+}
+
+func (r *Reconciler) reconcileRevision(ctx context.Context, s *corev1alpha1.Step, rev string, replicas int32) (*appsv1.Deployment, error) {
+	cr := &appsv1.ControllerRevision{}
+	if err := r.client.Get(ctx, kclient.ObjectKey{Namespace: s.Namespace, Name: rev}, cr); err != nil {
+		return nil, fmt.Errorf("failed to get revision %q: %w", rev, err)
+	}
+	podSpec, err := revision.PodSpec(cr)
+	if err != nil {
+		return nil, err
+	}
+
+	name := names.RevisionDeploymentName(s, rev)
+	desired, err := makeDeployment(name, s, podSpec, names.MakePodLabels(s, rev, true), replicas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make deployment %q: %w", name, err)
+	}
+
+	deployment := &appsv1.Deployment{}
+	err = r.client.Get(ctx, name, deployment)
+	if apierrs.IsNotFound(err) {
+		if err := r.client.Create(ctx, desired); err != nil {
+			return nil, fmt.Errorf("failed to create deployment %q: %w", name, err)
+		}
+		return desired, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get deployment %q: %w", name, err)
+	}
+
+	if equality.Semantic.DeepEqual(deployment.Spec, desired.Spec) {
+		return deployment, nil
+	}
+
+	out := deployment.DeepCopy()
+	out.Spec = desired.Spec
+	out.Labels = kmap.Union(desired.Labels, out.Labels)
+	if err := r.client.Update(ctx, out); err != nil {
+		return nil, fmt.Errorf("failed to update deployment %q: %w", name, err)
+	}
+
+	return out, nil
+}
+
+// deleteUnpinned removes the deployments of earlier revisions which no longer receive traffic.
+func (r *Reconciler) deleteUnpinned(ctx context.Context, s *corev1alpha1.Step, pinned map[string]int64) error {
+	selector, err := metav1.LabelSelectorAsSelector(names.MakeSelector(s))
+	if err != nil {
+		return fmt.Errorf("failed to make selector for step %q: %w", s.NamespacedName(), err)
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	err = r.client.List(ctx, deployments, kclient.InNamespace(s.Namespace), kclient.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list deployments for step %q: %w", s.NamespacedName(), err)
+	}
+
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		// only revision deployments are labeled with their revision, the deployment of the
+		// step is never removed
+		rev, ok := d.Labels[kai.StepRevisionLabelKey]
+		if !ok || !metav1.IsControlledBy(d, s) {
+			continue
+		}
+		if _, ok := pinned[rev]; ok {
+			continue
+		}
+		err := r.client.Delete(ctx, d, kclient.PropagationPolicy(metav1.DeletePropagationBackground))
+		if kclient.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete deployment %q: %w", d.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// surfaceTraffic reports the ready replicas and effective share of each traffic target and
+// holds back the DeploymentReady condition until all pinned revisions are available.
+func surfaceTraffic(s *corev1alpha1.Step, latest *appsv1.Deployment, pinned map[string]*appsv1.Deployment) {
+	s.Status.Replicas = 0
+	if latestPercent(s) > 0 {
+		s.Status.Replicas = latest.Status.ReadyReplicas
+	}
+	for _, d := range pinned {
+		s.Status.Replicas += d.Status.ReadyReplicas
+	}
+
+	for i := range s.Status.Traffic {
+		t := &s.Status.Traffic[i]
+		if d, ok := pinned[t.RevisionName]; ok {
+			t.Replicas = d.Status.ReadyReplicas
+		} else {
+			t.Replicas = latest.Status.ReadyReplicas
+		}
+	}
+	surfaceEffectivePercents(s)
+
+	if !meta.IsStatusConditionTrue(s.Status.Conditions, corev1alpha1.StepConditionDeploymentReady) {
+		return
+	}
+	for rev, d := range pinned {
+		available := deploymentCondition(d, appsv1.DeploymentAvailable)
+		if d.Status.ObservedGeneration >= d.Generation && available != nil && available.Status == corev1.ConditionTrue {
+			continue
+		}
+		meta.SetStatusCondition(&s.Status.Conditions, metav1.Condition{
+			Type:               corev1alpha1.StepConditionDeploymentReady,
+			Status:             metav1.ConditionUnknown,
+			ObservedGeneration: s.Generation,
+			Reason:             reasonDeploying,
+			Message:            fmt.Sprintf("waiting for revision %q, %d of %d replicas ready", rev, d.Status.ReadyReplicas, *d.Spec.Replicas),
+		})
+		return
+	}
+}
+
+// surfaceEffectivePercents reports the share of requests each traffic target receives. The
+// service balances requests across the ready pods of the revisions receiving traffic, a revision
+// listed by several targets has its share split between them by their percentages.
+func surfaceEffectivePercents(s *corev1alpha1.Step) {
+	percents := map[string]int64{}
+	for _, t := range s.Status.Traffic {
+		percents[t.RevisionName] += t.Percent
+	}
+
+	for i := range s.Status.Traffic {
+		t := &s.Status.Traffic[i]
+		t.EffectivePercent = 0
+		if t.Percent == 0 || s.Status.Replicas == 0 {
+			continue
+		}
+		share := divideRound(int64(t.Replicas)*100, int64(s.Status.Replicas))
+		t.EffectivePercent = divideRound(share*t.Percent, percents[t.RevisionName])
+	}
+}
+
+// pinnedPercents returns the share of traffic of each revision other than the latest.
+func pinnedPercents(s *corev1alpha1.Step) map[string]int64 {
+	out := map[string]int64{}
+	for _, t := range s.Status.Traffic {
+		if t.RevisionName != s.Status.LatestRevision {
+			out[t.RevisionName] += t.Percent
+		}
+	}
+	return out
+}
+
+// latestPercent returns the share of traffic of the latest revision.
+func latestPercent(s *corev1alpha1.Step) int64 {
+	var out int64
+	for _, t := range s.Status.Traffic {
+		if t.RevisionName == s.Status.LatestRevision {
+			out += t.Percent
+		}
+	}
+	return out
+}
+
+// revisionReplicas scales a pinned revision so each of its pods handles about as many requests
+// as the pods of the latest revision. When the latest revision receives no traffic the minimum
+// replicas of the step are split between the pinned revisions instead.
+func revisionReplicas(s *corev1alpha1.Step, latest *appsv1.Deployment, percent int64) int32 {
+	var replicas int64
+	if lp := latestPercent(s); lp > 0 && latest.Spec.Replicas != nil {
+		replicas = divideCeil(int64(*latest.Spec.Replicas)*percent, lp)
+	} else {
+		min := int64(1)
+		if s.Spec.MinReplicas != nil && *s.Spec.MinReplicas > 1 {
+			min = int64(*s.Spec.MinReplicas)
+		}
+		replicas = divideCeil(min*percent, 100)
+	}
+
+	if replicas < 1 {
+		replicas = 1
+	}
+	if s.Spec.MaxReplicas > 0 && replicas > int64(s.Spec.MaxReplicas) {
+		replicas = int64(s.Spec.MaxReplicas)
+	}
+	return int32(replicas)
+}
+
+func divideCeil(a, b int64) int64 {
+	return (a + b - 1) / b
+}
+
+func divideRound(a, b int64) int64 {
+	return (2*a + b) / (2 * b)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+func TestSurfaceTraffic(t *testing.T) {
+	tests := []struct {
+		name           string
+		latestReplicas int32
+		pinnedPercent  int64
+		wantReplicas   int32
+		wantLatest     int64
+		wantPinned     int64
+	}{
+		{
+			// every revision receiving traffic runs a pod, small shares receive more than requested
+			name:           "single replica",
+			latestReplicas: 1,
+			pinnedPercent:  10,
+			wantReplicas:   1,
+			wantLatest:     50,
+			wantPinned:     50,
+		},
+		{
+			name:           "few replicas",
+			latestReplicas: 3,
+			pinnedPercent:  10,
+			wantReplicas:   1,
+			wantLatest:     75,
+			wantPinned:     25,
+		},
+		{
+			name:           "enough replicas",
+			latestReplicas: 9,
+			pinnedPercent:  10,
+			wantReplicas:   1,
+			wantLatest:     90,
+			wantPinned:     10,
+		},
+		{
+			name:           "even split",
+			latestReplicas: 2,
+			pinnedPercent:  50,
+			wantReplicas:   2,
+			wantLatest:     50,
+			wantPinned:     50,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &corev1alpha1.Step{
+				Status: corev1alpha1.StepStatus{
+					LatestRevision: "classifier-bbbbbbbbbb",
+					Traffic: []corev1alpha1.TrafficTargetStatus{
+						{RevisionName: "classifier-aaaaaaaaaa", Percent: tt.pinnedPercent},
+						{RevisionName: "classifier-bbbbbbbbbb", LatestRevision: true, Percent: 100 - tt.pinnedPercent},
+					},
+				},
+			}
+			latest := &appsv1.Deployment{
+				Spec:   appsv1.DeploymentSpec{Replicas: &tt.latestReplicas},
+				Status: appsv1.DeploymentStatus{ReadyReplicas: tt.latestReplicas},
+			}
+
+			replicas := revisionReplicas(s, latest, tt.pinnedPercent)
+			if replicas != tt.wantReplicas {
+				t.Fatalf("expected %d replicas for the pinned revision, got %d", tt.wantReplicas, replicas)
+			}
+			pinned := &appsv1.Deployment{
+				Spec:   appsv1.DeploymentSpec{Replicas: &replicas},
+				Status: appsv1.DeploymentStatus{ReadyReplicas: replicas},
+			}
+
+			surfaceTraffic(s, latest, map[string]*appsv1.Deployment{"classifier-aaaaaaaaaa": pinned})
+
+			if got := s.Status.Traffic[0].EffectivePercent; got != tt.wantPinned {
+				t.Errorf("expected pinned revision to receive %d%%, got %d%%", tt.wantPinned, got)
+			}
+			if got := s.Status.Traffic[1].EffectivePercent; got != tt.wantLatest {
+				t.Errorf("expected latest revision to receive %d%%, got %d%%", tt.wantLatest, got)
+			}
+		})
+	}
+}
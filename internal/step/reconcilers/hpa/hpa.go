@@ -21,10 +21,13 @@ import (
 	"fmt"
 
 	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/step/defaults"
 	"github.com/dreamstax/kai/internal/step/reconcilers/names"
 	autoscaling "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"knative.dev/pkg/kmap"
@@ -32,6 +35,11 @@ import (
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// reasons surfaced on the ScalingActive condition
+const (
+	reasonPending = "Pending"
+)
+
 type Reconciler struct {
 	client kclient.Client
 }
@@ -48,8 +56,7 @@ func (r *Reconciler) Reconcile(ctx context.Context, s *corev1alpha1.Step) error
 	err := r.client.Get(ctx, hpaName, hpa)
 	if apierrs.IsNotFound(err) {
 		// hpa doesn't exist so create it.
-		// TODO: set step status (we should expose enough info to users for proper visibility)
-		_, err = r.createHPA(ctx, hpaName, s)
+		hpa, err = r.createHPA(ctx, hpaName, s)
 		if err != nil {
 			return fmt.Errorf("failed to create hpa %q: %w", hpaName, err)
 		}
@@ -57,17 +64,49 @@ func (r *Reconciler) Reconcile(ctx context.Context, s *corev1alpha1.Step) error
 		return fmt.Errorf("failed to get hpa %q: %w", hpa, err)
 	} else {
 		// deployment exists
-		_, err = r.updateHPA(ctx, hpaName, s, hpa)
+		hpa, err = r.updateHPA(ctx, hpaName, s, hpa)
 		if err != nil {
 			return fmt.Errorf("failed to update hpa %q: %w", hpaName, err)
 		}
-
-		// TODO: Surface hpa status to step
 	}
 
+	surfaceStatus(s, hpa)
+
 	return nil
 }
 
+// surfaceStatus reflects the state of the autoscaler on the step. The HPA reports whether it
+// is able to compute a scale through its ScalingActive and AbleToScale conditions.
+func surfaceStatus(s *corev1alpha1.Step, hpa *autoscaling.HorizontalPodAutoscaler) {
+	if hpa.Status.DesiredReplicas > 0 {
+		s.Status.DesiredReplicas = hpa.Status.DesiredReplicas
+	}
+
+	cond := metav1.Condition{
+		Type:               corev1alpha1.StepConditionScalingActive,
+		Status:             metav1.ConditionUnknown,
+		ObservedGeneration: s.Generation,
+		Reason:             reasonPending,
+		Message:            "waiting for autoscaler to observe the step",
+	}
+
+	for _, c := range hpa.Status.Conditions {
+		if c.Type == autoscaling.AbleToScale && c.Status == corev1.ConditionFalse {
+			cond.Status = metav1.ConditionFalse
+			cond.Reason = c.Reason
+			cond.Message = c.Message
+			break
+		}
+		if c.Type == autoscaling.ScalingActive {
+			cond.Status = metav1.ConditionStatus(c.Status)
+			cond.Reason = c.Reason
+			cond.Message = c.Message
+		}
+	}
+
+	meta.SetStatusCondition(&s.Status.Conditions, cond)
+}
+
 func (r *Reconciler) createHPA(ctx context.Context, name types.NamespacedName, s *corev1alpha1.Step) (*autoscaling.HorizontalPodAutoscaler, error) {
 	hpa, err := makeHPA(name, s)
 	if err != nil {
@@ -132,27 +171,15 @@ func makeHPA(name types.NamespacedName, s *corev1alpha1.Step) (*autoscaling.Hori
 	}
 
 	sSpec := s.Spec.DeepCopy()
-
-	// TODO: support scale to zero with hpa alpha feature gate
-	var minReplicas int32
-	if sSpec.MinReplicas == nil || (*sSpec.MinReplicas) < 1 {
-		minReplicas = 1
-	} else {
-		minReplicas = (*sSpec.MinReplicas)
+	defaults.SetDefaults(sSpec)
+	// an unset maxReplicas doesn't scale the step beyond minReplicas
+	if sSpec.MaxReplicas < *sSpec.MinReplicas {
+		sSpec.MaxReplicas = *sSpec.MinReplicas
 	}
-	hpaSpec.MinReplicas = &minReplicas
 
-	if sSpec.MaxReplicas < minReplicas {
-		hpaSpec.MaxReplicas = minReplicas
-	} else {
-		hpaSpec.MaxReplicas = sSpec.MaxReplicas
-	}
-
-	if sSpec.Metrics == nil {
-		hpaSpec.Metrics = []autoscaling.MetricSpec{}
-	} else {
-		hpaSpec.Metrics = sSpec.Metrics
-	}
+	hpaSpec.MinReplicas = sSpec.MinReplicas
+	hpaSpec.MaxReplicas = sSpec.MaxReplicas
+	hpaSpec.Metrics = sSpec.Metrics
 
 	hpaSpec.Behavior = &autoscaling.HorizontalPodAutoscalerBehavior{}
 
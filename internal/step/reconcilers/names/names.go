@@ -36,14 +36,30 @@ var (
 	excludeAnnotations = sets.NewString()
 )
 
+// DeploymentName returns the name of the deployment running the latest revision of the step,
+// this is the adopted deployment if there is one.
 func DeploymentName(s *corev1alpha1.Step) types.NamespacedName {
+	if s.Spec.Adopt != nil && s.Spec.Adopt.Deployment != "" {
+		return types.NamespacedName{
+			Namespace: s.Namespace,
+			Name:      s.Spec.Adopt.Deployment,
+		}
+	}
 	return types.NamespacedName{
 		Namespace: s.Namespace,
 		Name:      fmt.Sprintf("%s-deployment", s.GetName()),
 	}
 }
 
+// ServiceName returns the name of the service of the step, this is the adopted service if
+// there is one.
 func ServiceName(s *corev1alpha1.Step) types.NamespacedName {
+	if s.Spec.Adopt != nil && s.Spec.Adopt.Service != "" {
+		return types.NamespacedName{
+			Namespace: s.Namespace,
+			Name:      s.Spec.Adopt.Service,
+		}
+	}
 	return types.NamespacedName{
 		Namespace: s.Namespace,
 		Name:      fmt.Sprintf("%s-service", s.GetName()),
@@ -57,6 +73,33 @@ func HPAName(s *corev1alpha1.Step) types.NamespacedName {
 	}
 }
 
+// RevisionName returns the name of the revision snapshotting a pod spec of the step with the given hash.
+func RevisionName(s *corev1alpha1.Step, hash string) types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: s.Namespace,
+		Name:      fmt.Sprintf("%s-%s", s.GetName(), hash),
+	}
+}
+
+// RevisionDeploymentName returns the name of the deployment running a revision of the step
+// other than the latest, which runs in the deployment named by DeploymentName.
+func RevisionDeploymentName(s *corev1alpha1.Step, revision string) types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: s.Namespace,
+		Name:      fmt.Sprintf("%s-deployment", revision),
+	}
+}
+
+// IsAdoptedDeployment reports whether the deployment was adopted by the step rather than created by it.
+func IsAdoptedDeployment(s *corev1alpha1.Step, name string) bool {
+	return s.Spec.Adopt != nil && s.Spec.Adopt.Deployment == name
+}
+
+// IsAdoptedService reports whether the service was adopted by the step rather than created by it.
+func IsAdoptedService(s *corev1alpha1.Step, name string) bool {
+	return s.Spec.Adopt != nil && s.Spec.Adopt.Service == name
+}
+
 func MakeAnnotations(s *corev1alpha1.Step) map[string]string {
 	return kmap.Filter(s.GetAnnotations(), excludeAnnotations.Has)
 }
@@ -71,6 +114,24 @@ func MakeLabels(s *corev1alpha1.Step) map[string]string {
 	return labels
 }
 
+// MakeRevisionLabels returns the labels for a revision of the step, including the hash of the
+// pod spec it snapshots.
+func MakeRevisionLabels(s *corev1alpha1.Step, hash string) map[string]string {
+	return kmap.Union(MakeLabels(s), map[string]string{
+		kai.RevisionHashLabelKey: hash,
+	})
+}
+
+// MakePodLabels returns the labels for the pods running a revision of the step, pinned tells
+// the pods of revisions pinned by the traffic of the step apart from those of the latest revision.
+// The labels don't change with the traffic of the step so shifting traffic doesn't restart pods.
+func MakePodLabels(s *corev1alpha1.Step, revision string, pinned bool) map[string]string {
+	return kmap.Union(MakeLabels(s), map[string]string{
+		kai.StepRevisionLabelKey:   revision,
+		kai.PinnedRevisionLabelKey: fmt.Sprint(pinned),
+	})
+}
+
 func MakeSelector(s *corev1alpha1.Step) *metav1.LabelSelector {
 	return &metav1.LabelSelector{
 		MatchLabels: map[string]string{
@@ -79,8 +140,50 @@ func MakeSelector(s *corev1alpha1.Step) *metav1.LabelSelector {
 	}
 }
 
+// MakeLatestSelector returns the selector of the deployment running the latest revision of the
+// step. Unlike the revision the deployment runs, the selector never changes and excludes the
+// pods of pinned revisions so the autoscaler of the step only observes the latest revision.
+func MakeLatestSelector(s *corev1alpha1.Step) *metav1.LabelSelector {
+	return &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			kai.StepUIDLabelKey:        string(s.UID),
+			kai.PinnedRevisionLabelKey: "false",
+		},
+	}
+}
+
+// MakeRevisionSelector returns the selector of the deployment running the given pinned revision of the step.
+func MakeRevisionSelector(s *corev1alpha1.Step, revision string) *metav1.LabelSelector {
+	return &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			kai.StepUIDLabelKey:      string(s.UID),
+			kai.StepRevisionLabelKey: revision,
+		},
+	}
+}
+
+// MakeServiceSelector returns the selector of the service of the step. Pinned revisions only
+// run while they receive traffic, the pods of the latest revision are left out when it
+// receives none.
 func MakeServiceSelector(s *corev1alpha1.Step) map[string]string {
-	return map[string]string{
+	selector := map[string]string{
 		kai.StepUIDLabelKey: string(s.UID),
 	}
+	if !servesLatest(s) {
+		selector[kai.PinnedRevisionLabelKey] = "true"
+	}
+	return selector
+}
+
+// servesLatest reports whether the latest revision of the step receives traffic.
+func servesLatest(s *corev1alpha1.Step) bool {
+	if len(s.Status.Traffic) == 0 {
+		return true
+	}
+	for _, t := range s.Status.Traffic {
+		if t.RevisionName == s.Status.LatestRevision && t.Percent > 0 {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,255 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/internal/step/reconcilers/names"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"knative.dev/pkg/kmeta"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// length of the pod spec hash used to name revisions
+	hashLength = 10
+
+	// number of revisions kept for pinning besides the latest and those receiving traffic
+	// when the step doesn't set a limit
+	defaultRevisionHistoryLimit = 10
+)
+
+type Reconciler struct {
+	client kclient.Client
+}
+
+func NewReconciler(client kclient.Client) *Reconciler {
+	return &Reconciler{
+		client: client,
+	}
+}
+
+// Reconcile snapshots the pod spec of the step into an immutable revision and resolves the
+// traffic targets of the step to revisions. The deployment reconciler runs the revisions
+// recorded in the traffic status of the step.
+func (r *Reconciler) Reconcile(ctx context.Context, s *corev1alpha1.Step) error {
+	revisions, err := r.listRevisions(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	hash, data, err := hashPodSpec(&s.Spec.PodSpec)
+	if err != nil {
+		return err
+	}
+
+	var latest int64
+	for _, rev := range revisions {
+		if rev.Revision > latest {
+			latest = rev.Revision
+		}
+	}
+
+	name := names.RevisionName(s, hash)
+	current := findRevision(revisions, name.Name)
+	switch {
+	case current == nil:
+		current, err = r.createRevision(ctx, s, hash, data, latest+1)
+		if err != nil {
+			return err
+		}
+		revisions = append(revisions, current)
+	case current.Revision < latest:
+		// returning to an earlier pod spec makes its revision the latest again
+		current.Revision = latest + 1
+		if err := r.client.Update(ctx, current); err != nil {
+			return fmt.Errorf("failed to update revision %q of step %q: %w", current.Name, s.NamespacedName(), err)
+		}
+	}
+	s.Status.LatestRevision = current.Name
+
+	traffic, err := resolveTraffic(s, revisions)
+	if err != nil {
+		return err
+	}
+	s.Status.Traffic = traffic
+
+	return r.pruneRevisions(ctx, s, revisions)
+}
+
+// listRevisions returns the revisions of the step ordered from oldest to newest.
+func (r *Reconciler) listRevisions(ctx context.Context, s *corev1alpha1.Step) ([]*appsv1.ControllerRevision, error) {
+	selector, err := metav1.LabelSelectorAsSelector(names.MakeSelector(s))
+	if err != nil {
+		return nil, fmt.Errorf("failed to make selector for step %q: %w", s.NamespacedName(), err)
+	}
+
+	list := &appsv1.ControllerRevisionList{}
+	err = r.client.List(ctx, list, kclient.InNamespace(s.Namespace), kclient.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions of step %q: %w", s.NamespacedName(), err)
+	}
+
+	revisions := make([]*appsv1.ControllerRevision, 0, len(list.Items))
+	for i := range list.Items {
+		if metav1.IsControlledBy(&list.Items[i], s) {
+			revisions = append(revisions, &list.Items[i])
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+
+	return revisions, nil
+}
+
+func (r *Reconciler) createRevision(ctx context.Context, s *corev1alpha1.Step, hash string, data []byte, revision int64) (*appsv1.ControllerRevision, error) {
+	name := names.RevisionName(s, hash)
+	rev := &appsv1.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name.Name,
+			Namespace:       name.Namespace,
+			Labels:          names.MakeRevisionLabels(s, hash),
+			Annotations:     names.MakeAnnotations(s),
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(s)},
+		},
+		Data:     runtime.RawExtension{Raw: data},
+		Revision: revision,
+	}
+
+	if err := r.client.Create(ctx, rev); err != nil {
+		return nil, fmt.Errorf("failed to create revision %q of step %q: %w", name.Name, s.NamespacedName(), err)
+	}
+
+	return rev, nil
+}
+
+// pruneRevisions deletes the oldest revisions beyond the history limit. The latest revision
+// and revisions receiving traffic are always kept.
+func (r *Reconciler) pruneRevisions(ctx context.Context, s *corev1alpha1.Step, revisions []*appsv1.ControllerRevision) error {
+	inUse := sets.NewString(s.Status.LatestRevision)
+	for _, t := range s.Status.Traffic {
+		inUse.Insert(t.RevisionName)
+	}
+
+	var history []*appsv1.ControllerRevision
+	for _, rev := range revisions {
+		if !inUse.Has(rev.Name) {
+			history = append(history, rev)
+		}
+	}
+	limit := defaultRevisionHistoryLimit
+	if s.Spec.RevisionHistoryLimit != nil {
+		limit = int(*s.Spec.RevisionHistoryLimit)
+	}
+	if len(history) <= limit {
+		return nil
+	}
+
+	for _, rev := range history[:len(history)-limit] {
+		err := r.client.Delete(ctx, rev)
+		if kclient.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete revision %q of step %q: %w", rev.Name, s.NamespacedName(), err)
+		}
+	}
+
+	return nil
+}
+
+// resolveTraffic resolves the traffic targets of the step to its revisions. All traffic goes
+// to the latest revision unless the step splits it.
+func resolveTraffic(s *corev1alpha1.Step, revisions []*appsv1.ControllerRevision) ([]corev1alpha1.TrafficTargetStatus, error) {
+	if len(s.Spec.Traffic) == 0 {
+		return []corev1alpha1.TrafficTargetStatus{{
+			RevisionName:   s.Status.LatestRevision,
+			LatestRevision: true,
+			Percent:        100,
+		}}, nil
+	}
+
+	var total int64
+	out := make([]corev1alpha1.TrafficTargetStatus, 0, len(s.Spec.Traffic))
+	for i, t := range s.Spec.Traffic {
+		latest := t.LatestRevision != nil && *t.LatestRevision
+		switch {
+		case latest && t.RevisionName != "":
+			return nil, fmt.Errorf("traffic target %d sets both revisionName and latestRevision", i)
+		case latest:
+			out = append(out, corev1alpha1.TrafficTargetStatus{
+				RevisionName:   s.Status.LatestRevision,
+				LatestRevision: true,
+				Percent:        t.Percent,
+			})
+		case t.RevisionName != "":
+			if findRevision(revisions, t.RevisionName) == nil {
+				return nil, fmt.Errorf("traffic target %d references unknown revision %q", i, t.RevisionName)
+			}
+			out = append(out, corev1alpha1.TrafficTargetStatus{
+				RevisionName: t.RevisionName,
+				Percent:      t.Percent,
+			})
+		default:
+			return nil, fmt.Errorf("traffic target %d sets neither revisionName nor latestRevision", i)
+		}
+		total += t.Percent
+	}
+
+	if total != 100 {
+		return nil, fmt.Errorf("traffic percentages add up to %d, expected 100", total)
+	}
+
+	return out, nil
+}
+
+// hashPodSpec returns the serialized pod spec stored by a revision along with its hash.
+func hashPodSpec(spec *corev1alpha1.PodSpec) (string, []byte, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to serialize pod spec: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:hashLength], data, nil
+}
+
+func findRevision(revisions []*appsv1.ControllerRevision, name string) *appsv1.ControllerRevision {
+	for _, rev := range revisions {
+		if rev.Name == name {
+			return rev
+		}
+	}
+	return nil
+}
+
+// PodSpec returns the pod spec recorded by a revision of the step.
+func PodSpec(rev *appsv1.ControllerRevision) (*corev1alpha1.PodSpec, error) {
+	spec := &corev1alpha1.PodSpec{}
+	if err := json.Unmarshal(rev.Data.Raw, spec); err != nil {
+		return nil, fmt.Errorf("failed to decode revision %q: %w", rev.Name, err)
+	}
+	return spec, nil
+}
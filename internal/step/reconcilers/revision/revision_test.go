@@ -0,0 +1,170 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResolveTraffic(t *testing.T) {
+	latest := true
+	revisions := []*appsv1.ControllerRevision{
+		{ObjectMeta: metav1.ObjectMeta{Name: "classifier-aaaaaaaaaa"}, Revision: 1},
+		{ObjectMeta: metav1.ObjectMeta{Name: "classifier-bbbbbbbbbb"}, Revision: 2},
+	}
+
+	tests := []struct {
+		name    string
+		traffic []corev1alpha1.TrafficTarget
+		want    []corev1alpha1.TrafficTargetStatus
+		wantErr bool
+	}{{
+		name: "defaults to latest",
+		want: []corev1alpha1.TrafficTargetStatus{
+			{RevisionName: "classifier-bbbbbbbbbb", LatestRevision: true, Percent: 100},
+		},
+	}, {
+		name: "canary",
+		traffic: []corev1alpha1.TrafficTarget{
+			{RevisionName: "classifier-aaaaaaaaaa", Percent: 90},
+			{LatestRevision: &latest, Percent: 10},
+		},
+		want: []corev1alpha1.TrafficTargetStatus{
+			{RevisionName: "classifier-aaaaaaaaaa", Percent: 90},
+			{RevisionName: "classifier-bbbbbbbbbb", LatestRevision: true, Percent: 10},
+		},
+	}, {
+		name: "unknown revision",
+		traffic: []corev1alpha1.TrafficTarget{
+			{RevisionName: "classifier-cccccccccc", Percent: 100},
+		},
+		wantErr: true,
+	}, {
+		name: "percentages don't add up",
+		traffic: []corev1alpha1.TrafficTarget{
+			{RevisionName: "classifier-aaaaaaaaaa", Percent: 50},
+			{LatestRevision: &latest, Percent: 10},
+		},
+		wantErr: true,
+	}, {
+		name: "ambiguous target",
+		traffic: []corev1alpha1.TrafficTarget{
+			{RevisionName: "classifier-aaaaaaaaaa", LatestRevision: &latest, Percent: 100},
+		},
+		wantErr: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &corev1alpha1.Step{
+				Spec:   corev1alpha1.StepSpec{Traffic: tt.traffic},
+				Status: corev1alpha1.StepStatus{LatestRevision: "classifier-bbbbbbbbbb"},
+			}
+
+			got, err := resolveTraffic(s, revisions)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveTraffic() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("resolveTraffic() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcilePrunesRevisions(t *testing.T) {
+	limit := func(n int32) *int32 { return &n }
+
+	tests := []struct {
+		name  string
+		limit *int32
+		want  int
+	}{{
+		name: "default",
+		want: defaultRevisionHistoryLimit + 2,
+	}, {
+		name:  "limit",
+		limit: limit(3),
+		want:  3 + 2,
+	}, {
+		name:  "no history",
+		limit: limit(0),
+		want:  2,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			scheme := runtime.NewScheme()
+			if err := corev1alpha1.AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+			if err := appsv1.AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+			kc := fake.NewClientBuilder().WithScheme(scheme).Build()
+			r := NewReconciler(kc)
+
+			s := &corev1alpha1.Step{
+				TypeMeta:   metav1.TypeMeta{APIVersion: corev1alpha1.GroupVersion.String(), Kind: "Step"},
+				ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "default", UID: "classifier-uid"},
+				Spec: corev1alpha1.StepSpec{
+					PodSpec:              corev1alpha1.PodSpec{Containers: []corev1.Container{{Name: "server", Image: "torchserve:0"}}},
+					RevisionHistoryLimit: tt.limit,
+				},
+			}
+			if err := r.Reconcile(ctx, s); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// pin the first revision so it is kept regardless of the limit
+			first := s.Status.LatestRevision
+			s.Spec.Traffic = []corev1alpha1.TrafficTarget{{RevisionName: first, Percent: 100}}
+
+			for i := 1; i <= 20; i++ {
+				s.Spec.Containers[0].Image = fmt.Sprintf("torchserve:%d", i)
+				if err := r.Reconcile(ctx, s); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			list := &appsv1.ControllerRevisionList{}
+			if err := kc.List(ctx, list); err != nil {
+				t.Fatal(err)
+			}
+			if len(list.Items) != tt.want {
+				t.Errorf("expected %d revisions, got %d", tt.want, len(list.Items))
+			}
+			kept := map[string]bool{}
+			for _, rev := range list.Items {
+				kept[rev.Name] = true
+			}
+			if !kept[first] || !kept[s.Status.LatestRevision] {
+				t.Errorf("expected pinned revision %q and latest revision %q to be kept, got %v", first, s.Status.LatestRevision, kept)
+			}
+		})
+	}
+}
@@ -21,18 +21,29 @@ import (
 	"fmt"
 
 	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	"github.com/dreamstax/kai/api/kai"
+	"github.com/dreamstax/kai/internal/step/reconcilers/adoption"
 	"github.com/dreamstax/kai/internal/step/reconcilers/names"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"knative.dev/pkg/kmap"
 	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/network"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// reasons surfaced on the ServiceReady condition
+const (
+	reasonServiceReady = "ServiceReady"
+	reasonAllocatingIP = "AllocatingClusterIP"
+)
+
 type Reconciler struct {
 	client kclient.Client
 }
@@ -49,8 +60,7 @@ func (r *Reconciler) Reconcile(ctx context.Context, s *corev1alpha1.Step) error
 	err := r.client.Get(ctx, serviceName, service)
 	if apierrs.IsNotFound(err) {
 		// service doesn't exist so create it
-		// TODO: set step status
-		_, err = r.createService(ctx, serviceName, s)
+		service, err = r.createService(ctx, serviceName, s)
 		if err != nil {
 			return fmt.Errorf("faield to create service %q: %w", serviceName, err)
 		}
@@ -58,17 +68,49 @@ func (r *Reconciler) Reconcile(ctx context.Context, s *corev1alpha1.Step) error
 		return fmt.Errorf("failed to get service %q: %w", serviceName, err)
 	} else {
 		// service exists
-		_, err = r.updateService(ctx, serviceName, s, service)
+		service, err = r.updateService(ctx, serviceName, s, service)
 		if err != nil {
 			return fmt.Errorf("failed to update service %q: %w", serviceName, err)
 		}
-
-		// TODO: surface service status to step
 	}
 
+	surfaceStatus(s, service)
+
 	return nil
 }
 
+// surfaceStatus reflects the address of the service on the step.
+func surfaceStatus(s *corev1alpha1.Step, svc *v1.Service) {
+	cond := metav1.Condition{
+		Type:               corev1alpha1.StepConditionServiceReady,
+		ObservedGeneration: s.Generation,
+	}
+
+	if svc.Spec.ClusterIP == "" {
+		s.Status.URL = ""
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = reasonAllocatingIP
+		cond.Message = "waiting for service to be assigned a cluster ip"
+		meta.SetStatusCondition(&s.Status.Conditions, cond)
+		return
+	}
+
+	s.Status.URL = makeURL(svc)
+	cond.Status = metav1.ConditionTrue
+	cond.Reason = reasonServiceReady
+	cond.Message = fmt.Sprintf("service available at %s", s.Status.URL)
+	meta.SetStatusCondition(&s.Status.Conditions, cond)
+}
+
+// makeURL returns the in-cluster address of the service using its first port.
+func makeURL(svc *v1.Service) string {
+	host := network.GetServiceHostname(svc.Name, svc.Namespace)
+	if len(svc.Spec.Ports) == 0 || svc.Spec.Ports[0].Port == 80 {
+		return fmt.Sprintf("http://%s", host)
+	}
+	return fmt.Sprintf("http://%s:%d", host, svc.Spec.Ports[0].Port)
+}
+
 func (r *Reconciler) createService(ctx context.Context, name types.NamespacedName, s *corev1alpha1.Step) (*v1.Service, error) {
 	service, err := makeService(name, s)
 	if err != nil {
@@ -89,11 +131,20 @@ func (r *Reconciler) updateService(ctx context.Context, name types.NamespacedNam
 		return nil, fmt.Errorf("failed to update service %q: %w", name, err)
 	}
 
-	if equality.Semantic.DeepEqual(in.Spec, service.Spec) {
+	if names.IsAdoptedService(s, in.Name) {
+		if err := r.adoptSpec(ctx, s, in, service); err != nil {
+			return nil, err
+		}
+	}
+
+	if equality.Semantic.DeepEqual(in.Spec, service.Spec) && metav1.IsControlledBy(in, s) {
 		return in, nil
 	}
 
 	out := in.DeepCopy()
+	if err := adoption.Claim(s, out); err != nil {
+		return nil, fmt.Errorf("failed to adopt service %q: %w", name, err)
+	}
 	out.Spec = service.Spec
 	out.Labels = kmap.Union(service.Labels, out.Labels)
 
@@ -105,6 +156,43 @@ func (r *Reconciler) updateService(ctx context.Context, name types.NamespacedNam
 	return out, nil
 }
 
+// adoptSpec keeps an adopted service as it was configured, only taking over the ports declared
+// by the step. The service keeps selecting the pods it did until the pods of the step's
+// deployment have all been labeled for the step.
+func (r *Reconciler) adoptSpec(ctx context.Context, s *corev1alpha1.Step, in, desired *v1.Service) error {
+	spec := in.Spec.DeepCopy()
+	if ports := makePorts(s); len(ports) > 0 {
+		spec.Ports = ports
+	}
+
+	labeled, err := r.podsLabeled(ctx, s)
+	if err != nil {
+		return err
+	}
+	if labeled {
+		spec.Selector = desired.Spec.Selector
+	}
+
+	desired.Spec = *spec
+	return nil
+}
+
+// podsLabeled reports whether all pods of the step's deployment carry the labels of the step.
+func (r *Reconciler) podsLabeled(ctx context.Context, s *corev1alpha1.Step) (bool, error) {
+	name := names.DeploymentName(s)
+	d := &appsv1.Deployment{}
+	err := r.client.Get(ctx, name, d)
+	if apierrs.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get deployment %q: %w", name, err)
+	}
+
+	return d.Spec.Template.Labels[kai.StepUIDLabelKey] == string(s.UID) &&
+		d.Status.ObservedGeneration >= d.Generation &&
+		d.Status.UpdatedReplicas == d.Status.Replicas, nil
+}
+
 func makeService(name types.NamespacedName, s *corev1alpha1.Step) (*v1.Service, error) {
 	labels := names.MakeLabels(s)
 	annotations := names.MakeAnnotations(s)
@@ -6,31 +6,48 @@ import (
 
 	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
 	"github.com/dreamstax/kai/internal/credentials"
+	"github.com/dreamstax/kai/internal/step/defaults"
+	"github.com/dreamstax/kai/internal/step/modelruntime"
 	"github.com/dreamstax/kai/internal/step/reconcilers/deployment"
 	"github.com/dreamstax/kai/internal/step/reconcilers/hpa"
+	"github.com/dreamstax/kai/internal/step/reconcilers/revision"
 	"github.com/dreamstax/kai/internal/step/reconcilers/service"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// reasons surfaced on the Ready condition
 const (
-	storageInitializerImage       = "kserve/storage-initializer:v0.10.1"
-	modelVolumeName               = "kai-mount-location"
-	inferenceServiceContainerName = "kai-container"
+	reasonReady          = "Ready"
+	reasonPending        = "Pending"
+	reasonReconcileError = "ReconcileError"
+)
+
+const (
+	storageInitializerImage = "kserve/storage-initializer:v0.10.1"
+	modelVolumeName         = "kai-mount-location"
+	modelMountPath          = "/mnt/models"
 )
 
 type Client struct {
 	kclient    kclient.Client
+	apiReader  kclient.Reader
 	credClient *credentials.Client
 }
 
-func New(client kclient.Client) *Client {
+// New returns a client reconciling steps, apiReader reads the objects left out of the cache of
+// the client.
+func New(client kclient.Client, apiReader kclient.Reader) *Client {
 	return &Client{
 		kclient:    client,
+		apiReader:  apiReader,
 		credClient: credentials.NewDefaultCredentialBuilder(client),
 	}
 }
@@ -45,50 +62,117 @@ func (c *Client) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result,
 		return ctrl.Result{}, fmt.Errorf("failed to retrieve latest step %s: %w", req.NamespacedName, err)
 	}
 
+	original := s.DeepCopy()
+	reconcileErr := c.reconcile(ctx, s)
+	setReadyCondition(s, reconcileErr)
+	if reconcileErr == nil {
+		s.Status.ObservedGeneration = s.Generation
+	}
+
+	// reconcilers record what they observe on the in-memory step, persist it even
+	// if reconciliation failed part way through
+	if !equality.Semantic.DeepEqual(original.Status, s.Status) {
+		if err := c.kclient.Status().Update(ctx, s); err != nil && reconcileErr == nil {
+			reconcileErr = fmt.Errorf("failed to update status of step %s: %w", req.NamespacedName, err)
+		}
+	}
+
+	return ctrl.Result{}, reconcileErr
+}
+
+func (c *Client) reconcile(ctx context.Context, s *corev1alpha1.Step) error {
 	// should we merge modelSpec and PodSpec here?
 	// NOTE: since we're potentially merging values here higher level resources may not be aware of these changes
 	// until after reconcile
 	if s.Spec.Model != nil {
 		ic, err := c.makeInitContainer(ctx, s.NamespacedName(), s.Spec.Model, &s.Spec.PodSpec)
 		if err != nil {
-			return ctrl.Result{}, err
+			return err
 		}
 		s.Spec.InitContainers = []corev1.Container{
 			ic,
 		}
 
-		rt, err := c.getModelRuntime(ctx, s)
+		rt, err := modelruntime.Resolve(ctx, c.kclient, s)
 		if err != nil {
-			return ctrl.Result{}, err
+			return err
 		}
 
-		mergeRuntimeSpec(&s.Spec, rt)
+		s.Status.ModelRuntime = rt.Selection()
+		if err := mergeRuntimeSpec(s, &rt.Spec); err != nil {
+			return err
+		}
+	} else {
+		s.Status.ModelRuntime = nil
+		applyEnv(&s.Spec)
 	}
 
 	for _, rec := range []func(context.Context, *corev1alpha1.Step) error{
-		deployment.NewReconciler(c.kclient).Reconcile,
+		// the deployments run the revisions resolved from the traffic of the step
+		revision.NewReconciler(c.kclient).Reconcile,
+		deployment.NewReconciler(c.kclient, c.apiReader).Reconcile,
 		service.NewReconciler(c.kclient).Reconcile,
 		hpa.NewReconciler(c.kclient).Reconcile,
 	} {
 		if err := rec(ctx, s); err != nil {
-			return ctrl.Result{}, err
+			return err
 		}
 	}
 
-	return ctrl.Result{}, nil
+	return nil
+}
+
+// setReadyCondition rolls the deployment and service conditions up into the Ready condition
+// of the step. Errors encountered while reconciling take precedence over child conditions.
+func setReadyCondition(s *corev1alpha1.Step, reconcileErr error) {
+	cond := metav1.Condition{
+		Type:               corev1alpha1.StepConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: s.Generation,
+		Reason:             reasonReady,
+	}
+
+	if reconcileErr != nil {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reasonReconcileError
+		cond.Message = reconcileErr.Error()
+		meta.SetStatusCondition(&s.Status.Conditions, cond)
+		return
+	}
+
+	for _, t := range []string{
+		corev1alpha1.StepConditionDeploymentReady,
+		corev1alpha1.StepConditionServiceReady,
+	} {
+		dep := meta.FindStatusCondition(s.Status.Conditions, t)
+		if dep == nil {
+			cond.Status = metav1.ConditionUnknown
+			cond.Reason = reasonPending
+			cond.Message = fmt.Sprintf("waiting for %s", t)
+			break
+		}
+		if dep.Status != metav1.ConditionTrue {
+			cond.Status = dep.Status
+			cond.Reason = dep.Reason
+			cond.Message = dep.Message
+			break
+		}
+	}
+
+	meta.SetStatusCondition(&s.Status.Conditions, cond)
 }
 
 func (c *Client) makeInitContainer(ctx context.Context, name types.NamespacedName, m *corev1alpha1.ModelSpec, p *corev1alpha1.PodSpec) (corev1.Container, error) {
 	initContainer := corev1.Container{
 		Args: []string{
 			m.URI,
-			"/mnt/models",
+			modelMountPath,
 		},
 		Name:  "storage-initializer",
 		Image: storageInitializerImage,
 		VolumeMounts: []corev1.VolumeMount{
 			{
-				MountPath: "/mnt/models",
+				MountPath: modelMountPath,
 				Name:      modelVolumeName,
 			},
 		},
@@ -110,44 +194,30 @@ func (c *Client) makeInitContainer(ctx context.Context, name types.NamespacedNam
 	return initContainer, nil
 }
 
-func (c *Client) getModelRuntime(ctx context.Context, s *corev1alpha1.Step) (corev1alpha1.ModelRuntime, error) {
-	// only support cluster wide modelRuntimes atm can easily support namespaced ones
-	runtimes := &corev1alpha1.ModelRuntimeList{}
-	err := c.kclient.List(ctx, runtimes)
-	if err != nil {
-		return corev1alpha1.ModelRuntime{}, fmt.Errorf("failed to list modelruntimes %w", err)
+// applyEnv adds the env of the step to each of its containers.
+func applyEnv(spec *corev1alpha1.StepSpec) {
+	for i := range spec.Containers {
+		spec.Containers[i].Env = defaults.MergeEnv(spec.Containers[i].Env, spec.Env)
 	}
+}
 
-	// if modelRuntime is specified in spec use that ilo modelformat
-	if s.Spec.Model.ModelRuntime != "" {
-		for _, rt := range runtimes.Items {
-			if rt.Name == s.Spec.Model.ModelRuntime {
-				return rt, nil
-			}
-		}
-	}
+func mergeRuntimeSpec(s *corev1alpha1.Step, rt *corev1alpha1.ModelRuntimeSpec) error {
+	stepSpec := &s.Spec
 
-	// modelRuntime not specified so match based on modelFormat
-	// first match wins, may need to sort this for consistency
-	for _, rt := range runtimes.Items {
-		for _, format := range rt.Spec.SupportedModelFormats {
-			if format == s.Spec.Model.ModelFormat {
-				return rt, nil
-			}
-		}
+	// containers of the step override the modelRuntime containers of the same name
+	containers, err := mergeContainers(rt.Containers, stepSpec.Containers, stepSpec.Model.ArgsPolicy)
+	if err != nil {
+		return err
 	}
-
-	return corev1alpha1.ModelRuntime{}, fmt.Errorf("no supporting modelruntime found")
-}
-
-func mergeRuntimeSpec(stepSpec *corev1alpha1.StepSpec, rt corev1alpha1.ModelRuntime) {
-	// we don't allow container level overrides at the inference service level
-	// so replace containers in podSpec with our modelRuntime containers
-	stepSpec.Containers = rt.Spec.Containers
+	if err := resolvePlaceholders(s, containers); err != nil {
+		return err
+	}
+	stepSpec.Containers = containers
+	applyEnv(stepSpec)
 	for i, con := range stepSpec.Containers {
-		if con.Name == inferenceServiceContainerName {
+		if con.Name == corev1alpha1.InferenceContainerName {
 			stepSpec.Containers[i].VolumeMounts = append(con.VolumeMounts, corev1.VolumeMount{
-				MountPath: "/mnt/models",
+				MountPath: modelMountPath,
 				Name:      modelVolumeName,
 			})
 		}
@@ -163,20 +233,6 @@ func mergeRuntimeSpec(stepSpec *corev1alpha1.StepSpec, rt corev1alpha1.ModelRunt
 	stepSpec.Volumes = append(stepSpec.Volumes, mountVolume)
 
 	// set additional overrides if necessary
-	// both values could be empty but always default to modelRuntime value
-	if stepSpec.MinReplicas == nil || (*stepSpec.MinReplicas) < 1 {
-		stepSpec.MinReplicas = rt.Spec.MinReplicas
-	}
-
-	if stepSpec.MaxReplicas == 0 {
-		stepSpec.MaxReplicas = rt.Spec.MaxReplicas
-	}
-
-	if len(stepSpec.Metrics) == 0 {
-		stepSpec.Metrics = rt.Spec.Metrics
-	}
-
-	if stepSpec.Behavior == nil {
-		stepSpec.Behavior = rt.Spec.Behavior
-	}
+	defaults.ApplyModelRuntime(stepSpec, rt)
+	return nil
 }
@@ -0,0 +1,183 @@
+/*
+Copyright 2023 The Kai Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package step
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1alpha1 "github.com/dreamstax/kai/api/core/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSetReadyCondition(t *testing.T) {
+	deploymentReady := metav1.Condition{Type: corev1alpha1.StepConditionDeploymentReady, Status: metav1.ConditionTrue, Reason: "Available"}
+	deploying := metav1.Condition{Type: corev1alpha1.StepConditionDeploymentReady, Status: metav1.ConditionFalse, Reason: "Deploying", Message: "0/1 replicas available"}
+	serviceReady := metav1.Condition{Type: corev1alpha1.StepConditionServiceReady, Status: metav1.ConditionTrue, Reason: "ServiceReady"}
+	allocating := metav1.Condition{Type: corev1alpha1.StepConditionServiceReady, Status: metav1.ConditionUnknown, Reason: "AllocatingClusterIP", Message: "waiting for cluster IP"}
+
+	tests := []struct {
+		name       string
+		conditions []metav1.Condition
+		err        error
+		status     metav1.ConditionStatus
+		reason     string
+		message    string
+	}{{
+		name:       "ready",
+		conditions: []metav1.Condition{deploymentReady, serviceReady},
+		status:     metav1.ConditionTrue,
+		reason:     reasonReady,
+	}, {
+		name:    "no child conditions",
+		status:  metav1.ConditionUnknown,
+		reason:  reasonPending,
+		message: "waiting for DeploymentReady",
+	}, {
+		name:       "service pending",
+		conditions: []metav1.Condition{deploymentReady},
+		status:     metav1.ConditionUnknown,
+		reason:     reasonPending,
+		message:    "waiting for ServiceReady",
+	}, {
+		name:       "deployment not ready",
+		conditions: []metav1.Condition{deploying, serviceReady},
+		status:     metav1.ConditionFalse,
+		reason:     "Deploying",
+		message:    "0/1 replicas available",
+	}, {
+		name:       "deployment takes precedence over service",
+		conditions: []metav1.Condition{deploying, allocating},
+		status:     metav1.ConditionFalse,
+		reason:     "Deploying",
+		message:    "0/1 replicas available",
+	}, {
+		name:       "service not ready",
+		conditions: []metav1.Condition{deploymentReady, allocating},
+		status:     metav1.ConditionUnknown,
+		reason:     "AllocatingClusterIP",
+		message:    "waiting for cluster IP",
+	}, {
+		name:       "reconcile error takes precedence",
+		conditions: []metav1.Condition{deploying, allocating},
+		err:        errors.New("failed to create deployment"),
+		status:     metav1.ConditionFalse,
+		reason:     reasonReconcileError,
+		message:    "failed to create deployment",
+	}, {
+		name:       "reconcile error with ready children",
+		conditions: []metav1.Condition{deploymentReady, serviceReady},
+		err:        errors.New("failed to update hpa"),
+		status:     metav1.ConditionFalse,
+		reason:     reasonReconcileError,
+		message:    "failed to update hpa",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &corev1alpha1.Step{
+				ObjectMeta: metav1.ObjectMeta{Generation: 4},
+				Status:     corev1alpha1.StepStatus{Conditions: tt.conditions},
+			}
+			setReadyCondition(s, tt.err)
+
+			cond := meta.FindStatusCondition(s.Status.Conditions, corev1alpha1.StepConditionReady)
+			if cond == nil {
+				t.Fatal("expected Ready condition to be set")
+			}
+			if cond.Status != tt.status || cond.Reason != tt.reason || cond.Message != tt.message {
+				t.Errorf("expected %s/%s %q, got %s/%s %q", tt.status, tt.reason, tt.message, cond.Status, cond.Reason, cond.Message)
+			}
+			if cond.ObservedGeneration != 4 {
+				t.Errorf("expected observed generation 4, got %d", cond.ObservedGeneration)
+			}
+		})
+	}
+}
+
+func TestReconcileSetsConditions(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		corev1alpha1.AddToScheme,
+		corev1.AddToScheme,
+		appsv1.AddToScheme,
+		autoscalingv2.AddToScheme,
+	} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	s := &corev1alpha1.Step{
+		ObjectMeta: metav1.ObjectMeta{Name: "classifier", Namespace: "default", UID: "classifier-uid", Generation: 1},
+		Spec: corev1alpha1.StepSpec{
+			PodSpec: corev1alpha1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:  "kai-container",
+					Image: "kai/classifier",
+					Ports: []corev1.ContainerPort{{ContainerPort: 8080}},
+				}},
+			},
+		},
+	}
+	kc := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(s).
+		WithStatusSubresource(s).
+		Build()
+
+	name := types.NamespacedName{Name: "classifier", Namespace: "default"}
+	if _, err := New(kc, kc).Reconcile(ctx, ctrl.Request{NamespacedName: name}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := &corev1alpha1.Step{}
+	if err := kc.Get(ctx, name, got); err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []string{
+		corev1alpha1.StepConditionDeploymentReady,
+		corev1alpha1.StepConditionServiceReady,
+	} {
+		if meta.FindStatusCondition(got.Status.Conditions, typ) == nil {
+			t.Errorf("expected %s condition to be set, got %+v", typ, got.Status.Conditions)
+		}
+	}
+
+	// the deployment has no available replicas yet so it decides the Ready condition
+	deployment := meta.FindStatusCondition(got.Status.Conditions, corev1alpha1.StepConditionDeploymentReady)
+	ready := meta.FindStatusCondition(got.Status.Conditions, corev1alpha1.StepConditionReady)
+	if ready == nil || ready.Status == metav1.ConditionTrue {
+		t.Fatalf("expected step not to be ready, got %+v", ready)
+	}
+	if deployment != nil && (ready.Reason != deployment.Reason || ready.Message != deployment.Message) {
+		t.Errorf("expected Ready to report the deployment condition %+v, got %+v", deployment, ready)
+	}
+	if got.Status.ObservedGeneration != 1 {
+		t.Errorf("expected observed generation 1, got %d", got.Status.ObservedGeneration)
+	}
+}